@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// aftershockCluster is the running summary of smaller quakes near a posted mainshock
+type aftershockCluster struct {
+	MainshockKey string `json:"mainshock_key"`
+	Origin       string `json:"origin"`
+	Count        int    `json:"count"`
+	MaxMagnitude string `json:"max_magnitude"`
+	// when the largest aftershock occurred
+	MaxAt time.Time `json:"max_at,omitempty"`
+	// event ID of the summary message that is edited as the cluster grows
+	SummaryEventID string    `json:"summary_event_id,omitempty"`
+	LastAt         time.Time `json:"last_at"`
+	// with AFTERSHOCK_SUMMARY_INTERVAL, when the last summary was posted and how many aftershocks it counted
+	SummarizedAt    time.Time `json:"summarized_at,omitempty"`
+	SummarizedCount int       `json:"summarized_count,omitempty"`
+	// the mainshock, to format the summaries posted between cycles
+	Mainshock PostedQuake `json:"mainshock"`
+}
+
+// clusters by mainshock key, persisted so a restart keeps editing the same summaries
+var aftershockClusters = map[string]*aftershockCluster{}
+
+// quakeCoords parses the coordinates of a quake
+func quakeCoords(q Quake) (float64, float64, bool) {
+	lat, ok1 := parseCoord(q.Latitude)
+	lon, ok2 := parseCoord(q.Longitude)
+	return lat, lon, ok1 && ok2
+}
+
+// findMainshock returns the posted quake that q is an aftershock of: individually posted, stronger
+// than q and at least AFTERSHOCK_MAINSHOCK_MAG, no more than CLUSTER_WINDOW before it and within
+// CLUSTER_RADIUS_KM. The strongest candidate wins. justPosted holds quakes posted this cycle, not yet
+// in postedQuakes. Quakes of mainshock size are never aftershocks.
+func findMainshock(postedQuakes map[string]PostedQuake, justPosted []PostedQuake, q Quake) (PostedQuake, bool) {
+	lat, lon, ok := quakeCoords(q)
+	if !ok || q.OccurredAt.IsZero() {
+		return PostedQuake{}, false
+	}
+	if aftershockMainshockMag > 0 && q.MagnitudeValue >= aftershockMainshockMag {
+		return PostedQuake{}, false
+	}
+
+	candidates := append([]PostedQuake(nil), justPosted...)
+	for _, p := range postedQuakes {
+		candidates = append(candidates, p)
+	}
+
+	var best PostedQuake
+	found := false
+	for _, p := range candidates {
+		if p.EventID == "" || p.MagnitudeValue <= q.MagnitudeValue || p.MagnitudeValue < aftershockMainshockMag {
+			continue
+		}
+		if p.OccurredAt.After(q.OccurredAt) || q.OccurredAt.Sub(p.OccurredAt) > clusterWindow {
+			continue
+		}
+		pLat, pLon, ok := quakeCoords(p.Quake)
+		if !ok || distanceKm(lat, lon, pLat, pLon) > clusterRadiusKm {
+			continue
+		}
+		if !found || p.MagnitudeValue > best.MagnitudeValue {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// displayAftershock reports whether an aftershock is strong enough to be posted on its own as well,
+// AFTERSHOCK_DISPLAY_MAG and up
+func displayAftershock(q Quake) bool {
+	return aftershockDisplayMag > 0 && q.MagnitudeValue >= aftershockDisplayMag
+}
+
+// addToCluster counts q towards the summary of its mainshock. Without AFTERSHOCK_SUMMARY_INTERVAL
+// the summary is posted as a reply to the mainshock, or the existing summary edited in place, right
+// away; otherwise flushClusterSummaries posts it.
+func addToCluster(ctx context.Context, mainshock PostedQuake, q Quake) {
+	key := quakeLocationKey(mainshock.Quake)
+	c, ok := aftershockClusters[key]
+	if !ok {
+		c = &aftershockCluster{MainshockKey: key, Origin: mainshock.Origin}
+		aftershockClusters[key] = c
+	}
+	c.Mainshock = mainshock
+	c.Count++
+	if c.MaxMagnitude == "" || q.MagnitudeValue > parseMag(c.MaxMagnitude) {
+		c.MaxMagnitude = q.Magnitude
+		c.MaxAt = q.OccurredAt
+	}
+	c.LastAt = q.OccurredAt
+	log.Printf("🔂 Clustered aftershock: %s | M%s | %s (%d near %s)", q.DateTime, q.Magnitude, q.Location, c.Count, c.Origin)
+
+	if aftershockSummaryInterval == 0 {
+		postClusterSummary(ctx, c)
+	}
+	saveAftershockClusters(aftershockClusters, statePath(CLUSTER_STATE_FILE))
+}
+
+// flushClusterSummaries posts the summary of the clusters that grew since their last summary, once
+// AFTERSHOCK_SUMMARY_INTERVAL passed or the cluster is about to expire
+func flushClusterSummaries(ctx context.Context) {
+	if aftershockSummaryInterval == 0 || len(aftershockClusters) == 0 {
+		return
+	}
+	for _, c := range aftershockClusters {
+		if c.Count == c.SummarizedCount {
+			continue
+		}
+		expiring := time.Since(c.LastAt) > clusterWindow
+		if !expiring && time.Since(c.SummarizedAt) < aftershockSummaryInterval {
+			continue
+		}
+		postClusterSummary(ctx, c)
+	}
+	saveAftershockClusters(aftershockClusters, statePath(CLUSTER_STATE_FILE))
+}
+
+// postClusterSummary edits the summary of a cluster in place, or with AFTERSHOCK_SUMMARY_INTERVAL
+// posts a new one in the mainshock's thread so the room is notified of each update
+func postClusterSummary(ctx context.Context, c *aftershockCluster) {
+	mainshock := c.Mainshock
+	msg, formatted := formatClusterMsg(c, mainshock)
+	if aftershockSummaryInterval > 0 {
+		c.SummaryEventID = ""
+	}
+	var eventID string
+	var err error
+	if c.SummaryEventID != "" {
+		eventID, err = editMatrixMessage(ctx, matrixRoomID, c.SummaryEventID, msg, formatted)
+	} else {
+		eventID, err = sendMatrixMessage(ctx, matrixRoomID, msg, formatted, threadRootID(mainshock))
+		c.SummaryEventID = eventID
+	}
+	if err != nil {
+		log.Printf("Matrix post failed: %v", err)
+		return
+	}
+	c.SummarizedAt = time.Now()
+	c.SummarizedCount = c.Count
+}
+
+// formatClusterMsg formats the aftershock summary, e.g. "Aftershock update: 5 events near Davao
+// since the M6.1, largest M4.2 at 14:32"
+func formatClusterMsg(c *aftershockCluster, mainshock PostedQuake) (string, string) {
+	noun := "events"
+	if c.Count == 1 {
+		noun = "event"
+	}
+	largestAt := ""
+	if !c.MaxAt.IsZero() {
+		largestAt = " at " + c.MaxAt.In(manilaLoc).Format("15:04")
+	}
+	msg := fmt.Sprintf("🔂 Aftershock update: %d %s near %s since the M%.1f, largest M%.1f%s\nFollowing the M%.1f quake of %s\nLatest: %s",
+		c.Count, noun, c.Origin, mainshock.MagnitudeValue, parseMag(c.MaxMagnitude), largestAt,
+		mainshock.MagnitudeValue, mainshock.DateTime, c.LastAt.Format(DATE_TIME_LAYOUT))
+	formatted := fmt.Sprintf("🔂 <b>Aftershock update: %d %s near %s</b> since the M%.1f, largest M%.1f%s<br>Following the M%.1f quake of %s<br>Latest: %s",
+		c.Count, noun, c.Origin, mainshock.MagnitudeValue, parseMag(c.MaxMagnitude), largestAt,
+		mainshock.MagnitudeValue, mainshock.DateTime, c.LastAt.Format(DATE_TIME_LAYOUT))
+	return msg, formatted
+}
+
+func readAftershockClusters(fileName string) map[string]*aftershockCluster {
+	clusters := map[string]*aftershockCluster{}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return clusters
+	}
+	if err := json.Unmarshal(data, &clusters); err != nil {
+		log.Printf("⚠️ Failed to parse cluster state %s: %v", fileName, err)
+		return map[string]*aftershockCluster{}
+	}
+	for _, c := range clusters {
+		c.Mainshock = withDerivedPostedFields(c.Mainshock)
+	}
+	return clusters
+}
+
+// saveAftershockClusters drops clusters that went quiet for longer than CLUSTER_WINDOW and saves the rest
+func saveAftershockClusters(clusters map[string]*aftershockCluster, fileName string) {
+	for key, c := range clusters {
+		if time.Since(c.LastAt) > clusterWindow {
+			delete(clusters, key)
+		}
+	}
+	data, _ := json.MarshalIndent(clusters, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+	}
+}
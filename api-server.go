@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// startHTTPServers serves the RSS feed on API_LISTEN_ADDR and the health/status/metrics endpoints on
+// STATUS_LISTEN_ADDR, sharing one server when both addresses are the same. Unset addresses are skipped.
+func startHTTPServers() []*http.Server {
+	routes := map[string]map[string]http.HandlerFunc{}
+	addRoute := func(addr, path string, h http.HandlerFunc) {
+		if addr == "" {
+			return
+		}
+		if routes[addr] == nil {
+			routes[addr] = map[string]http.HandlerFunc{}
+		}
+		routes[addr][path] = h
+	}
+	addRoute(apiListenAddr, "/rss", handleRSS)
+	addRoute(statusListenAddr, "/healthz", handleHealthz)
+	addRoute(statusListenAddr, "/status", handleStatus)
+	addRoute(statusListenAddr, "/metrics", handleMetrics)
+
+	var servers []*http.Server
+	for addr, handlers := range routes {
+		servers = append(servers, startAPIServer(addr, handlers))
+	}
+	return servers
+}
+
+// startAPIServer serves the given endpoints on addr in the background
+func startAPIServer(addr string, handlers map[string]http.HandlerFunc) *http.Server {
+	mux := http.NewServeMux()
+	for path, h := range handlers {
+		mux.HandleFunc(path, h)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("🌐 API server listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("❌ API server error: %v", err)
+		}
+	}()
+	return srv
+}
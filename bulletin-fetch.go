@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// bulletinDetails are the fields scraped from a bulletin page, cached by bulletin URL
+type bulletinDetails struct {
+	MagType              string    `json:"mag_type,omitempty"`
+	ExpectingDamage      string    `json:"expecting_damage,omitempty"`
+	ExpectingAftershocks string    `json:"expecting_aftershocks,omitempty"`
+	MentionsTsunami      bool      `json:"mentions_tsunami,omitempty"`
+	FeltReports          int       `json:"felt_reports,omitempty"`
+	MaxIntensity         string    `json:"max_intensity,omitempty"`
+	FetchedAt            time.Time `json:"fetched_at"`
+}
+
+// bulletinCache keeps fetched bulletin details in memory and on disk so each page is fetched at most once
+type bulletinCache struct {
+	mu      sync.Mutex
+	entries map[string]bulletinDetails
+	dirty   bool
+}
+
+var bulletins = &bulletinCache{entries: map[string]bulletinDetails{}}
+
+func readBulletinCache(fileName string) *bulletinCache {
+	c := &bulletinCache{entries: map[string]bulletinDetails{}}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		log.Printf("⚠️ Failed to parse bulletin cache %s: %v", fileName, err)
+		c.entries = map[string]bulletinDetails{}
+	}
+	return c
+}
+
+func (c *bulletinCache) get(url string) (bulletinDetails, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.entries[url]
+	return d, ok
+}
+
+func (c *bulletinCache) put(url string, d bulletinDetails) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[url] = d
+	c.dirty = true
+}
+
+// save writes the cache to disk if it changed, dropping entries older than 2 months
+func (c *bulletinCache) save(fileName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return
+	}
+	cutoff := time.Now().AddDate(0, -2, 0)
+	for url, d := range c.entries {
+		if d.FetchedAt.Before(cutoff) {
+			delete(c.entries, url)
+		}
+	}
+	data, _ := json.MarshalIndent(c.entries, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+		return
+	}
+	c.dirty = false
+}
+
+// enrichWithBulletins fetches the bulletin pages of quakes[i] for each index concurrently, using at most
+// BULLETIN_FETCH_CONCURRENCY workers and starting one fetch per BULLETIN_FETCH_INTERVAL_MS at most.
+// Results are written back to the same slice elements; a failed fetch leaves its quake untouched.
+func enrichWithBulletins(ctx context.Context, quakes []Quake, indices []int) {
+	if len(indices) == 0 {
+		return
+	}
+
+	jobs := make(chan int)
+	limiter := time.NewTicker(time.Duration(bulletinFetchIntervalMs) * time.Millisecond)
+	defer limiter.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < bulletinFetchConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// each worker only touches its own element, so no locking is needed
+				enrichWithBulletin(ctx, &quakes[i], limiter.C)
+			}
+		}()
+	}
+	for _, i := range indices {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	bulletins.save(statePath(BULLETIN_CACHE_FILE))
+}
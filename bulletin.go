@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// e.g. "Expecting Damage: NO", label and value usually sit in separate table cells
+	expectingDamageRe     = regexp.MustCompile(`(?i)Expecting\s+Damage\s*:?\s*(YES|NO)\b`)
+	expectingAftershockRe = regexp.MustCompile(`(?i)Expecting\s+Aftershocks?\s*:?\s*(YES|NO)\b`)
+	// e.g. "Magnitude: Mw 7.1" or "Magnitude = Ms 6.9"
+	magTypeRe = regexp.MustCompile(`(?i)Magnitude\s*[:=]?\s*(M[a-z]{1,3})\s*\d`)
+	// e.g. "Reported Intensities: Intensity V - Cebu City; Intensity IV - Mandaue City, Talisay City",
+	// the section ends at the next heading of the bulletin
+	reportedIntensitiesRe = regexp.MustCompile(`(?i)Reported\s+Intensit(?:y|ies)\s*:?\s*(.*?)\s*(?:Instrumental\s+Intensit|Expecting\s+Damage|Expecting\s+Aftershock|Issued\s+On|Prepared\s+By|$)`)
+	intensityLabelRe      = regexp.MustCompile(`(?i)\bIntensity\s+([IVX]+)\b\s*[-–:]?`)
+)
+
+// canonical spelling of the magnitude scales PHIVOLCS uses
+var magTypeNames = map[string]string{"ms": "Ms", "mb": "Mb", "mw": "Mw", "ml": "ML"}
+
+// PHIVOLCS Earthquake Intensity Scale levels, for comparing reported intensities
+var intensityLevels = map[string]int{"I": 1, "II": 2, "III": 3, "IV": 4, "V": 5, "VI": 6, "VII": 7, "VIII": 8, "IX": 9, "X": 10}
+
+// enrichWithBulletin fills in the bulletin-only fields of the quake from the bulletin cache, or
+// fetches the bulletin page once a tick arrives from limiter. Failures are logged and leave the fields untouched.
+func enrichWithBulletin(ctx context.Context, q *Quake, limiter <-chan time.Time) {
+	if q.Bulletin == "" {
+		return
+	}
+	if d, ok := bulletins.get(q.Bulletin); ok {
+		applyBulletinDetails(q, d)
+		return
+	}
+
+	select {
+	case <-limiter:
+	case <-ctx.Done():
+		return
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	doc, err := fetchDocument(fetchCtx, q.Bulletin)
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch bulletin %s: %v", q.Bulletin, err)
+		return
+	}
+	parseBulletinDetails(doc, q)
+	bulletins.put(q.Bulletin, bulletinDetails{
+		MagType:              q.MagType,
+		ExpectingDamage:      q.ExpectingDamage,
+		ExpectingAftershocks: q.ExpectingAftershocks,
+		MentionsTsunami:      q.MentionsTsunami,
+		FeltReports:          q.FeltReports,
+		MaxIntensity:         q.MaxIntensity,
+		FetchedAt:            time.Now(),
+	})
+}
+
+// applyBulletinDetails copies cached bulletin details onto a quake
+func applyBulletinDetails(q *Quake, d bulletinDetails) {
+	q.MagType = d.MagType
+	q.ExpectingDamage = d.ExpectingDamage
+	q.ExpectingAftershocks = d.ExpectingAftershocks
+	q.MentionsTsunami = d.MentionsTsunami
+	q.FeltReports = d.FeltReports
+	q.MaxIntensity = d.MaxIntensity
+}
+
+// parseBulletinDetails scrapes the magnitude scale and the "Expecting Damage" and "Expecting Aftershocks"
+// flags from a bulletin page, and whether it mentions a tsunami at all
+func parseBulletinDetails(doc *goquery.Document, q *Quake) {
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	if m := expectingDamageRe.FindStringSubmatch(text); m != nil {
+		q.ExpectingDamage = strings.ToUpper(m[1])
+	}
+	if m := expectingAftershockRe.FindStringSubmatch(text); m != nil {
+		q.ExpectingAftershocks = strings.ToUpper(m[1])
+	}
+	if m := magTypeRe.FindStringSubmatch(text); m != nil {
+		if name, ok := magTypeNames[strings.ToLower(m[1])]; ok {
+			q.MagType = name
+		} else {
+			q.MagType = m[1]
+		}
+	}
+	q.MentionsTsunami = tsunamiTextRe.MatchString(text)
+	q.FeltReports, q.MaxIntensity = parseReportedIntensities(text)
+}
+
+// parseReportedIntensities counts the locations listed under "Reported Intensities" and returns
+// them with the highest intensity among them
+func parseReportedIntensities(text string) (int, string) {
+	m := reportedIntensitiesRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0, ""
+	}
+	section := m[1]
+	labels := intensityLabelRe.FindAllStringSubmatchIndex(section, -1)
+
+	count, maxLevel, maxIntensity := 0, 0, ""
+	for i, l := range labels {
+		end := len(section)
+		if i+1 < len(labels) {
+			end = labels[i+1][0]
+		}
+		towns := 0
+		for _, town := range strings.FieldsFunc(section[l[1]:end], func(r rune) bool { return r == ',' || r == ';' }) {
+			if strings.TrimSpace(town) != "" {
+				towns++
+			}
+		}
+		if towns == 0 {
+			continue
+		}
+		count += towns
+		intensity := strings.ToUpper(section[l[2]:l[3]])
+		if level := intensityLevels[intensity]; level > maxLevel {
+			maxLevel, maxIntensity = level, intensity
+		}
+	}
+	return count, maxIntensity
+}
+
+// copyBulletinDetails carries over bulletin-only fields from a previous fetch of the same bulletin
+func copyBulletinDetails(dst *Quake, src Quake) {
+	dst.MagType = src.MagType
+	dst.ExpectingDamage = src.ExpectingDamage
+	dst.ExpectingAftershocks = src.ExpectingAftershocks
+	dst.MentionsTsunami = src.MentionsTsunami
+	dst.FeltReports = src.FeltReports
+	dst.MaxIntensity = src.MaxIntensity
+}
+
+// bulletinFieldChanged reports a change only when both values are known,
+// so quakes cached before their bulletin was scraped don't count as revised
+func bulletinFieldChanged(a, b string) bool {
+	return a != "" && b != "" && a != b
+}
+
+// formatMagnitude formats the magnitude with its scale when known, e.g. "Mw 7.1" or "7.1"
+func formatMagnitude(q Quake) string {
+	if q.MagType == "" {
+		return fmt.Sprintf("%.1f", q.MagnitudeValue)
+	}
+	return fmt.Sprintf("%s %.1f", q.MagType, q.MagnitudeValue)
+}
+
+// formatFeltReports formats the felt reports line of an update, only when the bulletin revision
+// lists more locations than the previous one, e.g. "Felt reports: 3 → 8 locations (max Intensity V)"
+func formatFeltReports(oldQuake, q Quake) (string, string) {
+	if oldQuake.FeltReports == 0 || q.FeltReports <= oldQuake.FeltReports {
+		return "", ""
+	}
+	maxPart := ""
+	if q.MaxIntensity != "" {
+		maxPart = fmt.Sprintf(" (max Intensity %s)", q.MaxIntensity)
+	}
+	plain := fmt.Sprintf("Felt reports: %d → %d locations%s\n", oldQuake.FeltReports, q.FeltReports, maxPart)
+	html := fmt.Sprintf("🙋 <b>Felt reports:</b> %d → <b>%d</b> locations%s<br>", oldQuake.FeltReports, q.FeltReports, maxPart)
+	return plain, html
+}
+
+// Format the expecting damage/aftershocks lines for the Matrix message,
+// returns empty strings when the bulletin flags are unknown
+func formatBulletinFlags(updated bool, oldQuake, q Quake) (string, string) {
+	var plain, html string
+
+	if q.ExpectingDamage != "" {
+		value := q.ExpectingDamage
+		if updated && bulletinFieldChanged(oldQuake.ExpectingDamage, q.ExpectingDamage) {
+			value = fmt.Sprintf("%s → %s", oldQuake.ExpectingDamage, q.ExpectingDamage)
+		}
+		plain += fmt.Sprintf("Expecting Damage: %s\n", value)
+		if q.ExpectingDamage == "YES" {
+			html += fmt.Sprintf("<font color=\"red\"><b>🏚️ Damage expected</b></font> (%s)<br>", value)
+		} else {
+			html += fmt.Sprintf("🏠 <b>Expecting Damage:</b> %s<br>", value)
+		}
+	}
+
+	if q.ExpectingAftershocks != "" {
+		value := q.ExpectingAftershocks
+		if updated && bulletinFieldChanged(oldQuake.ExpectingAftershocks, q.ExpectingAftershocks) {
+			value = fmt.Sprintf("%s → %s", oldQuake.ExpectingAftershocks, q.ExpectingAftershocks)
+		}
+		plain += fmt.Sprintf("Expecting Aftershocks: %s\n", value)
+		if q.ExpectingAftershocks == "YES" {
+			html += fmt.Sprintf("<b>🔁 Aftershocks expected</b> (%s)<br>", value)
+		} else {
+			html += fmt.Sprintf("🔁 <b>Expecting Aftershocks:</b> %s<br>", value)
+		}
+	}
+
+	return plain, html
+}
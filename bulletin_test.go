@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseBulletinDetails(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		magType     string
+		damage      string
+		aftershocks string
+		felt        int
+		maxIntens   string
+	}{
+		{"testdata/bulletin-damage-yes.html", "Mw", "YES", "YES", 4, "VI"},
+		{"testdata/bulletin-damage-no.html", "ML", "NO", "NO", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var q Quake
+			parseBulletinDetails(loadTestPage(t, tt.fixture), &q)
+			if q.MagType != tt.magType || q.ExpectingDamage != tt.damage || q.ExpectingAftershocks != tt.aftershocks {
+				t.Errorf("parsed %s, damage %q, aftershocks %q, want %s, %q, %q",
+					q.MagType, q.ExpectingDamage, q.ExpectingAftershocks, tt.magType, tt.damage, tt.aftershocks)
+			}
+			if q.FeltReports != tt.felt || q.MaxIntensity != tt.maxIntens {
+				t.Errorf("felt reports %d (max %q), want %d (max %q)", q.FeltReports, q.MaxIntensity, tt.felt, tt.maxIntens)
+			}
+		})
+	}
+}
+
+func TestFormatBulletinFlags(t *testing.T) {
+	q := Quake{ExpectingDamage: "YES", ExpectingAftershocks: "NO"}
+	plain, html := formatBulletinFlags(false, Quake{}, q)
+	if want := "Expecting Damage: YES\nExpecting Aftershocks: NO\n"; plain != want {
+		t.Errorf("plain = %q, want %q", plain, want)
+	}
+	if want := "<font color=\"red\"><b>🏚️ Damage expected</b></font> (YES)<br>🔁 <b>Expecting Aftershocks:</b> NO<br>"; html != want {
+		t.Errorf("html = %q, want %q", html, want)
+	}
+
+	// a revision flipping a flag shows both values
+	old := Quake{ExpectingDamage: "NO", ExpectingAftershocks: "NO"}
+	if plain, _ := formatBulletinFlags(true, old, q); plain != "Expecting Damage: NO → YES\nExpecting Aftershocks: NO\n" {
+		t.Errorf("update plain = %q", plain)
+	}
+	if plain, html := formatBulletinFlags(false, Quake{}, Quake{}); plain != "" || html != "" {
+		t.Errorf("unknown flags formatted as %q, %q", plain, html)
+	}
+}
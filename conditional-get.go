@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+)
+
+// ErrNotModified is returned when PHIVOLCS answers a conditional GET with 304 Not Modified
+var ErrNotModified = errors.New("page not modified")
+
+// pageValidators are the cache validators of the last successfully parsed front page
+type pageValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Add If-None-Match/If-Modified-Since headers from the previous fetch
+func (v *pageValidators) apply(req *http.Request) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// Record the validators of a successful response
+func (v *pageValidators) update(resp *http.Response) {
+	v.ETag = resp.Header.Get("ETag")
+	v.LastModified = resp.Header.Get("Last-Modified")
+}
+
+func readPageValidators(fileName string) pageValidators {
+	var v pageValidators
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return v
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		log.Printf("⚠️ Failed to parse fetch state file (%s), ignoring: %v", fileName, err)
+		return pageValidators{}
+	}
+	return v
+}
+
+func savePageValidators(v pageValidators, fileName string) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+	}
+}
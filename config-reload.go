@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SIGHUPs waiting to be handled between poll cycles
+var reloadRequests = make(chan os.Signal, 1)
+
+// reloadableSetting is a configuration variable that can change without a restart
+type reloadableSetting struct {
+	env  string
+	flag string
+	// current value, formatted so set(get()) restores it exactly
+	get func() string
+	set func(string) error
+	// hide the values in the reload log
+	secret bool
+}
+
+func floatSetting(env, flagName string, v *float64) reloadableSetting {
+	return reloadableSetting{
+		env:  env,
+		flag: flagName,
+		get:  func() string { return strconv.FormatFloat(*v, 'g', -1, 64) },
+		set: func(s string) error {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return err
+			}
+			*v = f
+			return nil
+		},
+	}
+}
+
+func durationSetting(env, flagName string, v *time.Duration) reloadableSetting {
+	return reloadableSetting{
+		env:  env,
+		flag: flagName,
+		get:  func() string { return v.String() },
+		set: func(s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			*v = d
+			return nil
+		},
+	}
+}
+
+func stringSetting(env, flagName string, v *string, secret bool) reloadableSetting {
+	return reloadableSetting{
+		env:    env,
+		flag:   flagName,
+		get:    func() string { return *v },
+		set:    func(s string) error { *v = s; return nil },
+		secret: secret,
+	}
+}
+
+// settings re-read from ENV_FILE on SIGHUP, everything else needs a restart
+func reloadableSettings() []reloadableSetting {
+	return []reloadableSetting{
+		floatSetting("REF_POINT_LAT", "ref-lat", &refPointLat),
+		floatSetting("REF_POINT_LON", "ref-lon", &refPointLon),
+		floatSetting("REF_RADIUS_KM", "ref-radius", &refRadiusKm),
+		floatSetting("LOCAL_MAG_THRESH", "local-mag", &localMagThresh),
+		floatSetting("OFFSHORE_MAG_OFFSET", "", &offshoreMagOffset),
+		floatSetting("DISTANCE_DISPLAY_RADIUS_KM", "", &distanceDisplayRadiusKm),
+		floatSetting("GLOBAL_MAG_THRESH", "global-mag", &globalMagThresh),
+		floatSetting("FALLOFF_EXPONENT", "", &falloffExponent),
+		floatSetting("TSUNAMI_CHECK_MAGNITUDE", "", &tsunamiCheckMagnitude),
+		floatSetting("AFTERSHOCK_TRIGGER_MAG", "", &aftershockTriggerMag),
+		floatSetting("AFTERSHOCK_MAINSHOCK_MAG", "", &aftershockMainshockMag),
+		floatSetting("AFTERSHOCK_DISPLAY_MAG", "", &aftershockDisplayMag),
+		durationSetting("AFTERSHOCK_SUMMARY_INTERVAL", "", &aftershockSummaryInterval),
+		floatSetting("QUIET_OVERRIDE_MAGNITUDE", "", &quietOverrideMagnitude),
+		floatSetting("QUIET_MIN_MAG", "", &quietOverrideMagnitude),
+		floatSetting("ABSOLUTE_MIN_MAGNITUDE", "min-magnitude", &absoluteMinMagnitude),
+		floatSetting("MENTION_ROOM_MAGNITUDE", "", &mentionRoomMagnitude),
+		floatSetting("SEVERITY_MODERATE_MAG", "", &severityModerateMag),
+		floatSetting("SEVERITY_STRONG_MAG", "", &severityStrongMag),
+		floatSetting("UPDATE_MIN_MAG_DELTA", "", &updateMinMagDelta),
+		floatSetting("UPDATE_MIN_DEPTH_DELTA_KM", "", &updateMinDepthDeltaKm),
+		floatSetting("UPDATE_MIN_DIST_DELTA_KM", "", &updateMinDistDeltaKm),
+		floatSetting("UPDATE_LOCATION_SIMILARITY", "", &updateLocationSimilarity),
+		durationSetting("POLL_INTERVAL", "poll-interval", &pollInterval),
+		stringSetting("QUIET_HOURS", "", &quietHours, false),
+		stringSetting("DIGEST_TIME", "", &digestTime, false),
+		stringSetting("QUIET_HOURS_START", "", &quietHoursStart, false),
+		stringSetting("QUIET_HOURS_END", "", &quietHoursEnd, false),
+		stringSetting("DEPTH_RULES", "", &depthRules, false),
+		stringSetting("ORIGIN_INCLUDE", "", &originInclude, false),
+		stringSetting("ORIGIN_EXCLUDE", "", &originExclude, false),
+		stringSetting("PROVINCES_FILTER", "", &provincesFilter, false),
+		stringSetting("MIN_REPORTED_INTENSITY", "", &minReportedIntensity, false),
+		stringSetting("MESSAGE_LANG", "", &messageLang, false),
+		stringSetting("UPDATE_MODE", "", &updateMode, false),
+		stringSetting("NOTIFIERS", "notifiers", &notifierNames, false),
+		stringSetting("MATRIX_BASE_URL", "matrix-url", &matrixBaseURL, false),
+		stringSetting("MATRIX_ROOM_ID", "matrix-room", &matrixRoomID, false),
+		stringSetting("MATRIX_ACCESS_TOKEN", "matrix-token", &accessToken, true),
+		stringSetting("TELEGRAM_BOT_TOKEN", "telegram-token", &telegramBotToken, true),
+		stringSetting("TELEGRAM_CHAT_ID", "telegram-chat", &telegramChatID, false),
+		stringSetting("DISCORD_WEBHOOK_URL", "discord-webhook", &discordWebhookURL, true),
+		stringSetting("WEBHOOK_URL", "webhook-url", &webhookURL, false),
+		stringSetting("WEBHOOK_AUTH_HEADER", "webhook-auth", &webhookAuthHeader, true),
+		stringSetting("SMTP_HOST", "", &smtpHost, false),
+		stringSetting("SMTP_PORT", "", &smtpPort, false),
+		stringSetting("SMTP_USER", "", &smtpUser, false),
+		stringSetting("SMTP_PASS", "", &smtpPass, true),
+		stringSetting("EMAIL_FROM", "", &emailFrom, false),
+		stringSetting("EMAIL_TO", "email-to", &emailTo, false),
+	}
+}
+
+// watchReloadSignal queues configuration reloads on SIGHUP, they run in sleepBeforeNextPoll
+func watchReloadSignal() {
+	signal.Notify(reloadRequests, syscall.SIGHUP)
+}
+
+// readEnvFile parses KEY=VALUE lines, skipping blank lines and # comments and
+// stripping an optional "export " prefix and surrounding quotes
+func readEnvFile(fileName string) (map[string]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vals := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		vals[strings.TrimSpace(key)] = val
+	}
+	return vals, scanner.Err()
+}
+
+// reloadConfig applies the reloadable settings found in ENV_FILE. Settings given as command-line
+// flags keep their value. The new values are checked with validateConfig and all of them are
+// rolled back if any is invalid. Returns whether anything changed.
+func reloadConfig() bool {
+	if envFile == "" {
+		log.Printf("⚠️ Received SIGHUP but ENV_FILE is not set, nothing to reload")
+		return false
+	}
+	vals, err := readEnvFile(envFile)
+	if err != nil {
+		log.Printf("❌ Failed to read ENV_FILE %s, keeping the current configuration: %v", envFile, err)
+		return false
+	}
+
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	settings := reloadableSettings()
+	reloadable := map[string]bool{}
+	old := map[string]string{}
+	var changes []string
+	var parseErrs []string
+	for _, s := range settings {
+		reloadable[s.env] = true
+		old[s.env] = s.get()
+		val, ok := vals[s.env]
+		if !ok || val == old[s.env] || (s.flag != "" && setFlags[s.flag]) {
+			continue
+		}
+		if s.env == "UPDATE_MODE" {
+			val = strings.ToLower(val)
+		}
+		if err := s.set(val); err != nil {
+			parseErrs = append(parseErrs, fmt.Sprintf("%s %q: %v", s.env, val, err))
+			continue
+		}
+		if s.get() == old[s.env] {
+			continue
+		}
+		if s.secret {
+			changes = append(changes, s.env+" changed")
+		} else {
+			changes = append(changes, fmt.Sprintf("%s: %s → %s", s.env, displayValue(old[s.env]), displayValue(s.get())))
+		}
+	}
+	for key, val := range vals {
+		if !reloadable[key] && val != os.Getenv(key) {
+			log.Printf("⚠️ %s changed in ENV_FILE but only takes effect after a restart", key)
+		}
+	}
+
+	if err := validateConfig(); err != nil {
+		parseErrs = append(parseErrs, err.Error())
+	}
+	if len(parseErrs) > 0 {
+		for _, s := range settings {
+			_ = s.set(old[s.env])
+		}
+		log.Printf("❌ Rejected configuration reload, keeping the current values:\n%s", strings.Join(parseErrs, "\n"))
+		return false
+	}
+	if len(changes) == 0 {
+		log.Printf("🔄 Configuration reloaded, nothing changed")
+		return false
+	}
+
+	log.Printf("🔄 Configuration reloaded:\n  %s", strings.Join(changes, "\n  "))
+	metricLocalThresh.set(localMagThresh)
+	metricGlobalThresh.set(globalMagThresh)
+	notifiers = allNotifiers()
+	if old["MATRIX_BASE_URL"] != matrixBaseURL || old["MATRIX_ACCESS_TOKEN"] != accessToken || old["NOTIFIERS"] != notifierNames {
+		if err := validateMatrixCredentials(); err != nil {
+			log.Printf("⚠️ Matrix credentials could not be validated: %v", err)
+			status.setMatrixValidated(false)
+		} else {
+			status.setMatrixValidated(true)
+		}
+	}
+	return true
+}
+
+// displayValue shows empty values explicitly in the reload diff
+func displayValue(s string) string {
+	if s == "" {
+		return "(unset)"
+	}
+	return s
+}
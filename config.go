@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// postsAlerts reports whether the process posts to the notifiers, which then need their credentials.
+// Dry runs and the one-off replay, export and backfill modes never post.
+func postsAlerts() bool {
+	return !dryRun && replayFile == "" && exportCSVPath == "" && exportArchiveFormat == "" && backfillMonths == ""
+}
+
+// validateConfig checks the configuration once at startup so misconfiguration
+// fails fast instead of surfacing hours later on the first matching quake
+func validateConfig() error {
+	var errs []error
+
+	names := parseNotifierNames(notifierNames)
+	if len(names) == 0 {
+		errs = append(errs, errors.New("NOTIFIERS lists no notifiers"))
+	}
+	for _, name := range names {
+		switch name {
+		case NOTIFIER_MATRIX, NOTIFIER_TELEGRAM, NOTIFIER_DISCORD, NOTIFIER_WEBHOOK, NOTIFIER_EMAIL:
+		default:
+			errs = append(errs, fmt.Errorf("NOTIFIERS %q is unknown (expected %s, %s, %s, %s or %s)",
+				name, NOTIFIER_MATRIX, NOTIFIER_TELEGRAM, NOTIFIER_DISCORD, NOTIFIER_WEBHOOK, NOTIFIER_EMAIL))
+		}
+	}
+
+	if configFile != "" {
+		errs = append(errs, destinationCredentialErrors()...)
+	} else if postsAlerts() && notifierEnabled(NOTIFIER_MATRIX) {
+		if matrixBaseURL == "" {
+			errs = append(errs, errors.New("MATRIX_BASE_URL is not set"))
+		}
+		if matrixRoomID == "" {
+			errs = append(errs, errors.New("MATRIX_ROOM_ID is not set"))
+		}
+		if accessToken == "" {
+			errs = append(errs, errors.New("MATRIX_ACCESS_TOKEN is not set"))
+		}
+	}
+	if postsAlerts() && configFile == "" && notifierEnabled(NOTIFIER_TELEGRAM) {
+		if telegramBotToken == "" {
+			errs = append(errs, errors.New("TELEGRAM_BOT_TOKEN is not set"))
+		}
+		if telegramChatID == "" {
+			errs = append(errs, errors.New("TELEGRAM_CHAT_ID is not set"))
+		}
+	}
+	if postsAlerts() && configFile == "" && notifierEnabled(NOTIFIER_DISCORD) && discordWebhookURL == "" {
+		errs = append(errs, errors.New("DISCORD_WEBHOOK_URL is not set"))
+	}
+	if postsAlerts() && configFile == "" && notifierEnabled(NOTIFIER_WEBHOOK) && webhookURL == "" {
+		errs = append(errs, errors.New("WEBHOOK_URL is not set"))
+	}
+	if postsAlerts() && configFile == "" && notifierEnabled(NOTIFIER_EMAIL) {
+		if smtpHost == "" {
+			errs = append(errs, errors.New("SMTP_HOST is not set"))
+		}
+		if emailFrom == "" {
+			errs = append(errs, errors.New("EMAIL_FROM is not set"))
+		}
+		if len(parseEmailList(emailTo)) == 0 {
+			errs = append(errs, errors.New("EMAIL_TO is not set"))
+		}
+	}
+
+	if refPointLat < -90 || refPointLat > 90 {
+		errs = append(errs, fmt.Errorf("REF_POINT_LAT %.4f is outside -90..90", refPointLat))
+	}
+	if refPointLon < -180 || refPointLon > 180 {
+		errs = append(errs, fmt.Errorf("REF_POINT_LON %.4f is outside -180..180", refPointLon))
+	}
+	if refRadiusKm <= 0 {
+		errs = append(errs, fmt.Errorf("REF_RADIUS_KM %.2f must be positive", refRadiusKm))
+	}
+	if _, ok := parseIntensity(minReportedIntensity); minReportedIntensity != "" && !ok {
+		errs = append(errs, fmt.Errorf("MIN_REPORTED_INTENSITY %q is not a PEIS level (I to X)", minReportedIntensity))
+	}
+	if _, err := parseMessageLangs(messageLang); err != nil {
+		errs = append(errs, err)
+	}
+	if distanceDisplayRadiusKm < 0 {
+		errs = append(errs, fmt.Errorf("DISTANCE_DISPLAY_RADIUS_KM %.2f must not be negative", distanceDisplayRadiusKm))
+	}
+	if offshoreMagOffset != 0 && offshoreLandFile == "" {
+		errs = append(errs, errors.New("OFFSHORE_MAG_OFFSET needs OFFSHORE_LAND_FILE to tell offshore quakes"))
+	}
+	if maxQuakeEntries <= 0 {
+		errs = append(errs, fmt.Errorf("PARSE_LIMIT %d must be positive", maxQuakeEntries))
+	}
+	if pollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("POLL_INTERVAL %s must be positive", pollInterval))
+	}
+	if errorRetryInterval <= 0 {
+		errs = append(errs, fmt.Errorf("ERROR_RETRY_INTERVAL %s must be positive", errorRetryInterval))
+	}
+	if attachMapImages && strings.Contains(mapImageURLTemplate, "{key}") && mapImageAPIKey == "" {
+		errs = append(errs, errors.New("MAP_IMAGE_API_KEY is not set but MAP_IMAGE_URL needs one"))
+	}
+	for env, spec := range map[string]string{"ORIGIN_INCLUDE": originInclude, "ORIGIN_EXCLUDE": originExclude} {
+		if _, err := parseOriginPatterns(env, spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if depthRules != "" {
+		if _, err := parseDepthRules(depthRules); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for env, v := range map[string]float64{
+		"UPDATE_MIN_MAG_DELTA":      updateMinMagDelta,
+		"UPDATE_MIN_DEPTH_DELTA_KM": updateMinDepthDeltaKm,
+		"UPDATE_MIN_DIST_DELTA_KM":  updateMinDistDeltaKm,
+	} {
+		if v < 0 {
+			errs = append(errs, fmt.Errorf("%s %g must not be negative", env, v))
+		}
+	}
+	if updateLocationSimilarity < 0 || updateLocationSimilarity > 100 {
+		errs = append(errs, fmt.Errorf("UPDATE_LOCATION_SIMILARITY %g must be between 0 and 100", updateLocationSimilarity))
+	}
+	if severityModerateMag >= severityStrongMag {
+		errs = append(errs, fmt.Errorf("SEVERITY_MODERATE_MAG %.1f must be below SEVERITY_STRONG_MAG %.1f", severityModerateMag, severityStrongMag))
+	}
+	if importFrom != "" {
+		if _, err := parseImportFrom(importFrom); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if fetchFailureThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("FETCH_FAILURE_THRESHOLD %d must be positive", fetchFailureThreshold))
+	}
+	if degradedPollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("DEGRADED_POLL_INTERVAL %s must be positive", degradedPollInterval))
+	}
+	if localMagThresh > globalMagThresh {
+		errs = append(errs, fmt.Errorf("LOCAL_MAG_THRESH %.1f is above GLOBAL_MAG_THRESH %.1f", localMagThresh, globalMagThresh))
+	}
+	if localMagThresh < 0 || localMagThresh > 10 {
+		errs = append(errs, fmt.Errorf("LOCAL_MAG_THRESH %.1f is outside 0..10", localMagThresh))
+	}
+	if globalMagThresh < 0 || globalMagThresh > 10 {
+		errs = append(errs, fmt.Errorf("GLOBAL_MAG_THRESH %.1f is outside 0..10", globalMagThresh))
+	}
+	// 0 leaves the floor and the @room mention off
+	for env, v := range map[string]float64{
+		"ABSOLUTE_MIN_MAGNITUDE": absoluteMinMagnitude,
+		"MENTION_ROOM_MAGNITUDE": mentionRoomMagnitude,
+	} {
+		if v < 0 || v > 10 {
+			errs = append(errs, fmt.Errorf("%s %.1f is outside 0..10", env, v))
+		}
+	}
+	if tsunamiCheckMagnitude <= 0 || tsunamiCheckMagnitude > 10 {
+		errs = append(errs, fmt.Errorf("TSUNAMI_CHECK_MAGNITUDE %.1f must be above 0 and at most 10", tsunamiCheckMagnitude))
+	}
+	if offshoreMagOffset < 0 {
+		errs = append(errs, fmt.Errorf("OFFSHORE_MAG_OFFSET %.1f must not be negative", offshoreMagOffset))
+	}
+	if falloffExponent <= 0 {
+		errs = append(errs, fmt.Errorf("FALLOFF_EXPONENT %.2f must be positive", falloffExponent))
+	}
+	if usgsMatchKm <= 0 {
+		errs = append(errs, fmt.Errorf("USGS_MATCH_KM %.2f must be positive", usgsMatchKm))
+	}
+	if aftershockMainshockMag > 0 && aftershockDisplayMag >= aftershockMainshockMag {
+		errs = append(errs, fmt.Errorf("AFTERSHOCK_DISPLAY_MAG %.1f must be below AFTERSHOCK_MAINSHOCK_MAG %.1f", aftershockDisplayMag, aftershockMainshockMag))
+	}
+	if aftershockSummaryInterval < 0 {
+		errs = append(errs, fmt.Errorf("AFTERSHOCK_SUMMARY_INTERVAL %s must not be negative", aftershockSummaryInterval))
+	}
+	if clusterRadiusKm <= 0 {
+		errs = append(errs, fmt.Errorf("CLUSTER_RADIUS_KM %.2f must be positive", clusterRadiusKm))
+	}
+
+	if (quietHoursStart == "") != (quietHoursEnd == "") {
+		errs = append(errs, errors.New("QUIET_HOURS_START and QUIET_HOURS_END must be set together"))
+	}
+	if quietHours != "" && quietHoursStart != "" {
+		errs = append(errs, errors.New("QUIET_HOURS can't be combined with QUIET_HOURS_START and QUIET_HOURS_END"))
+	}
+	start, end, err := quietWindow()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, v := range []string{start, end} {
+		if v == "" {
+			continue
+		}
+		if _, err := parseClock(v); err != nil {
+			errs = append(errs, fmt.Errorf("quiet hours: %w", err))
+		}
+	}
+
+	if digestTime != "" {
+		if _, err := parseClock(digestTime); err != nil {
+			errs = append(errs, fmt.Errorf("DIGEST_TIME: %w", err))
+		}
+	}
+
+	if updateMode != UPDATE_MODE_REPLY && updateMode != UPDATE_MODE_EDIT {
+		errs = append(errs, fmt.Errorf("UPDATE_MODE %q must be %q or %q", updateMode, UPDATE_MODE_REPLY, UPDATE_MODE_EDIT))
+	}
+
+	return errors.Join(errs...)
+}
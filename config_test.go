@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useMatrixConfig sets the Matrix variables for the duration of a test
+func useMatrixConfig(t *testing.T, baseURL, roomID, token string) {
+	t.Helper()
+	savedURL, savedRoom, savedToken, savedNames := matrixBaseURL, matrixRoomID, accessToken, notifierNames
+	matrixBaseURL, matrixRoomID, accessToken, notifierNames = baseURL, roomID, token, NOTIFIER_MATRIX
+	t.Cleanup(func() {
+		matrixBaseURL, matrixRoomID, accessToken, notifierNames = savedURL, savedRoom, savedToken, savedNames
+	})
+}
+
+func TestValidateConfigMatrixCredentials(t *testing.T) {
+	useMatrixConfig(t, "", "", "")
+	err := validateConfig()
+	if err == nil {
+		t.Fatal("validateConfig accepted missing Matrix credentials")
+	}
+	for _, name := range []string{"MATRIX_BASE_URL", "MATRIX_ROOM_ID", "MATRIX_ACCESS_TOKEN"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not name %s: %v", name, err)
+		}
+	}
+
+	useMatrixConfig(t, "https://matrix.example.org", "!room:example.org", "token")
+	if err := validateConfig(); err != nil {
+		t.Errorf("validateConfig = %v for a complete configuration", err)
+	}
+}
+
+func TestValidateConfigSkipsCredentialsWhenNotPosting(t *testing.T) {
+	useMatrixConfig(t, "", "", "")
+	for name, mode := range map[string]*string{"REPLAY_FILE": &replayFile, "EXPORT_CSV": &exportCSVPath} {
+		saved := *mode
+		*mode = "x"
+		if err := validateConfig(); err != nil {
+			t.Errorf("%s: validateConfig = %v, the mode never posts", name, err)
+		}
+		*mode = saved
+	}
+	savedDryRun := dryRun
+	dryRun = true
+	defer func() { dryRun = savedDryRun }()
+	if err := validateConfig(); err != nil {
+		t.Errorf("DRY_RUN: validateConfig = %v", err)
+	}
+}
+
+func TestValidateConfigRanges(t *testing.T) {
+	useMatrixConfig(t, "https://matrix.example.org", "!room:example.org", "token")
+	savedLat, savedLon, savedRadius := refPointLat, refPointLon, refRadiusKm
+	t.Cleanup(func() { refPointLat, refPointLon, refRadiusKm = savedLat, savedLon, savedRadius })
+	refPointLat, refPointLon, refRadiusKm = 91, -181, 0
+	err := validateConfig()
+	if err == nil {
+		t.Fatal("validateConfig accepted out of range values")
+	}
+	for _, name := range []string{"REF_POINT_LAT", "REF_POINT_LON", "REF_RADIUS_KM"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not name %s: %v", name, err)
+		}
+	}
+}
+
+func TestValidateConfigMagnitudeRanges(t *testing.T) {
+	useMatrixConfig(t, "https://matrix.example.org", "!room:example.org", "token")
+	savedTsunami, savedMention, savedFloor, savedOffset := tsunamiCheckMagnitude, mentionRoomMagnitude, absoluteMinMagnitude, offshoreMagOffset
+	t.Cleanup(func() {
+		tsunamiCheckMagnitude, mentionRoomMagnitude, absoluteMinMagnitude, offshoreMagOffset = savedTsunami, savedMention, savedFloor, savedOffset
+	})
+
+	// 0 turns the @room mention and the floor off
+	tsunamiCheckMagnitude, mentionRoomMagnitude, absoluteMinMagnitude, offshoreMagOffset = 6.5, 0, 0, 0
+	if err := validateConfig(); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+
+	tsunamiCheckMagnitude, mentionRoomMagnitude, absoluteMinMagnitude, offshoreMagOffset = 0, -1, 11, -0.5
+	err := validateConfig()
+	if err == nil {
+		t.Fatal("validateConfig accepted out of range magnitudes")
+	}
+	for _, name := range []string{"TSUNAMI_CHECK_MAGNITUDE", "MENTION_ROOM_MAGNITUDE", "ABSOLUTE_MIN_MAGNITUDE", "OFFSHORE_MAG_OFFSET"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not name %s: %v", name, err)
+		}
+	}
+}
+
+// main fails on a bad configuration before it touches the state or the network
+func TestMainValidatesConfigFirst(t *testing.T) {
+	if os.Getenv("TEST_RUN_MAIN") == "1" {
+		os.Args = []string{os.Args[0]}
+		main()
+		return
+	}
+	stateDir := filepath.Join(t.TempDir(), "state")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainValidatesConfigFirst$")
+	cmd.Env = append(os.Environ(), "TEST_RUN_MAIN=1", "STATE_DIR="+stateDir, "NOTIFIERS=matrix",
+		"MATRIX_BASE_URL=", "MATRIX_ROOM_ID=", "MATRIX_ACCESS_TOKEN=", "DRY_RUN=false", "ENV_FILE=")
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("main exited with %v, want exit code 1:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "Invalid configuration") || !strings.Contains(string(out), "MATRIX_ROOM_ID") {
+		t.Errorf("main did not report the configuration error:\n%s", out)
+	}
+	if _, err := os.Stat(stateDir); !os.IsNotExist(err) {
+		t.Errorf("STATE_DIR created before the configuration was validated")
+	}
+}
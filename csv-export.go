@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// column headers of the exported CSV, in the same order as the Quake fields
+var csvExportHeader = []string{"DateTime", "Latitude", "Longitude", "Depth", "Magnitude", "Location", "Origin", "Bulletin"}
+
+// exportPostedQuakesCSV writes the posted quake history as CSV to the given path.
+// A path of "-" writes to stdout.
+func exportPostedQuakesCSV(path string) error {
+	// newest first
+	quakes := quakesOfPosted(stateStore.LoadPosted())
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create CSV file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := writeQuakesCSV(out, quakes); err != nil {
+		return err
+	}
+
+	if path != "-" {
+		log.Printf("📄 Exported %d posted quakes to %s", len(quakes), path)
+	}
+	return nil
+}
+
+// writeQuakesCSV writes the header row followed by one row per quake
+func writeQuakesCSV(out io.Writer, quakes []Quake) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(csvExportHeader); err != nil {
+		return fmt.Errorf("csv write error: %w", err)
+	}
+	for _, q := range quakes {
+		if err := w.Write(quakeCSVRow(q)); err != nil {
+			return fmt.Errorf("csv write error: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("csv flush error: %w", err)
+	}
+	return nil
+}
+
+// quakeCSVRow returns the CSV columns of a quake, matching csvExportHeader
+func quakeCSVRow(q Quake) []string {
+	return []string{q.DateTime, q.Latitude, q.Longitude, q.Depth, q.Magnitude, q.Location, q.Origin, q.Bulletin}
+}
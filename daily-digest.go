@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// largest number of provinces listed in a digest, the rest are summed up in one line so the
+// message stays well within the Matrix event size limit
+const MAX_DIGEST_ROWS = 50
+
+// digestState is the rolling 24-hour store of sub-threshold quakes for the DIGEST_TIME digest
+type digestState struct {
+	// quakes below the posting threshold by quakeOriginKey, the latest revision of each
+	Quakes map[string]Quake `json:"quakes"`
+	// when the last digest was posted, or collecting started
+	LastSent time.Time `json:"last_sent"`
+}
+
+// digest store loaded at startup, only used with DIGEST_TIME
+var digest = &digestState{Quakes: map[string]Quake{}}
+
+// record keeps the quakes of the past 24 hours that fell below the posting threshold and drops
+// those that were posted or are older
+func (d *digestState) record(latest []Quake, posted map[string]PostedQuake, now time.Time) {
+	if digestTime == "" {
+		return
+	}
+	for _, q := range latest {
+		key := quakeOriginKey(q)
+		_, wasPosted := posted[quakeLocationKey(q)]
+		_, excluded := originExcluded(q)
+		if q.Ineligible || !q.MagnitudeOK || wasPosted || excluded || q.MagnitudeValue >= thresholdFor(q) {
+			delete(d.Quakes, key)
+			continue
+		}
+		d.Quakes[key] = q
+	}
+	for key, q := range d.Quakes {
+		if now.Sub(q.OccurredAt) > 24*time.Hour {
+			delete(d.Quakes, key)
+		}
+	}
+	d.save()
+}
+
+// due reports whether the digest of the day should be posted: DIGEST_TIME passed and no digest
+// was posted since. The first run only starts collecting.
+func (d *digestState) due(now time.Time) bool {
+	if digestTime == "" {
+		return false
+	}
+	if d.LastSent.IsZero() {
+		d.LastSent = now
+		d.save()
+		return false
+	}
+	minutes, err := parseClock(digestTime)
+	if err != nil {
+		return false
+	}
+	local := now.In(manilaLoc)
+	sendAt := time.Date(local.Year(), local.Month(), local.Day(), minutes/60, minutes%60, 0, 0, manilaLoc)
+	return !now.Before(sendAt) && d.LastSent.Before(sendAt)
+}
+
+// postIfDue posts the digest to MATRIX_ROOM_ID once DIGEST_TIME passed, even when it is empty so
+// the room knows the monitor is alive
+func (d *digestState) postIfDue(ctx context.Context, now time.Time) {
+	if !d.due(now) {
+		return
+	}
+	var quakes []Quake
+	for _, q := range d.Quakes {
+		if now.Sub(q.OccurredAt) <= 24*time.Hour {
+			quakes = append(quakes, q)
+		}
+	}
+	msg, formatted := formatDigest(quakes)
+	log.Printf("📰 Posting the daily digest of %d sub-threshold quakes", len(quakes))
+	if notifierEnabled(NOTIFIER_MATRIX) {
+		if _, err := sendMatrixMessage(ctx, matrixRoomID, msg, formatted, ""); err != nil {
+			log.Printf("❌ Failed to post the daily digest: %v", err)
+			return
+		}
+	}
+	d.LastSent = now
+	d.save()
+}
+
+// digestRow sums up the quakes of one province
+type digestRow struct {
+	province  string
+	count     int
+	min, max  float64
+	strongest Quake
+}
+
+// formatDigest groups the quakes by province, most active first, as a table of counts,
+// magnitude ranges and the strongest event of each
+func formatDigest(quakes []Quake) (string, string) {
+	title := "📰 Daily digest: no quakes below the alert threshold in the past 24 hours"
+	if len(quakes) > 0 {
+		title = fmt.Sprintf("📰 Daily digest: %d quakes below the alert threshold in the past 24 hours", len(quakes))
+	}
+	if len(quakes) == 1 {
+		title = "📰 Daily digest: 1 quake below the alert threshold in the past 24 hours"
+	}
+
+	byProvince := map[string]*digestRow{}
+	for _, q := range quakes {
+		province := provinceOf(q.Location)
+		if province == "" {
+			province = "Unknown"
+		}
+		r, ok := byProvince[province]
+		if !ok {
+			r = &digestRow{province: province, min: q.MagnitudeValue, max: q.MagnitudeValue, strongest: q}
+			byProvince[province] = r
+		}
+		r.count++
+		r.min = math.Min(r.min, q.MagnitudeValue)
+		if q.MagnitudeValue > r.max {
+			r.max, r.strongest = q.MagnitudeValue, q
+		}
+	}
+	rows := make([]*digestRow, 0, len(byProvince))
+	for _, r := range byProvince {
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].count != rows[j].count {
+			return rows[i].count > rows[j].count
+		}
+		return rows[i].province < rows[j].province
+	})
+
+	var plain, formatted strings.Builder
+	plain.WriteString(title)
+	formatted.WriteString("<b>" + title + "</b>")
+	if len(rows) == 0 {
+		return plain.String(), formatted.String()
+	}
+	formatted.WriteString("<table><tr><th>Province</th><th>Events</th><th>Magnitude</th><th>Strongest</th></tr>")
+	for i, r := range rows {
+		if i == MAX_DIGEST_ROWS {
+			rest := 0
+			for _, r := range rows[i:] {
+				rest += r.count
+			}
+			fmt.Fprintf(&plain, "\n… and %d more quakes in %d other provinces", rest, len(rows)-i)
+			fmt.Fprintf(&formatted, "<tr><td colspan=\"4\">… and %d more quakes in %d other provinces</td></tr>", rest, len(rows)-i)
+			break
+		}
+		magRange := fmt.Sprintf("M%.1f", r.min)
+		if r.max > r.min {
+			magRange = fmt.Sprintf("M%.1f–%.1f", r.min, r.max)
+		}
+		fmt.Fprintf(&plain, "\n• %s: %d, %s, strongest M%s at %s %s",
+			r.province, r.count, magRange, r.strongest.Magnitude, r.strongest.DateTime, r.strongest.Bulletin)
+		fmt.Fprintf(&formatted, "<tr><td>%s</td><td>%d</td><td>%s</td><td><a href=\"%s\">M%s, %s</a></td></tr>",
+			html.EscapeString(r.province), r.count, magRange, r.strongest.Bulletin, r.strongest.Magnitude, r.strongest.DateTime)
+	}
+	formatted.WriteString("</table>")
+	return plain.String(), formatted.String()
+}
+
+func readDigestState(fileName string) *digestState {
+	d := &digestState{Quakes: map[string]Quake{}}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return d
+	}
+	if err := json.Unmarshal(data, d); err != nil {
+		log.Printf("⚠️ Failed to parse digest state %s: %v", fileName, err)
+		return &digestState{Quakes: map[string]Quake{}}
+	}
+	if d.Quakes == nil {
+		d.Quakes = map[string]Quake{}
+	}
+	for key, q := range d.Quakes {
+		d.Quakes[key] = withDerivedFields(q)
+	}
+	return d
+}
+
+func (d *digestState) save() {
+	data, _ := json.MarshalIndent(d, "", "  ")
+	if err := writeStateFile(statePath(DIGEST_STATE_FILE), data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", DIGEST_STATE_FILE, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// depthRule offsets the magnitude threshold of quakes with a depth in [minKm, maxKm)
+type depthRule struct {
+	minKm, maxKm float64
+	offset       float64
+}
+
+// DEPTH_RULES as last parsed, parsed again only when a reload changes the spec
+var depthRulesCache struct {
+	mu    sync.Mutex
+	spec  string
+	rules []depthRule
+}
+
+// parseDepthRules parses DEPTH_RULES, comma-separated "MIN-MAX:OFFSET" or "MIN+:OFFSET" rules in km,
+// e.g. "0-30:-0.3,30-70:0,70-300:+0.5,300+:+1.0". Ranges include their minimum but not their maximum,
+// and the first rule matching a depth wins.
+func parseDepthRules(spec string) ([]depthRule, error) {
+	var rules []depthRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		rangePart, offsetPart, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("depth rule %q must be MIN-MAX:OFFSET or MIN+:OFFSET", part)
+		}
+		offset, err := strconv.ParseFloat(strings.TrimSpace(offsetPart), 64)
+		if err != nil {
+			return nil, fmt.Errorf("depth rule %q has an invalid offset: %w", part, err)
+		}
+		rule := depthRule{maxKm: math.Inf(1), offset: offset}
+		rangePart = strings.TrimSpace(rangePart)
+		if lo, open := strings.CutSuffix(rangePart, "+"); open {
+			if rule.minKm, err = strconv.ParseFloat(strings.TrimSpace(lo), 64); err != nil {
+				return nil, fmt.Errorf("depth rule %q has an invalid minimum: %w", part, err)
+			}
+		} else {
+			lo, hi, ok := strings.Cut(rangePart, "-")
+			if !ok {
+				return nil, fmt.Errorf("depth rule %q must be MIN-MAX:OFFSET or MIN+:OFFSET", part)
+			}
+			if rule.minKm, err = strconv.ParseFloat(strings.TrimSpace(lo), 64); err != nil {
+				return nil, fmt.Errorf("depth rule %q has an invalid minimum: %w", part, err)
+			}
+			if rule.maxKm, err = strconv.ParseFloat(strings.TrimSpace(hi), 64); err != nil {
+				return nil, fmt.Errorf("depth rule %q has an invalid maximum: %w", part, err)
+			}
+		}
+		if rule.minKm < 0 || rule.maxKm <= rule.minKm {
+			return nil, fmt.Errorf("depth rule %q must have 0 <= MIN < MAX", part)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("DEPTH_RULES lists no rules")
+	}
+	return rules, nil
+}
+
+// depthOffset returns the threshold offset of the first rule matching a depth, 0 when none does
+func depthOffset(rules []depthRule, depthKm float64) float64 {
+	for _, r := range rules {
+		if depthKm >= r.minKm && depthKm < r.maxKm {
+			return r.offset
+		}
+	}
+	return 0
+}
+
+// currentDepthRules returns the parsed DEPTH_RULES, nil when unset
+func currentDepthRules() []depthRule {
+	depthRulesCache.mu.Lock()
+	defer depthRulesCache.mu.Unlock()
+	if depthRulesCache.spec != depthRules {
+		depthRulesCache.spec = depthRules
+		depthRulesCache.rules = nil
+		if depthRules != "" {
+			// an invalid spec is rejected by validateConfig, only reachable if it was skipped
+			depthRulesCache.rules, _ = parseDepthRules(depthRules)
+		}
+	}
+	return depthRulesCache.rules
+}
+
+// thresholdFor returns the magnitude a quake must reach to be posted: magnitudeThresholdFor,
+// raised to GLOBAL_MAG_THRESH outside the PROVINCES_FILTER provinces, or LOCAL_MAG_THRESH when
+// its origin matches ORIGIN_INCLUDE, raised by OFFSHORE_MAG_OFFSET offshore, offset by the
+// DEPTH_RULES matching its depth and never below ABSOLUTE_MIN_MAGNITUDE. Quakes with an unparseable depth, or without
+// DEPTH_RULES, get no depth adjustment.
+func thresholdFor(q Quake) float64 {
+	return adjustedThreshold(q, magnitudeThresholdFor(q.Latitude, q.Longitude), localMagThresh, globalMagThresh)
+}
+
+// adjustedThreshold applies PROVINCES_FILTER, ORIGIN_INCLUDE, OFFSHORE_MAG_OFFSET, DEPTH_RULES and
+// ABSOLUTE_MIN_MAGNITUDE to the regional threshold base of a quake, localMag being the threshold
+// ORIGIN_INCLUDE lowers it to and globalMag the one quakes outside PROVINCES_FILTER must reach
+func adjustedThreshold(q Quake, base, localMag, globalMag float64) float64 {
+	if !provinceAllowed(q) {
+		base = math.Max(base, globalMag)
+	}
+	base = math.Max(base, absoluteMinMagnitude)
+	if originIncluded(q) {
+		base = math.Max(localMag, absoluteMinMagnitude)
+	}
+	if q.Offshore {
+		base = math.Max(base+offshoreMagOffset, absoluteMinMagnitude)
+	}
+	rules := currentDepthRules()
+	if rules == nil {
+		return base
+	}
+	depth, err := strconv.ParseFloat(normalizeDepth(q.Depth), 64)
+	if err != nil {
+		slog.Debug("Depth rules skipped, unparseable depth", "datetime", q.DateTime, "depth", q.Depth, "threshold", base)
+		return base
+	}
+	offset := depthOffset(rules, depth)
+	threshold := math.Max(base+offset, absoluteMinMagnitude)
+	slog.Debug("Depth rules applied", "datetime", q.DateTime, "magnitude", q.Magnitude, "depth_km", depth,
+		"base_threshold", base, "offset", offset, "threshold", threshold)
+	return threshold
+}
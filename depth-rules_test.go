@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// useDepthRules sets DEPTH_RULES for the duration of a test
+func useDepthRules(t *testing.T, spec string) {
+	t.Helper()
+	saved := depthRules
+	depthRules = spec
+	t.Cleanup(func() { depthRules = saved })
+}
+
+func TestAdjustedThresholdDepthRules(t *testing.T) {
+	useDepthRules(t, "0-30:-0.3,30-70:0,70-300:+0.5,300+:+1.0")
+	tests := []struct {
+		depth string
+		want  float64
+	}{
+		{"010", 3.7},
+		{"030", 4},
+		{"150", 4.5},
+		{"500", 5},
+		{"—", 4},
+	}
+	for _, tt := range tests {
+		got := adjustedThreshold(Quake{Depth: tt.depth}, 4, 0, 0)
+		if got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("threshold at depth %q = %v, want %v", tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentDepthRulesParsedOnce(t *testing.T) {
+	useDepthRules(t, "0-70:-0.5,70+:+0.5")
+	first := currentDepthRules()
+	if len(first) != 2 {
+		t.Fatalf("%d rules parsed, want 2", len(first))
+	}
+	if again := currentDepthRules(); &again[0] != &first[0] {
+		t.Error("DEPTH_RULES parsed again although it did not change")
+	}
+
+	// a reload changing DEPTH_RULES takes effect on the next check
+	depthRules = "0+:+1"
+	if got := adjustedThreshold(Quake{Depth: "010"}, 4, 0, 0); got != 5 {
+		t.Errorf("threshold after the reload = %v, want 5", got)
+	}
+	depthRules = ""
+	if rules := currentDepthRules(); rules != nil {
+		t.Errorf("rules %+v kept after DEPTH_RULES was unset", rules)
+	}
+}
+
+func TestParseDepthRules(t *testing.T) {
+	tests := []struct {
+		spec  string
+		rules []depthRule
+		ok    bool
+	}{
+		{"0-30:-0.3,30-70:0,70-300:+0.5,300+:+1.0", []depthRule{
+			{0, 30, -0.3}, {30, 70, 0}, {70, 300, 0.5}, {300, math.Inf(1), 1},
+		}, true},
+		{" 0 - 30 : -0.3 , 30+ : 1 ,", []depthRule{{0, 30, -0.3}, {30, math.Inf(1), 1}}, true},
+		{"0.5-12.5:+0.25", []depthRule{{0.5, 12.5, 0.25}}, true},
+		{"", nil, false},
+		{" , ", nil, false},
+		{"0-30", nil, false},
+		{"0-30:shallow", nil, false},
+		{"30:+1", nil, false},
+		{"a-30:+1", nil, false},
+		{"0-b:+1", nil, false},
+		{"x+:+1", nil, false},
+		{"30-10:+1", nil, false},
+		{"30-30:+1", nil, false},
+		{"-10-30:+1", nil, false},
+		{"0-30:-0.3,bogus", nil, false},
+	}
+	for _, tt := range tests {
+		rules, err := parseDepthRules(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseDepthRules(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+			continue
+		}
+		if !reflect.DeepEqual(rules, tt.rules) {
+			t.Errorf("parseDepthRules(%q) = %+v, want %+v", tt.spec, rules, tt.rules)
+		}
+	}
+}
+
+func TestDepthOffsetEdges(t *testing.T) {
+	rules, err := parseDepthRules("0-30:-0.3,30-70:0,70-300:+0.5,300+:+1.0,10-20:+9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		depthKm, want float64
+	}{
+		{0, -0.3},
+		{15, -0.3}, // the first matching rule wins over the later 10-20
+		{29.99, -0.3},
+		{30, 0}, // minimum included, maximum excluded
+		{69.99, 0},
+		{70, 0.5},
+		{300, 1},
+		{700, 1},
+		{-1, 0}, // no rule matches
+	}
+	for _, tt := range tests {
+		if got := depthOffset(rules, tt.depthKm); got != tt.want {
+			t.Errorf("depthOffset(%v) = %v, want %v", tt.depthKm, got, tt.want)
+		}
+	}
+
+	// with a gap between the rules, depths in it get no adjustment
+	gapped, _ := parseDepthRules("0-30:-0.3,70+:+1")
+	if got := depthOffset(gapped, 50); got != 0 {
+		t.Errorf("depthOffset in the gap = %v, want 0", got)
+	}
+}
+
+func TestAdjustedThresholdAbsoluteMinimum(t *testing.T) {
+	useDepthRules(t, "0-30:-3")
+	saved := absoluteMinMagnitude
+	t.Cleanup(func() { absoluteMinMagnitude = saved })
+	absoluteMinMagnitude = 2
+	if got := adjustedThreshold(Quake{Depth: "005"}, 4, 0, 0); got != 2 {
+		t.Errorf("threshold = %v, want ABSOLUTE_MIN_MAGNITUDE 2", got)
+	}
+}
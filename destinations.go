@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// destinationConfig is one entry of CONFIG_FILE. Unset rules fall back to the environment,
+// credentials (Matrix token, Telegram bot, SMTP) are always shared from it.
+type destinationConfig struct {
+	Name      string   `json:"name"`
+	Notifiers []string `json:"notifiers"`
+	// where the notifiers post, like MATRIX_ROOM_ID, TELEGRAM_CHAT_ID, DISCORD_WEBHOOK_URL, WEBHOOK_URL and EMAIL_TO
+	MatrixRoomID      string `json:"matrix_room_id"`
+	TelegramChatID    string `json:"telegram_chat_id"`
+	DiscordWebhookURL string `json:"discord_webhook_url"`
+	WebhookURL        string `json:"webhook_url"`
+	EmailTo           string `json:"email_to"`
+	// magnitude thresholds inside and outside the local area, like LOCAL_MAG_THRESH and GLOBAL_MAG_THRESH
+	LocalMag  *float64 `json:"local_mag"`
+	GlobalMag *float64 `json:"global_mag"`
+	// local area: a GeoJSON file, or a circle around a reference point
+	GeofenceFile string   `json:"geofence_file"`
+	RefPointLat  *float64 `json:"ref_point_lat"`
+	RefPointLon  *float64 `json:"ref_point_lon"`
+	RefRadiusKm  *float64 `json:"ref_radius_km"`
+	// post bulletin revisions, true unless set to false
+	Updates *bool `json:"updates"`
+	// "HH:MM-HH:MM" during which alerts below QuietMinMag are held, like QUIET_HOURS and QUIET_MIN_MAG
+	QuietHours  string   `json:"quiet_hours"`
+	QuietMinMag *float64 `json:"quiet_min_mag"`
+}
+
+// destination is a set of notifiers with its own posting rules. Without CONFIG_FILE there is a
+// single one whose rules and notifiers are read from the environment when used, so reloads apply.
+type destination struct {
+	name string
+	// nil for the environment destination, which uses the global notifiers
+	notifiers []Notifier
+	cfg       *destinationConfig
+	geofence  *geoFence
+}
+
+// destinations alerts are posted to, the first one keeps the top-level event IDs of posted quakes
+var destinations = []*destination{envDestination}
+
+// destination synthesized from the environment when CONFIG_FILE is unset
+var envDestination = &destination{name: "default"}
+
+// alertVerdict is what a destination does with an alert
+type alertVerdict int
+
+const (
+	VERDICT_POST alertVerdict = iota
+	VERDICT_HOLD
+	VERDICT_SKIP
+)
+
+// loadDestinations reads CONFIG_FILE, checking every destination so a broken file fails at startup
+func loadDestinations(fileName string) ([]*destination, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Destinations []destinationConfig `json:"destinations"`
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fileName, err)
+	}
+	if len(doc.Destinations) == 0 {
+		return nil, fmt.Errorf("%s lists no destinations", fileName)
+	}
+
+	var ds []*destination
+	var errs []error
+	seen := map[string]bool{}
+	for i := range doc.Destinations {
+		cfg := &doc.Destinations[i]
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("destination %d", i+1)
+		}
+		if seen[cfg.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name", cfg.Name))
+		}
+		seen[cfg.Name] = true
+		d := &destination{name: cfg.Name, cfg: cfg}
+		if err := d.check(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cfg.Name, err))
+			continue
+		}
+		if cfg.GeofenceFile != "" {
+			if d.geofence, err = loadGeofence(cfg.GeofenceFile); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", cfg.Name, err))
+				continue
+			}
+		}
+		d.notifiers = buildNotifiers(parseNotifierNames(strings.Join(cfg.Notifiers, ",")), notifierSettings{
+			matrixRoomID:      cfg.MatrixRoomID,
+			telegramChatID:    cfg.TelegramChatID,
+			discordWebhookURL: cfg.DiscordWebhookURL,
+			webhookURL:        cfg.WebhookURL,
+			emailTo:           cfg.EmailTo,
+		})
+		ds = append(ds, d)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return ds, nil
+}
+
+// check validates the rules and the notifier settings of a CONFIG_FILE destination
+func (d *destination) check() error {
+	cfg := d.cfg
+	var errs []error
+	names := parseNotifierNames(strings.Join(cfg.Notifiers, ","))
+	if len(names) == 0 {
+		errs = append(errs, errors.New("no notifiers"))
+	}
+	for _, name := range names {
+		var missing string
+		switch name {
+		case NOTIFIER_MATRIX:
+			if cfg.MatrixRoomID == "" {
+				missing = "matrix_room_id"
+			}
+		case NOTIFIER_TELEGRAM:
+			if cfg.TelegramChatID == "" {
+				missing = "telegram_chat_id"
+			}
+		case NOTIFIER_DISCORD:
+			if cfg.DiscordWebhookURL == "" {
+				missing = "discord_webhook_url"
+			}
+		case NOTIFIER_WEBHOOK:
+			if cfg.WebhookURL == "" {
+				missing = "webhook_url"
+			}
+		case NOTIFIER_EMAIL:
+			if len(parseEmailList(cfg.EmailTo)) == 0 {
+				missing = "email_to"
+			}
+		default:
+			errs = append(errs, fmt.Errorf("notifier %q is unknown", name))
+		}
+		if missing != "" {
+			errs = append(errs, fmt.Errorf("notifier %s needs %s", name, missing))
+		}
+	}
+
+	local, global := d.mags()
+	if local < 0 || global > 10 || local > global {
+		errs = append(errs, fmt.Errorf("local_mag %.1f and global_mag %.1f must be within 0..10, local first", local, global))
+	}
+	if (cfg.RefPointLat == nil) != (cfg.RefPointLon == nil) {
+		errs = append(errs, errors.New("ref_point_lat and ref_point_lon must be set together"))
+	}
+	if cfg.GeofenceFile != "" && cfg.RefPointLat != nil {
+		errs = append(errs, errors.New("geofence_file can't be combined with ref_point_lat and ref_point_lon"))
+	}
+	if cfg.RefRadiusKm != nil && *cfg.RefRadiusKm <= 0 {
+		errs = append(errs, fmt.Errorf("ref_radius_km %.2f must be positive", *cfg.RefRadiusKm))
+	}
+	if cfg.QuietHours != "" {
+		start, end, ok := strings.Cut(cfg.QuietHours, "-")
+		_, err1 := parseClock(strings.TrimSpace(start))
+		_, err2 := parseClock(strings.TrimSpace(end))
+		if !ok || err1 != nil || err2 != nil {
+			errs = append(errs, fmt.Errorf("invalid quiet_hours %q (expected HH:MM-HH:MM)", cfg.QuietHours))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mags returns the local and global magnitude thresholds of a destination
+func (d *destination) mags() (float64, float64) {
+	local, global := localMagThresh, globalMagThresh
+	if d.cfg != nil && d.cfg.LocalMag != nil {
+		local = *d.cfg.LocalMag
+	}
+	if d.cfg != nil && d.cfg.GlobalMag != nil {
+		global = *d.cfg.GlobalMag
+	}
+	return local, global
+}
+
+// threshold returns the magnitude q must reach to be posted to the destination, thresholdFor
+// with the destination's own magnitudes and local area
+func (d *destination) threshold(q Quake) float64 {
+	if d.cfg == nil {
+		return thresholdFor(q)
+	}
+	local, global := d.mags()
+	lat, lon, ok := quakeCoords(q)
+	base := global
+	switch {
+	case !ok:
+	case d.geofence != nil:
+		if d.geofence.contains(lat, lon) {
+			base = local
+		}
+	case d.cfg.RefPointLat == nil && geofence != nil:
+		if geofence.contains(lat, lon) {
+			base = local
+		}
+	default:
+		cfg := currentThresholdConfig()
+		cfg.localMag, cfg.globalMag = local, global
+		refLat, refLon := refPointLat, refPointLon
+		if d.cfg.RefPointLat != nil {
+			refLat, refLon = *d.cfg.RefPointLat, *d.cfg.RefPointLon
+		}
+		if d.cfg.RefRadiusKm != nil {
+			cfg.radiusKm = *d.cfg.RefRadiusKm
+		}
+		base = thresholdAtDistance(distanceKm(lat, lon, refLat, refLon), cfg)
+	}
+	return adjustedThreshold(q, base, local, global)
+}
+
+// detectionThresholdFor returns the lowest threshold of all destinations, quakes below it
+// interest none of them
+func detectionThresholdFor(q Quake) float64 {
+	threshold := math.Inf(1)
+	for _, d := range destinations {
+		threshold = math.Min(threshold, d.threshold(q))
+	}
+	return threshold
+}
+
+// inQuietHours reports whether t falls in the quiet hours of the destination
+func (d *destination) inQuietHours(t time.Time) bool {
+	if d.cfg == nil {
+		return inQuietHours(t)
+	}
+	start, end, _ := strings.Cut(d.cfg.QuietHours, "-")
+	return inQuietWindow(t, strings.TrimSpace(start), strings.TrimSpace(end))
+}
+
+// evaluate decides what the destination does with an alert. The rules apply in this order, the
+// first one matching wins: revisions are skipped when updates are off, alerts below the threshold
+// and MIN_REPORTED_INTENSITY are skipped (revisions when neither version reaches them), and alerts below the quiet-hours
+// magnitude are held during quiet hours. ORIGIN_EXCLUDE applies to every destination before.
+func (d *destination) evaluate(q Quake, updated bool, old Quake, now time.Time) (alertVerdict, string) {
+	if updated && d.cfg != nil && d.cfg.Updates != nil && !*d.cfg.Updates {
+		return VERDICT_SKIP, "updates are off"
+	}
+	threshold := d.threshold(q)
+	significant := q.MagnitudeOK && q.MagnitudeValue >= threshold || feltQualifies(q)
+	if updated && !significant {
+		significant = old.MagnitudeOK && old.MagnitudeValue >= d.threshold(old) || feltQualifies(old)
+	}
+	if !significant {
+		return VERDICT_SKIP, fmt.Sprintf("below the M%.1f threshold", threshold)
+	}
+	quietMinMag := quietOverrideMagnitude
+	if d.cfg != nil && d.cfg.QuietMinMag != nil {
+		quietMinMag = *d.cfg.QuietMinMag
+	}
+	if d.inQuietHours(now) && (!q.MagnitudeOK || q.MagnitudeValue < quietMinMag) {
+		return VERDICT_HOLD, "quiet hours"
+	}
+	return VERDICT_POST, ""
+}
+
+// notifierList returns the sinks of the destination
+func (d *destination) notifierList() []Notifier {
+	if d.cfg == nil {
+		return notifiers
+	}
+	return d.notifiers
+}
+
+// threadRoot returns the event ID the alerts of original are threaded under in the destination
+func (d *destination) threadRoot(original PostedQuake) string {
+	if d == destinations[0] {
+		return threadRootID(original)
+	}
+	return original.DestinationRoots[d.name]
+}
+
+// destinationNamed returns the destination with the given name, the first one when it no longer exists
+func destinationNamed(name string) *destination {
+	for _, d := range destinations {
+		if d.name == name {
+			return d
+		}
+	}
+	return destinations[0]
+}
+
+// allNotifiers returns the sinks of every destination, for messages that aren't alerts such as
+// tsunami information
+func allNotifiers() []Notifier {
+	if configFile == "" {
+		return newNotifiers()
+	}
+	var ns []Notifier
+	for _, d := range destinations {
+		ns = append(ns, d.notifiers...)
+	}
+	return ns
+}
+
+// destinationCredentialErrors checks that the shared credentials the CONFIG_FILE notifiers need are set
+func destinationCredentialErrors() []error {
+	if !postsAlerts() {
+		return nil
+	}
+	used := map[string]bool{}
+	for _, d := range destinations {
+		if d.cfg != nil {
+			for _, name := range parseNotifierNames(strings.Join(d.cfg.Notifiers, ",")) {
+				used[name] = true
+			}
+		}
+	}
+	if notifierEnabled(NOTIFIER_MATRIX) {
+		used[NOTIFIER_MATRIX] = true
+	}
+	var errs []error
+	if used[NOTIFIER_MATRIX] && (matrixBaseURL == "" || accessToken == "") {
+		errs = append(errs, errors.New("MATRIX_BASE_URL and MATRIX_ACCESS_TOKEN must be set for the matrix destinations"))
+	}
+	if used[NOTIFIER_TELEGRAM] && telegramBotToken == "" {
+		errs = append(errs, errors.New("TELEGRAM_BOT_TOKEN must be set for the telegram destinations"))
+	}
+	if used[NOTIFIER_EMAIL] && (smtpHost == "" || emailFrom == "") {
+		errs = append(errs, errors.New("SMTP_HOST and EMAIL_FROM must be set for the email destinations"))
+	}
+	return errs
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// testDestinations returns an ops room posting everything from M3.5 within 100 km of Cebu City
+// and M4.5 elsewhere, and a public channel posting new M5+ quakes only, held at night below M6
+func testDestinations() (ops, public *destination) {
+	ops = &destination{name: "ops", cfg: &destinationConfig{
+		Name: "ops", LocalMag: ptr(3.5), GlobalMag: ptr(4.5),
+		RefPointLat: ptr(10.3157), RefPointLon: ptr(123.8854), RefRadiusKm: ptr(100.0),
+	}}
+	public = &destination{name: "public", cfg: &destinationConfig{
+		Name: "public", LocalMag: ptr(5.0), GlobalMag: ptr(5.0),
+		Updates: ptr(false), QuietHours: "22:00-07:00", QuietMinMag: ptr(6.0),
+	}}
+	return ops, public
+}
+
+func TestDestinationEvaluatePrecedence(t *testing.T) {
+	useThresholds(t, 1, 1)
+	savedIntensity, savedFalloff := minReportedIntensity, thresholdFalloff
+	t.Cleanup(func() { minReportedIntensity, thresholdFalloff = savedIntensity, savedFalloff })
+	minReportedIntensity, thresholdFalloff = "V", false
+	ops, public := testDestinations()
+	day := time.Date(2024, 3, 1, 14, 0, 0, 0, manilaLoc)
+	night := time.Date(2024, 3, 1, 23, 0, 0, 0, manilaLoc)
+
+	// near Cebu City, and in Manila far outside the ops area
+	cebu := func(mag string) Quake {
+		return withDerivedFields(Quake{Magnitude: mag, Latitude: "10.40", Longitude: "123.95", Location: "010 km N 30° E of Cebu City (Cebu)"})
+	}
+	manila := func(mag string) Quake {
+		return withDerivedFields(Quake{Magnitude: mag, Latitude: "14.60", Longitude: "121.00", Location: "002 km N 10° E of Manila (Metro Manila)"})
+	}
+	felt := cebu("3.0")
+	felt.MaxIntensity = "VI"
+
+	tests := []struct {
+		name    string
+		d       *destination
+		q       Quake
+		updated bool
+		old     Quake
+		now     time.Time
+		want    alertVerdict
+		reason  string
+	}{
+		{"updates off wins over magnitude and quiet hours", public, cebu("6.5"), true, cebu("6.4"), night, VERDICT_SKIP, "updates are off"},
+		{"threshold before quiet hours", public, cebu("4.8"), false, Quake{}, night, VERDICT_SKIP, "below the M5.0 threshold"},
+		{"held in quiet hours", public, cebu("5.2"), false, Quake{}, night, VERDICT_HOLD, "quiet hours"},
+		{"strong enough for the night", public, cebu("6.2"), false, Quake{}, night, VERDICT_POST, ""},
+		{"posted in the day", public, cebu("5.2"), false, Quake{}, day, VERDICT_POST, ""},
+		{"local threshold", ops, cebu("3.6"), false, Quake{}, day, VERDICT_POST, ""},
+		{"global threshold far away", ops, manila("4.0"), false, Quake{}, day, VERDICT_SKIP, "below the M4.5 threshold"},
+		{"revision of a posted quake", ops, cebu("3.4"), true, cebu("3.6"), day, VERDICT_POST, ""},
+		{"revision of a quake below the threshold", ops, cebu("3.4"), true, cebu("3.3"), day, VERDICT_SKIP, "below the M3.5 threshold"},
+		{"felt intensity lifts a small quake", ops, felt, false, Quake{}, day, VERDICT_POST, ""},
+		{"felt intensity doesn't bypass quiet hours", public, felt, false, Quake{}, night, VERDICT_HOLD, "quiet hours"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, reason := tt.d.evaluate(tt.q, tt.updated, tt.old, tt.now)
+			if verdict != tt.want || reason != tt.reason {
+				t.Errorf("evaluate = %v %q, want %v %q", verdict, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEnvDestinationUsesEnvironment(t *testing.T) {
+	useThresholds(t, 3, 5)
+	savedQuiet := quietHours
+	t.Cleanup(func() { quietHours = savedQuiet })
+	quietHours = ""
+	q := withDerivedFields(Quake{Magnitude: "4.0", Latitude: "14.60", Longitude: "121.00", Location: "002 km N 10° E of Manila (Metro Manila)"})
+	if got, want := envDestination.threshold(q), thresholdFor(q); got != want {
+		t.Errorf("environment destination threshold = %v, thresholdFor = %v", got, want)
+	}
+	if verdict, _ := envDestination.evaluate(q, true, q, time.Now()); verdict != VERDICT_SKIP {
+		t.Errorf("M4.0 update outside the local area = %v, want skipped", verdict)
+	}
+}
+
+func TestLoadDestinations(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		fileName := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return fileName
+	}
+
+	ds, err := loadDestinations(write(t, `{"destinations": [
+		{"name": "ops", "notifiers": ["matrix"], "matrix_room_id": "!ops:example.org", "local_mag": 3.5, "global_mag": 4.5},
+		{"notifiers": ["webhook"], "webhook_url": "https://example.org/hook", "updates": false,
+		 "geofence_file": "testdata/geofence-with-hole.geojson"}
+	]}`))
+	if err != nil {
+		t.Fatalf("loadDestinations: %v", err)
+	}
+	if len(ds) != 2 || ds[0].name != "ops" || ds[1].name != "destination 2" {
+		t.Fatalf("destinations %+v", ds)
+	}
+	if len(ds[0].notifiers) != 1 || ds[1].geofence == nil {
+		t.Errorf("notifiers %v, geofence %v", ds[0].notifiers, ds[1].geofence)
+	}
+
+	for _, tt := range []struct{ name, content, want string }{
+		{"no destinations", `{"destinations": []}`, "lists no destinations"},
+		{"unknown field", `{"destinations": [{"name": "a", "room": "!a"}]}`, "unknown field"},
+		{"duplicate name", `{"destinations": [{"name": "a", "notifiers": ["webhook"], "webhook_url": "https://a"},
+			{"name": "a", "notifiers": ["webhook"], "webhook_url": "https://b"}]}`, "duplicate name"},
+		{"missing room", `{"destinations": [{"name": "a", "notifiers": ["matrix"]}]}`, "needs matrix_room_id"},
+		{"thresholds reversed", `{"destinations": [{"name": "a", "notifiers": ["webhook"], "webhook_url": "https://a",
+			"local_mag": 5, "global_mag": 3}]}`, "local first"},
+		{"half a reference point", `{"destinations": [{"name": "a", "notifiers": ["webhook"], "webhook_url": "https://a",
+			"ref_point_lat": 10.3}]}`, "set together"},
+		{"invalid quiet hours", `{"destinations": [{"name": "a", "notifiers": ["webhook"], "webhook_url": "https://a",
+			"quiet_hours": "22:00"}]}`, "invalid quiet_hours"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadDestinations(write(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadDestinations error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
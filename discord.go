@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// embed colors, red for strong quakes and amber otherwise
+	DISCORD_COLOR_STRONG = 0xE53935
+	DISCORD_COLOR_NORMAL = 0xFFA000
+	// magnitude from which alerts use the strong color
+	DISCORD_STRONG_MAGNITUDE = 6.0
+)
+
+// discordNotifier posts alerts to a Discord channel webhook
+type discordNotifier struct {
+	webhookURL string
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	URL         string              `json:"url,omitempty"`
+	Description string              `json:"description"`
+	Color       int                 `json:"color"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Fields      []discordEmbedField `json:"fields"`
+	Footer      struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+}
+
+func (n discordNotifier) String() string { return NOTIFIER_DISCORD }
+
+// Notify posts a message as plain content, Discord doesn't render the Matrix HTML
+func (n discordNotifier) Notify(plain, html string) error {
+	return n.send(map[string]any{"content": plain}, plain)
+}
+
+// notifyQuake posts the alert for a quake as an embed built from its fields
+func (n discordNotifier) notifyQuake(updated bool, oldQuake, q Quake) error {
+	embed := discordEmbed{
+		Title:       "🚨 New Earthquake Alert!",
+		URL:         q.Bulletin,
+		Description: "📍 " + q.Location,
+		Color:       DISCORD_COLOR_NORMAL,
+	}
+	if updated {
+		embed.Title = "💡 Earthquake Bulletin Update!"
+		if isFinalBulletin(q.Bulletin) {
+			embed.Title += " (Final)"
+		}
+		if q.Location != oldQuake.Location {
+			embed.Description = fmt.Sprintf("📍 **%s**\nPrevious: %s", q.Location, oldQuake.Location)
+		}
+	}
+	if q.MagnitudeValue >= DISCORD_STRONG_MAGNITUDE {
+		embed.Color = DISCORD_COLOR_STRONG
+	}
+	if !q.OccurredAt.IsZero() {
+		embed.Timestamp = q.OccurredAt.UTC().Format(time.RFC3339)
+	}
+
+	coords := fmt.Sprintf("[%s](%s%s,%s)", buildCoordinates(q.Latitude, q.Longitude), MAPS_BASE_URL, q.Latitude, q.Longitude)
+	embed.Fields = []discordEmbedField{
+		{Name: "📈 Magnitude", Value: discordChange(updated, formatMagnitude(oldQuake), formatMagnitude(q)), Inline: true},
+		{Name: "📊 Depth", Value: discordChange(updated, formatDepth(oldQuake.Depth), formatDepth(q.Depth)), Inline: true},
+		{Name: "🧭 Coordinates", Value: coords, Inline: true},
+		{Name: "📅 Date & Time", Value: q.DateTime},
+	}
+	if q.ExpectingDamage != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "🏠 Expecting Damage", Value: discordChange(updated, oldQuake.ExpectingDamage, q.ExpectingDamage), Inline: true})
+	}
+	if q.ExpectingAftershocks != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "🔁 Expecting Aftershocks", Value: discordChange(updated, oldQuake.ExpectingAftershocks, q.ExpectingAftershocks), Inline: true})
+	}
+	if q.USGSEventURL != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "🌐 USGS", Value: fmt.Sprintf("[%s](%s)", q.USGSMagnitude, q.USGSEventURL), Inline: true})
+	}
+	if q.Bulletin != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "📄 Bulletin", Value: fmt.Sprintf("[View PHIVOLCS report](%s)", q.Bulletin)})
+	}
+	embed.Footer.Text = "PHIVOLCS Earthquake Information"
+
+	plain, _ := formatMatrixMsg(updated, oldQuake, q, "")
+	return n.send(map[string]any{"embeds": []discordEmbed{embed}}, plain)
+}
+
+// discordChange shows "old → **new**" for revised values of an update
+func discordChange(updated bool, oldVal, newVal string) string {
+	if updated && oldVal != "" && oldVal != newVal {
+		return fmt.Sprintf("%s → **%s**", oldVal, newVal)
+	}
+	return newVal
+}
+
+// send posts a webhook payload, retrying after the delay Discord asks for on 429.
+// plain is only used for the dry-run log.
+func (n discordNotifier) send(payload map[string]any, plain string) (err error) {
+	defer func() {
+		if err != nil {
+			sendFailures++
+		}
+	}()
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would post to Discord:\n%s", plain)
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	waitForPostSlot(context.Background())
+	for attempt := 1; attempt <= 5; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, n.webhookURL, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := apiClient.Do(req)
+		if err != nil {
+			// the webhook URL carries its token, keep it out of the logs
+			log.Printf("Discord send attempt %d failed (network error): %v", attempt, redactURLError(err))
+			time.Sleep(time.Duration(attempt*attempt) * time.Second)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			var limited struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			if json.Unmarshal(body, &limited) == nil && limited.RetryAfter >= 0 {
+				delay := time.Duration(limited.RetryAfter * float64(time.Second))
+				log.Printf("Discord rate limited, retrying after %s", delay)
+				time.Sleep(delay)
+				continue
+			}
+		}
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("Discord webhook error (HTTP %d): %s", resp.StatusCode, bytes.TrimSpace(body))
+		}
+		log.Printf("Discord send attempt %d failed (HTTP %d): %s", attempt, resp.StatusCode, bytes.TrimSpace(body))
+		time.Sleep(time.Duration(attempt*attempt) * time.Second)
+	}
+	return fmt.Errorf("Discord webhook request failed after retries")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTP port using implicit TLS, other ports upgrade with STARTTLS when the server offers it
+const SMTPS_PORT = "465"
+
+// emailNotifier sends alerts as multipart HTML/plain text emails over SMTP
+type emailNotifier struct {
+	host, port string
+	user, pass string
+	from       string
+	to         []string
+}
+
+func (n emailNotifier) String() string { return NOTIFIER_EMAIL }
+
+func (n emailNotifier) Notify(plain, html string) (err error) {
+	defer func() {
+		if err != nil {
+			sendFailures++
+		}
+	}()
+	// the headline of the alert, e.g. "🔴 Strong Earthquake Alert!", doubles as the subject
+	subject, _, _ := strings.Cut(plain, "\n")
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would email %s: %s", strings.Join(n.to, ", "), subject)
+		return nil
+	}
+
+	msg, err := buildEmail(n.from, n.to, subject, plain, html)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	return n.send(msg)
+}
+
+// buildEmail builds a multipart/alternative message with a text/plain and a text/html part
+func buildEmail(from string, to []string, subject, plain, html string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", plain},
+		{"text/html; charset=UTF-8", "<html><body>" + html + "</body></html>"},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// send delivers the message, authenticating only when SMTP_USER is set
+func (n emailNotifier) send(msg []byte) error {
+	addr := net.JoinHostPort(n.host, n.port)
+	var auth smtp.Auth
+	if n.user != "" {
+		auth = smtp.PlainAuth("", n.user, n.pass, n.host)
+	}
+	// the envelope takes bare addresses, the headers keep display names
+	from, err := envelopeAddress(n.from)
+	if err != nil {
+		return err
+	}
+	var to []string
+	for _, rcpt := range n.to {
+		a, err := envelopeAddress(rcpt)
+		if err != nil {
+			return err
+		}
+		to = append(to, a)
+	}
+	if n.port != SMTPS_PORT {
+		return smtp.SendMail(addr, auth, from, to, msg)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: n.host})
+	if err != nil {
+		return fmt.Errorf("SMTP connection failed: %w", err)
+	}
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// envelopeAddress strips the display name of an address, e.g. "Alerts <a@example.org>"
+func envelopeAddress(s string) (string, error) {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid email address %q: %w", s, err)
+	}
+	return a.Address, nil
+}
+
+// parseEmailList splits the comma-separated EMAIL_TO value
+func parseEmailList(s string) []string {
+	var list []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			list = append(list, addr)
+		}
+	}
+	return list
+}
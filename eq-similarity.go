@@ -3,6 +3,9 @@ package main
 import (
 	"regexp"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // basic replacements for common address tokens
@@ -14,11 +17,13 @@ var addrMap = map[string]string{
 	"ph": "phase", "subd": "subdivision",
 }
 
+// punctuation to drop from addresses, keeping non-ASCII letters such as "ñ"
+var addrPunctRe = regexp.MustCompile(`[^\p{L}\p{N}\s]`)
+
 // Normalize address: lowercase, expand abbrev, remove punct/spaces
 func normalizeAddr(s string) string {
-	s = strings.ToLower(s)
-	re := regexp.MustCompile(`[^\w\s]`)
-	s = re.ReplaceAllString(s, " ")
+	s = strings.ToLower(norm.NFC.String(s))
+	s = addrPunctRe.ReplaceAllString(s, " ")
 	fields := strings.Fields(s)
 	for i, f := range fields {
 		if rep, ok := addrMap[f]; ok {
@@ -28,8 +33,9 @@ func normalizeAddr(s string) string {
 	return strings.Join(fields, "")
 }
 
-// Levenshtein distance
-func levenshtein(a, b string) int {
+// Levenshtein distance, counted in runes so "ñ" is a single character
+func levenshtein(sa, sb string) int {
+	a, b := []rune(sa), []rune(sb)
 	la, lb := len(a), len(b)
 	if la == 0 {
 		return lb
@@ -76,7 +82,7 @@ func levenshteinPercent(a, b string) float64 {
 		return 100
 	}
 	dist := levenshtein(a, b)
-	maxLen := float64(max(len(a), len(b)))
+	maxLen := float64(max(utf8.RuneCountInString(a), utf8.RuneCountInString(b)))
 	if maxLen == 0 {
 		return 100
 	}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long after a quake its bulletin revisions are still scraped for MIN_REPORTED_INTENSITY,
+// PHIVOLCS adds the reported intensities within hours
+const INTENSITY_WATCH_WINDOW = 48 * time.Hour
+
+// parseIntensity reads a PEIS level given as roman numerals ("IV") or digits ("4")
+func parseIntensity(s string) (int, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if level, ok := intensityLevels[s]; ok {
+		return level, true
+	}
+	if level, err := strconv.Atoi(s); err == nil && level >= 1 && level <= 10 {
+		return level, true
+	}
+	return 0, false
+}
+
+// feltQualifies reports whether the bulletin of q reported an intensity of at least
+// MIN_REPORTED_INTENSITY, which posts the quake whatever its magnitude
+func feltQualifies(q Quake) bool {
+	if minReportedIntensity == "" {
+		return false
+	}
+	minLevel, ok := parseIntensity(minReportedIntensity)
+	if !ok {
+		// rejected by validateConfig, only reachable if it was skipped
+		return false
+	}
+	return intensityLevels[q.MaxIntensity] >= minLevel
+}
+
+// enrichIntensityCandidates scrapes the bulletins of the recent quakes below every threshold that
+// weren't posted yet, so processQuakes can tell whether they were felt strongly enough. Bulletins
+// already in the cache aren't fetched again.
+func enrichIntensityCandidates(ctx context.Context, latest []Quake, posted map[string]PostedQuake, now time.Time) {
+	if minReportedIntensity == "" {
+		return
+	}
+	var indices []int
+	for i, q := range latest {
+		if q.Bulletin == "" || q.Ineligible || q.MaxIntensity != "" || now.Sub(q.OccurredAt) > INTENSITY_WATCH_WINDOW {
+			continue
+		}
+		if _, ok := posted[quakeLocationKey(q)]; ok {
+			continue
+		}
+		if q.MagnitudeOK && q.MagnitudeValue >= detectionThresholdFor(q) {
+			// scraped by enrichDetected when it is posted
+			continue
+		}
+		indices = append(indices, i)
+	}
+	enrichWithBulletins(ctx, latest, indices)
+}
+
+// feltPromotion reports whether a revision is posted as a new alert because its bulletin is the
+// first to reach MIN_REPORTED_INTENSITY, nothing having been posted for the quake before
+func feltPromotion(posted map[string]PostedQuake, old, q Quake) bool {
+	return feltQualifies(q) && !feltQualifies(old) && findPostedOriginal(posted, old).DateTime == ""
+}
+
+// formatFeltLine returns the reported intensity line of a new alert with MIN_REPORTED_INTENSITY,
+// e.g. "Felt: up to Intensity V in 8 locations"
+func formatFeltLine(q Quake) (string, string) {
+	if minReportedIntensity == "" || q.MaxIntensity == "" {
+		return "", ""
+	}
+	text := "up to Intensity " + q.MaxIntensity
+	if q.FeltReports > 0 {
+		text += fmt.Sprintf(" in %d locations", q.FeltReports)
+	}
+	return "Felt: " + text + "\n", "🙋 <b>Felt:</b> " + text + "<br>"
+}
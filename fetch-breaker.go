@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"time"
+)
+
+// fetchBreaker slows polling down to DEGRADED_POLL_INTERVAL once PHIVOLCS failed FETCH_FAILURE_THRESHOLD
+// times in a row, escalating once per outage instead of logging every retry, and closes on the next success
+type fetchBreaker struct {
+	// when the breaker opened, zero while PHIVOLCS is reachable
+	openedAt time.Time
+}
+
+var breaker = &fetchBreaker{}
+
+// degraded reports whether polling is slowed down after repeated fetch failures
+func (b *fetchBreaker) degraded() bool {
+	return !b.openedAt.IsZero()
+}
+
+// failed records a failed fetch and returns the delay before the next attempt
+func (b *fetchBreaker) failed(consecutiveErrors int, err error) time.Duration {
+	if consecutiveErrors < fetchFailureThreshold {
+		return errorBackoff(consecutiveErrors)
+	}
+	if !b.degraded() {
+		b.openedAt = time.Now()
+		log.Printf("❌ PHIVOLCS fetch failed %d times in a row, polling every %s until it recovers: %v",
+			consecutiveErrors, degradedPollInterval, err)
+		notifyAdmin(
+			fmt.Sprintf("⚠️ PHIVOLCS unreachable\nFetch failed %d times in a row, polling every %s until it recovers\nLast error: %v",
+				consecutiveErrors, degradedPollInterval, err),
+			fmt.Sprintf("⚠️ <b>PHIVOLCS unreachable</b><br>Fetch failed %d times in a row, polling every %s until it recovers<br>Last error: <code>%s</code>",
+				consecutiveErrors, degradedPollInterval, html.EscapeString(err.Error())))
+	}
+	return degradedPollInterval
+}
+
+// succeeded closes the breaker after a successful fetch, telling the operator how long the outage lasted
+func (b *fetchBreaker) succeeded() {
+	if !b.degraded() {
+		return
+	}
+	outage := time.Since(b.openedAt).Round(time.Second)
+	b.openedAt = time.Time{}
+	msg := fmt.Sprintf("✅ PHIVOLCS reachable again after %s, back to polling every %s", outage, pollInterval)
+	log.Println(msg)
+	notifyAdmin(msg, msg)
+
+	// the alert room only hears about it on request, the outage itself was never posted there
+	if notifyOnRecovery && notifierEnabled(NOTIFIER_MATRIX) {
+		roomMsg := fmt.Sprintf("✅ PHIVOLCS monitoring restored after a %s outage", outage)
+		if _, err := sendMatrixMessage(context.Background(), matrixRoomID, roomMsg, roomMsg, ""); err != nil {
+			log.Printf("❌ Failed to post the recovery notice: %v", err)
+		}
+	}
+}
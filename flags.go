@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+)
+
+// parseFlags binds command-line flags to the configuration variables.
+//
+// Precedence is flag > env > default: every flag defaults to the value already
+// resolved from its environment variable (or the built-in default when unset),
+// so a flag only changes the configuration when it is given explicitly.
+func parseFlags() {
+	flag.StringVar(&matrixBaseURL, "matrix-url", matrixBaseURL, "Matrix homeserver base URL (env MATRIX_BASE_URL)")
+	flag.StringVar(&matrixRoomID, "matrix-room", matrixRoomID, "Matrix room ID to post alerts to (env MATRIX_ROOM_ID)")
+	flag.StringVar(&accessToken, "matrix-token", accessToken, "Matrix access token (env MATRIX_ACCESS_TOKEN)")
+	flag.StringVar(&notifierNames, "notifiers", notifierNames, "comma-separated sinks to post alerts to: matrix, telegram, discord, webhook, email (env NOTIFIERS)")
+	flag.StringVar(&telegramBotToken, "telegram-token", telegramBotToken, "Telegram bot token (env TELEGRAM_BOT_TOKEN)")
+	flag.StringVar(&telegramChatID, "telegram-chat", telegramChatID, "Telegram chat ID or @channel (env TELEGRAM_CHAT_ID)")
+	flag.StringVar(&discordWebhookURL, "discord-webhook", discordWebhookURL, "Discord webhook URL (env DISCORD_WEBHOOK_URL)")
+	flag.StringVar(&webhookURL, "webhook-url", webhookURL, "endpoint the webhook notifier POSTs quakes to as JSON (env WEBHOOK_URL)")
+	flag.StringVar(&webhookAuthHeader, "webhook-auth", webhookAuthHeader, "Authorization header value for the webhook, e.g. \"Bearer abc123\" (env WEBHOOK_AUTH_HEADER)")
+	flag.StringVar(&emailTo, "email-to", emailTo, "comma-separated email recipients (env EMAIL_TO)")
+	flag.IntVar(&maxQuakeEntries, "parse-limit", maxQuakeEntries, "number of quake entries to parse (env PARSE_LIMIT)")
+	flag.Float64Var(&refPointLat, "ref-lat", refPointLat, "reference point latitude (env REF_POINT_LAT)")
+	flag.Float64Var(&refPointLon, "ref-lon", refPointLon, "reference point longitude (env REF_POINT_LON)")
+	flag.StringVar(&refPointPlace, "ref-place", refPointPlace, "reference point as a place name, geocoded at startup (env REF_POINT_PLACE)")
+	flag.StringVar(&geocoderURL, "geocoder-url", geocoderURL, "Nominatim-compatible search endpoint for -ref-place (env GEOCODER_URL)")
+	flag.Float64Var(&refRadiusKm, "ref-radius", refRadiusKm, "radius in km around the reference point for the local threshold (env REF_RADIUS_KM)")
+	flag.StringVar(&geofenceFile, "geofence", geofenceFile, "GeoJSON polygon used instead of -ref-radius for the local threshold (env GEOFENCE_FILE)")
+	flag.StringVar(&configFile, "config", configFile, "JSON file of destinations with their own notifiers and rules (env CONFIG_FILE)")
+	flag.Float64Var(&localMagThresh, "local-mag", localMagThresh, "minimum magnitude posted in the local area, 0 posts everything (env LOCAL_MAG_THRESH)")
+	flag.Float64Var(&globalMagThresh, "global-mag", globalMagThresh, "minimum magnitude posted elsewhere, 0 posts everything (env GLOBAL_MAG_THRESH)")
+	flag.Float64Var(&absoluteMinMagnitude, "min-magnitude", absoluteMinMagnitude, "magnitude floor applied on top of the regional thresholds (env ABSOLUTE_MIN_MAGNITUDE)")
+	flag.DurationVar(&pollInterval, "poll-interval", pollInterval, "time between PHIVOLCS polls (env POLL_INTERVAL)")
+	flag.BoolVar(&dryRun, "dry-run", dryRun, "log messages instead of posting to Matrix (env DRY_RUN)")
+	flag.StringVar(&logFormat, "log-format", logFormat, "log format, text or json (env LOG_FORMAT)")
+	flag.StringVar(&logLevel, "log-level", logLevel, "minimum log level: debug, info, warn or error (env LOG_LEVEL)")
+	flag.StringVar(&envFile, "env-file", envFile, "KEY=VALUE file re-read on SIGHUP (env ENV_FILE)")
+	flag.StringVar(&stateDir, "state-dir", stateDir, "directory all state files are kept in (env STATE_DIR or DATA_DIR)")
+	flag.DurationVar(&lockWait, "lock-wait", lockWait, "how long to wait for another instance to release the state lock (env LOCK_WAIT)")
+	flag.Func("posted-retention", "how long posted quakes are remembered, a duration or days such as 60d (env POSTED_RETENTION)", func(s string) error {
+		d, err := parseDurationOrDays(s)
+		if err == nil {
+			postedRetention = d
+		}
+		return err
+	})
+	flag.StringVar(&stateBackend, "state-backend", stateBackend, "where quake state is kept: file, sqlite or redis (env STATE_BACKEND)")
+	flag.StringVar(&exportCSVPath, "export-csv", exportCSVPath, "export posted quakes as CSV to this path (\"-\" for stdout) and exit (env EXPORT_CSV)")
+	flag.StringVar(&archiveFile, "archive-file", archiveFile, "append every quake and revision seen to this JSON Lines file (env ARCHIVE_FILE)")
+	flag.StringVar(&exportArchiveFormat, "export-archive", exportArchiveFormat, "convert ARCHIVE_FILE to this format (csv) on stdout and exit (env EXPORT_ARCHIVE)")
+	flag.StringVar(&replayFile, "replay", replayFile, "print what the quake snapshots of this JSON file would post, without network access, and exit (env REPLAY_FILE)")
+	flag.StringVar(&apiListenAddr, "api-listen", apiListenAddr, "address for the HTTP API, disabled when empty (env API_LISTEN_ADDR)")
+	flag.StringVar(&statusListenAddr, "status-listen", statusListenAddr, "address for the /healthz and /status endpoints, disabled when empty (env STATUS_LISTEN_ADDR)")
+	flag.BoolVar(&runOnce, "once", runOnce, "run a single poll cycle and exit: 0 on success, 1 on fetch/parse failure, 2 if a message failed to deliver (env RUN_ONCE)")
+	flag.BoolVar(&sendTestAlert, "test", sendTestAlert, "post a single test alert to the configured notifiers, then exit (non-zero on failure) (env SEND_TEST_ALERT)")
+	flag.BoolVar(&selfTest, "selftest", selfTest, "validate the configuration, fetch PHIVOLCS and post a test alert, then exit (non-zero on failure)")
+	flag.StringVar(&backfillMonths, "backfill", backfillMonths, "seed state from monthly archives (YYYY-MM[,YYYY-MM...]) without posting, then exit")
+	flag.StringVar(&importFrom, "import-from", importFrom, "import the monthly archives from this YYYY-MM[-DD] date at startup, then keep polling (env IMPORT_FROM)")
+	flag.Parse()
+}
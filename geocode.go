@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// geocoder resolves a place name to coordinates
+type geocoder interface {
+	geocode(ctx context.Context, place string) (lat, lon float64, err error)
+}
+
+// nominatimGeocoder queries a Nominatim search endpoint
+type nominatimGeocoder struct {
+	endpoint string
+}
+
+func (g nominatimGeocoder) geocode(ctx context.Context, place string) (float64, float64, error) {
+	params := url.Values{}
+	params.Set("q", place)
+	params.Set("format", "json")
+	params.Set("limit", "1")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Nominatim's usage policy requires an identifying User-Agent
+	req.Header.Set("User-Agent", USER_AGENT)
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("http get error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("status not OK: %s", resp.Status)
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, 0, fmt.Errorf("no results for %q", place)
+	}
+	lat, ok1 := parseCoord(results[0].Lat)
+	lon, ok2 := parseCoord(results[0].Lon)
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("invalid coordinates %q, %q", results[0].Lat, results[0].Lon)
+	}
+	return lat, lon, nil
+}
+
+// geocodedPoint is a cached geocoding result
+type geocodedPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// resolveRefPointPlace sets the reference point from REF_POINT_PLACE, using the cached result
+// when the place was geocoded before. On failure the numeric REF_POINT_LAT/LON are kept.
+func resolveRefPointPlace(ctx context.Context, g geocoder) {
+	if refPointPlace == "" {
+		return
+	}
+	cacheFile := statePath(GEOCODE_CACHE_FILE)
+	cache := readGeocodeCache(stateReadPath(GEOCODE_CACHE_FILE))
+	key := strings.ToLower(strings.TrimSpace(refPointPlace))
+
+	if p, ok := cache[key]; ok {
+		refPointLat, refPointLon = p.Lat, p.Lon
+		log.Printf("📍 Reference point %q is %.4f, %.4f (cached)", refPointPlace, p.Lat, p.Lon)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	lat, lon, err := g.geocode(ctx, refPointPlace)
+	if err != nil {
+		log.Printf("⚠️ Failed to geocode REF_POINT_PLACE %q, using %.4f, %.4f: %v", refPointPlace, refPointLat, refPointLon, err)
+		return
+	}
+	refPointLat, refPointLon = lat, lon
+	log.Printf("📍 Reference point %q is %.4f, %.4f", refPointPlace, lat, lon)
+
+	cache[key] = geocodedPoint{Lat: lat, Lon: lon}
+	data, _ := json.MarshalIndent(cache, "", "  ")
+	if err := writeStateFile(cacheFile, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", cacheFile, err)
+	}
+}
+
+func readGeocodeCache(fileName string) map[string]geocodedPoint {
+	cache := map[string]geocodedPoint{}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Printf("⚠️ Failed to parse geocode cache %s: %v", fileName, err)
+		return map[string]geocodedPoint{}
+	}
+	return cache
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// geoFence is the area loaded from GEOFENCE_FILE, quakes inside it get the local magnitude threshold
+type geoFence struct {
+	// each polygon is an outer ring followed by its holes, every ring a closed list of [lon, lat] positions
+	polygons [][][][2]float64
+}
+
+// fence loaded from GEOFENCE_FILE at startup, nil to use the circle around the reference point
+var geofence *geoFence
+
+// geoJSON is the subset of GeoJSON needed to find the fence geometry: a bare geometry, a Feature or a FeatureCollection
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Features    []geoJSON       `json:"features"`
+}
+
+// loadGeofence reads a GeoJSON file made of Polygon and MultiPolygon geometries, checking every ring
+// so a broken file fails at startup rather than when a quake is checked against it
+func loadGeofence(fileName string) (*geoFence, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var doc geoJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fileName, err)
+	}
+	fence := &geoFence{}
+	if err := fence.add(doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if len(fence.polygons) == 0 {
+		return nil, fmt.Errorf("%s contains no polygons", fileName)
+	}
+	return fence, nil
+}
+
+// add appends the polygons of a GeoJSON object to the fence
+func (f *geoFence) add(g geoJSON) error {
+	switch g.Type {
+	case "FeatureCollection":
+		for i, feature := range g.Features {
+			if err := f.add(feature); err != nil {
+				return fmt.Errorf("feature %d: %w", i, err)
+			}
+		}
+	case "Feature":
+		if g.Geometry == nil {
+			return errors.New("feature without geometry")
+		}
+		return f.add(*g.Geometry)
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		return f.addPolygon(rings)
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+		for i, rings := range polygons {
+			if err := f.addPolygon(rings); err != nil {
+				return fmt.Errorf("polygon %d: %w", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported GeoJSON type %q (expected Polygon, MultiPolygon, Feature or FeatureCollection)", g.Type)
+	}
+	return nil
+}
+
+// addPolygon validates the rings of one polygon, the first being the outer boundary and the rest holes
+func (f *geoFence) addPolygon(rings [][][]float64) error {
+	if len(rings) == 0 {
+		return errors.New("polygon without rings")
+	}
+	polygon := make([][][2]float64, 0, len(rings))
+	for i, ring := range rings {
+		if len(ring) < 4 {
+			return fmt.Errorf("ring %d has %d positions, at least 4 are needed", i, len(ring))
+		}
+		points := make([][2]float64, 0, len(ring))
+		for _, pos := range ring {
+			if len(pos) < 2 {
+				return fmt.Errorf("ring %d has a position without longitude and latitude", i)
+			}
+			lon, lat := pos[0], pos[1]
+			if lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+				return fmt.Errorf("ring %d has position [%g, %g] outside the valid range", i, lon, lat)
+			}
+			points = append(points, [2]float64{lon, lat})
+		}
+		if points[0] != points[len(points)-1] {
+			return fmt.Errorf("ring %d is not closed, its first and last positions differ", i)
+		}
+		polygon = append(polygon, points)
+	}
+	f.polygons = append(f.polygons, polygon)
+	return nil
+}
+
+// contains reports whether a point is inside any of the polygons and outside their holes.
+// Points on a boundary, of an outer ring or of a hole, count as inside.
+func (f *geoFence) contains(lat, lon float64) bool {
+	for _, polygon := range f.polygons {
+		if ringPosition(polygon[0], lat, lon) < 0 {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringPosition(hole, lat, lon) > 0 {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// ringPosition tells whether a point is inside (1), on the boundary (0) or outside (-1) a closed ring.
+// A ray is cast towards increasing longitude and its crossings with the edges counted.
+func ringPosition(ring [][2]float64, lat, lon float64) int {
+	inside := false
+	for i := 1; i < len(ring); i++ {
+		x1, y1 := ring[i-1][0], ring[i-1][1]
+		x2, y2 := ring[i][0], ring[i][1]
+		if onSegment(x1, y1, x2, y2, lon, lat) {
+			return 0
+		}
+		// half-open on latitude so a ray through a vertex is counted once
+		if (y1 > lat) != (y2 > lat) && lon < x1+(lat-y1)*(x2-x1)/(y2-y1) {
+			inside = !inside
+		}
+	}
+	if inside {
+		return 1
+	}
+	return -1
+}
+
+// onSegment reports whether (x, y) lies on the segment from (x1, y1) to (x2, y2)
+func onSegment(x1, y1, x2, y2, x, y float64) bool {
+	const epsilon = 1e-9
+	cross := (x2-x1)*(y-y1) - (y2-y1)*(x-x1)
+	if cross > epsilon || cross < -epsilon {
+		return false
+	}
+	return x >= math.Min(x1, x2)-epsilon && x <= math.Max(x1, x2)+epsilon &&
+		y >= math.Min(y1, y2)-epsilon && y <= math.Max(y1, y2)+epsilon
+}
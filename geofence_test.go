@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useGeofence loads a GeoJSON file of testdata as GEOFENCE_FILE for the duration of a test
+func useGeofence(t *testing.T, fileName string) *geoFence {
+	t.Helper()
+	fence, err := loadGeofence(fileName)
+	if err != nil {
+		t.Fatalf("loadGeofence: %v", err)
+	}
+	saved := geofence
+	geofence = fence
+	t.Cleanup(func() { geofence = saved })
+	return fence
+}
+
+func TestGeofenceContains(t *testing.T) {
+	fence := useGeofence(t, "testdata/geofence-with-hole.geojson")
+	tests := []struct {
+		name     string
+		lat, lon float64
+		inside   bool
+	}{
+		{"inside the square", 9.2, 124, true},
+		{"inside the hole", 10, 124, false},
+		{"on the edge of the hole", 10, 123.5, true},
+		{"on the outer edge", 9, 124, true},
+		{"on a corner", 11, 125, true},
+		{"north of the square", 12, 124, false},
+		{"just inside the east edge", 10, 124.99, true},
+		{"just outside the east edge", 10, 125.01, false},
+		// rays cast along an edge of the hole or through a vertex of the triangle
+		{"level with the top of the hole", 10.5, 123.2, true},
+		{"level with the triangle's apex", 8, 125.5, false},
+		{"inside the triangle", 7, 126.5, true},
+		{"between the polygons", 8, 125.7, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fence.contains(tt.lat, tt.lon); got != tt.inside {
+				t.Errorf("contains(%g, %g) = %v, want %v", tt.lat, tt.lon, got, tt.inside)
+			}
+		})
+	}
+}
+
+func TestGeofenceThreshold(t *testing.T) {
+	useGeofence(t, "testdata/geofence-with-hole.geojson")
+	useThresholds(t, 2, 5)
+	tests := []struct {
+		lat, lon string
+		want     float64
+	}{
+		{"09.20", "124.00", 2},
+		{"10.00", "124.00", 5},
+		{"10.00", "125.01", 5},
+		{"07.00", "126.50", 2},
+		{"N/A", "124.00", 5},
+	}
+	for _, tt := range tests {
+		if got := regionalThresholdFor(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("regionalThresholdFor(%s, %s) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
+
+func TestLoadGeofenceInvalid(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"not JSON", `{"type": "Polygon"`},
+		{"unsupported type", `{"type": "Point", "coordinates": [124, 10]}`},
+		{"feature without geometry", `{"type": "Feature", "properties": {}}`},
+		{"no polygons", `{"type": "FeatureCollection", "features": []}`},
+		{"polygon without rings", `{"type": "Polygon", "coordinates": []}`},
+		{"too few positions", `{"type": "Polygon", "coordinates": [[[123, 9], [125, 9], [123, 9]]]}`},
+		{"ring not closed", `{"type": "Polygon", "coordinates": [[[123, 9], [125, 9], [125, 11], [123, 11]]]}`},
+		{"position out of range", `{"type": "Polygon", "coordinates": [[[123, 9], [125, 95], [125, 11], [123, 9]]]}`},
+		{"position without latitude", `{"type": "Polygon", "coordinates": [[[123, 9], [125], [125, 11], [123, 9]]]}`},
+		{"invalid coordinates", `{"type": "MultiPolygon", "coordinates": [[[["123", "9"]]]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "fence.geojson")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadGeofence(fileName); err == nil {
+				t.Errorf("loadGeofence accepted %s", tt.content)
+			}
+		})
+	}
+	if _, err := loadGeofence(filepath.Join(t.TempDir(), "missing.geojson")); err == nil {
+		t.Error("loadGeofence accepted a missing file")
+	}
+}
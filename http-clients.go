@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// shared clients so connections are pooled across polls instead of re-handshaking every request
+var (
+	// client for PHIVOLCS pages, set up by initHTTPClients
+	scrapeClient *http.Client
+	// client for the Matrix API
+	matrixClient = &http.Client{Transport: newVerifyingTransport(), Timeout: 30 * time.Second}
+	// client for third-party APIs (e.g. USGS)
+	apiClient = &http.Client{Transport: newVerifyingTransport(), Timeout: 30 * time.Second}
+)
+
+// initHTTPClients builds the shared PHIVOLCS client, failing if the TLS configuration is invalid
+func initHTTPClients() error {
+	tr, err := newScrapeTransport()
+	if err != nil {
+		return err
+	}
+	// the client timeout covers connect, TLS handshake and reading the body
+	scrapeClient = &http.Client{Transport: tr, Timeout: fetchTimeout}
+	return nil
+}
+
+// tuneTransport applies the connection pooling and timeout settings shared by all transports
+func tuneTransport(tr *http.Transport) *http.Transport {
+	tr.DialContext = (&net.Dialer{Timeout: 15 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	tr.MaxIdleConns = 10
+	tr.MaxIdleConnsPerHost = 4
+	tr.IdleConnTimeout = 90 * time.Second
+	tr.TLSHandshakeTimeout = 10 * time.Second
+	tr.ResponseHeaderTimeout = 30 * time.Second
+	tr.ExpectContinueTimeout = 1 * time.Second
+	return tr
+}
+
+// newScrapeTransport builds the transport for PHIVOLCS requests, honoring the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables (socks5:// proxies included)
+func newScrapeTransport() (*http.Transport, error) {
+	tlsConfig, err := scrapeTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return tuneTransport(&http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}), nil
+}
+
+// newVerifyingTransport builds the transport for Matrix and other API requests, always
+// verifying TLS and honoring the proxy environment variables
+func newVerifyingTransport() *http.Transport {
+	return tuneTransport(&http.Transport{Proxy: http.ProxyFromEnvironment})
+}
+
+// scrapeTLSConfig builds the TLS configuration used when fetching PHIVOLCS pages.
+// Certificates are verified by default, PHIVOLCS_CA_FILE adds a CA bundle on top of
+// the system roots and PHIVOLCS_INSECURE_TLS=true skips verification entirely.
+func scrapeTLSConfig() (*tls.Config, error) {
+	if phivolcsInsecureTLS {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	if phivolcsCAFile == "" {
+		return &tls.Config{}, nil
+	}
+
+	pem, err := os.ReadFile(phivolcsCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PHIVOLCS_CA_FILE: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in PHIVOLCS_CA_FILE %s", phivolcsCAFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useScrapeTLS rebuilds the PHIVOLCS client with PHIVOLCS_CA_FILE and PHIVOLCS_INSECURE_TLS
+func useScrapeTLS(t *testing.T, caFile string, insecure bool) {
+	t.Helper()
+	savedCA, savedInsecure, savedClient := phivolcsCAFile, phivolcsInsecureTLS, scrapeClient
+	t.Cleanup(func() { phivolcsCAFile, phivolcsInsecureTLS, scrapeClient = savedCA, savedInsecure, savedClient })
+	phivolcsCAFile, phivolcsInsecureTLS = caFile, insecure
+	if err := initHTTPClients(); err != nil {
+		t.Fatalf("initHTTPClients: %v", err)
+	}
+}
+
+// selfSignedServer serves a minimal page over TLS with a self-signed certificate, returning
+// the server and a PEM file of its certificate
+func selfSignedServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body><p>ok</p></body></html>")
+	}))
+	t.Cleanup(srv.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return srv, caFile
+}
+
+func TestScrapeTLSVerification(t *testing.T) {
+	srv, caFile := selfSignedServer(t)
+	tests := []struct {
+		name     string
+		caFile   string
+		insecure bool
+		ok       bool
+	}{
+		{"verified by default", "", false, false},
+		{"PHIVOLCS_CA_FILE", caFile, false, true},
+		{"PHIVOLCS_INSECURE_TLS", "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useScrapeTLS(t, tt.caFile, tt.insecure)
+			_, err := fetchDocument(context.Background(), srv.URL)
+			if tt.ok && err != nil {
+				t.Errorf("fetchDocument: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("fetchDocument accepted a self-signed certificate")
+			}
+		})
+	}
+}
+
+func TestMatrixClientAlwaysVerifies(t *testing.T) {
+	srv, caFile := selfSignedServer(t)
+	useScrapeTLS(t, caFile, true)
+	resp, err := matrixClient.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Error("Matrix client accepted a self-signed certificate with PHIVOLCS_INSECURE_TLS set")
+	}
+}
+
+func TestScrapeTLSInvalidCAFile(t *testing.T) {
+	savedCA, savedInsecure := phivolcsCAFile, phivolcsInsecureTLS
+	t.Cleanup(func() { phivolcsCAFile, phivolcsInsecureTLS = savedCA, savedInsecure })
+	phivolcsInsecureTLS = false
+	for _, content := range []string{"", "not a certificate"} {
+		phivolcsCAFile = filepath.Join(t.TempDir(), "ca.pem")
+		if content != "" {
+			if err := os.WriteFile(phivolcsCAFile, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := scrapeTLSConfig(); err == nil {
+			t.Errorf("scrapeTLSConfig accepted PHIVOLCS_CA_FILE %q", content)
+		}
+	}
+}
+
+func TestTransportsHonorProxyEnvironment(t *testing.T) {
+	useScrapeTLS(t, "", false)
+	fromEnv := reflect.ValueOf(http.ProxyFromEnvironment).Pointer()
+	for name, client := range map[string]*http.Client{"PHIVOLCS": scrapeClient, "Matrix": matrixClient, "API": apiClient} {
+		tr, ok := client.Transport.(*http.Transport)
+		if !ok {
+			t.Errorf("%s client transport is %T", name, client.Transport)
+			continue
+		}
+		if tr.Proxy == nil || reflect.ValueOf(tr.Proxy).Pointer() != fromEnv {
+			t.Errorf("%s client ignores HTTP_PROXY/HTTPS_PROXY", name)
+		}
+	}
+}
+
+// hungServer accepts requests but never answers them before the client gives up
+func hungServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchDocumentTimeout(t *testing.T) {
+	srv := hungServer(t)
+	savedTimeout := fetchTimeout
+	t.Cleanup(func() { fetchTimeout = savedTimeout })
+	fetchTimeout = 100 * time.Millisecond
+	useScrapeTLS(t, "", false)
+
+	start := time.Now()
+	if _, err := fetchDocument(context.Background(), srv.URL); err == nil {
+		t.Fatal("fetchDocument of a hung server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetchDocument gave up after %s, FETCH_TIMEOUT is %s", elapsed, fetchTimeout)
+	}
+}
+
+func TestFetchDocumentCanceled(t *testing.T) {
+	srv := hungServer(t)
+	useScrapeTLS(t, "", false)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := fetchDocument(ctx, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("fetchDocument = %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetchDocument returned %s after the context ended", elapsed)
+	}
+}
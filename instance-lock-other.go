@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "log"
+
+// tryLockFile is a no-op where flock isn't available
+func tryLockFile(path string) (func(), error) {
+	log.Printf("⚠️ Instance locking is not supported on this platform, make sure only one instance uses %s", stateDir)
+	return func() {}, nil
+}
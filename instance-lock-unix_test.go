@@ -0,0 +1,60 @@
+//go:build unix
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// useLockWait sets LOCK_WAIT for the duration of a test
+func useLockWait(t *testing.T, d time.Duration) {
+	t.Helper()
+	saved := lockWait
+	lockWait = d
+	t.Cleanup(func() { lockWait = saved })
+}
+
+func TestInstanceLockBlocksSecondInstance(t *testing.T) {
+	useTempState(t)
+	useLockWait(t, 0)
+	release, err := acquireInstanceLock()
+	if err != nil {
+		t.Fatalf("first instance: %v", err)
+	}
+	defer release()
+
+	_, err = acquireInstanceLock()
+	if err == nil || !strings.Contains(err.Error(), "another instance is already running") {
+		t.Fatalf("second instance got %v, want it blocked", err)
+	}
+
+	// released on shutdown, the next instance takes over
+	release()
+	second, err := acquireInstanceLock()
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	second()
+}
+
+func TestInstanceLockWaits(t *testing.T) {
+	useTempState(t)
+	first, err := acquireInstanceLock()
+	if err != nil {
+		t.Fatalf("first instance: %v", err)
+	}
+	time.AfterFunc(200*time.Millisecond, first)
+
+	useLockWait(t, 5*time.Second)
+	start := time.Now()
+	second, err := acquireInstanceLock()
+	if err != nil {
+		t.Fatalf("second instance within LOCK_WAIT: %v", err)
+	}
+	defer second()
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("second instance got the lock after %s, before the first released it", elapsed)
+	}
+}
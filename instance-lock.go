@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// file in STATE_DIR locked while an instance runs
+const LOCK_FILE = "phivolcs-eq.lock"
+
+// errLockHeld is returned by tryLockFile when another process holds the lock
+var errLockHeld = errors.New("lock held by another process")
+
+// acquireInstanceLock takes the exclusive lock on the lock file in STATE_DIR so two instances never
+// interleave writes to the same state. When it is held, waits up to LOCK_WAIT (0 fails right away).
+// The lock dies with the process, so a crashed instance never leaves a stale lock behind.
+// Returns a function releasing it.
+func acquireInstanceLock() (func(), error) {
+	path := statePath(LOCK_FILE)
+	deadline := time.Now().Add(lockWait)
+	logged := false
+	for {
+		release, err := tryLockFile(path)
+		if err == nil {
+			return release, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("another instance is already running with STATE_DIR %s (%s is locked)", stateDir, path)
+		}
+		if !logged {
+			log.Printf("⏳ Another instance holds %s, waiting up to %s", path, lockWait)
+			logged = true
+		}
+		time.Sleep(time.Second)
+	}
+}
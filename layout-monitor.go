@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNoRowsParsed is returned when the quake table was found but yielded no quakes
+var ErrNoRowsParsed = errors.New("no quakes parsed")
+
+// title of the last fetched PHIVOLCS front page, included in layout alerts to aid debugging
+var lastPageTitle string
+
+// layoutMonitor tells a broken parser apart from a quiet period, alerting the operator when
+// the page keeps parsing to nothing or the freshest quake gets stale, and clearing once parsing works again
+type layoutMonitor struct {
+	// consecutive cycles where the page was fetched but no quakes were parsed
+	emptyCycles int
+	// reason of the alert that was sent, empty while healthy
+	alertReason string
+}
+
+var layout = &layoutMonitor{}
+
+// pageTitle returns the <title> of a page, truncated to 500 bytes
+func pageTitle(doc *goquery.Document) string {
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	if len(title) > 500 {
+		title = strings.ToValidUTF8(title[:500], "")
+	}
+	return title
+}
+
+// parseFailed records a cycle where PHIVOLCS answered but the quake table was missing or empty
+func (m *layoutMonitor) parseFailed(err error) {
+	m.emptyCycles++
+	if m.emptyCycles >= layoutAlertCycles {
+		m.alert(fmt.Sprintf("no quakes parsed for %d consecutive cycles: %v", m.emptyCycles, err))
+	}
+}
+
+// parsed records a cycle that yielded quakes, alerting if even the freshest one is stale
+func (m *layoutMonitor) parsed(quakes []Quake) {
+	m.emptyCycles = 0
+
+	var freshest time.Time
+	for _, q := range quakes {
+		if q.OccurredAt.After(freshest) {
+			freshest = q.OccurredAt
+		}
+	}
+	if age := time.Since(freshest); !freshest.IsZero() && age > staleAfter {
+		m.alert(fmt.Sprintf("freshest parsed quake (%s) is %s old", freshest.Format(DATE_TIME_LAYOUT), age.Round(time.Minute)))
+		return
+	}
+	m.recover()
+}
+
+// alert notifies the operator once per outage, in MATRIX_ADMIN_ROOM_ID if set and in the log regardless
+func (m *layoutMonitor) alert(reason string) {
+	if m.alertReason != "" {
+		return
+	}
+	m.alertReason = reason
+	status.setLayoutAlert(reason)
+	log.Printf("❌ PHIVOLCS layout check failed, the page layout may have changed: %s (page title: %q)", reason, lastPageTitle)
+
+	msg := fmt.Sprintf("⚠️ PHIVOLCS layout check failed\n%s\nPage title: %s", reason, lastPageTitle)
+	formatted := fmt.Sprintf("⚠️ <b>PHIVOLCS layout check failed</b><br>%s<br>Page title: <code>%s</code>",
+		html.EscapeString(reason), html.EscapeString(lastPageTitle))
+	notifyAdmin(msg, formatted)
+}
+
+// recover clears a previous alert and tells the operator parsing works again
+func (m *layoutMonitor) recover() {
+	if m.alertReason == "" {
+		return
+	}
+	m.alertReason = ""
+	status.setLayoutAlert("")
+	log.Println("✅ PHIVOLCS layout check recovered, quakes are being parsed again")
+
+	msg := "✅ PHIVOLCS layout check recovered, quakes are being parsed again"
+	notifyAdmin(msg, msg)
+}
+
+// notifyAdmin sends an operator message to MATRIX_ADMIN_ROOM_ID, the log has to do when it is not set
+func notifyAdmin(msg, formatted string) {
+	if matrixAdminRoomID == "" {
+		return
+	}
+	if _, err := sendMatrixMessage(context.Background(), matrixAdminRoomID, msg, formatted, ""); err != nil {
+		log.Printf("Matrix admin alert failed: %v", err)
+	}
+}
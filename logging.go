@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+// setupLogging installs the slog handler selected by LOG_FORMAT and LOG_LEVEL as the default logger.
+// The text format keeps the classic "2006/01/02 15:04:05 file.go:123: message" lines with structured fields appended,
+// json writes one object per line for log shippers. Plain log.Printf calls are routed through the same
+// handler, graded by their leading ⚠️/❌ marker.
+func setupLogging() {
+	level, ok := parseLogLevel(strings.ToLower(logLevel))
+	if !ok {
+		log.Printf("⚠️ Invalid LOG_LEVEL value (%s), using default info", logLevel)
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(logFormat) {
+	case LOG_FORMAT_JSON:
+		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level, AddSource: true})
+	default:
+		if !strings.EqualFold(logFormat, LOG_FORMAT_TEXT) {
+			log.Printf("⚠️ Invalid LOG_FORMAT value (%s), using default text", logFormat)
+		}
+		h = &textHandler{w: os.Stderr, level: level, mu: &sync.Mutex{}}
+	}
+
+	slog.SetDefault(slog.New(h))
+	// slog.SetDefault routes the log package into h at info level, grade the lines ourselves instead
+	log.SetFlags(log.Lshortfile)
+	log.SetOutput(legacyLogWriter{h})
+}
+
+// parseLogLevel maps debug/info/warn/error to a slog level, falling back to info
+func parseLogLevel(s string) (slog.Level, bool) {
+	switch s {
+	case "debug":
+		return slog.LevelDebug, true
+	case "", "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+// legacyLogWriter forwards log.Printf output to a slog handler, deriving the level from the emoji prefix.
+// The "file.go:123: " prefix written by log.Lshortfile becomes the record's source.
+type legacyLogWriter struct {
+	h slog.Handler
+}
+
+func (w legacyLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	source := ""
+	if file, rest, ok := strings.Cut(msg, ": "); ok && strings.Contains(file, ".go:") {
+		source, msg = file, rest
+	}
+	level := slog.LevelInfo
+	switch {
+	case strings.HasPrefix(msg, "❌"):
+		level = slog.LevelError
+	case strings.HasPrefix(msg, "⚠️"):
+		level = slog.LevelWarn
+	}
+	if !w.h.Enabled(context.Background(), level) {
+		return len(p), nil
+	}
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	if source != "" {
+		r.AddAttrs(slog.String(slog.SourceKey, source))
+	}
+	if err := w.h.Handle(context.Background(), r); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// textHandler writes records in the shape of the standard log package, with attributes as key=value
+type textHandler struct {
+	w      io.Writer
+	level  slog.Leveler
+	mu     *sync.Mutex
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	buf.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	if r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		fmt.Fprintf(&buf, "%s:%d: ", filepath.Base(f.File), f.Line)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == slog.SourceKey {
+			buf.WriteString(a.Value.String() + ": ")
+		}
+		return true
+	})
+	buf.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeTextAttr(&buf, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != slog.SourceKey {
+			writeTextAttr(&buf, h.prefix, a)
+		}
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+	}
+	return &h2
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// writeTextAttr appends " key=value", quoting values with spaces and flattening groups
+func writeTextAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeTextAttr(buf, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	val := a.Value.String()
+	if val == "" || strings.ContainsAny(val, " \t\n\"=") {
+		val = fmt.Sprintf("%q", val)
+	}
+	fmt.Fprintf(buf, " %s%s=%s", prefix, a.Key, val)
+}
+
+// quakeLogAttrs are the structured fields identifying a quake in log lines
+func quakeLogAttrs(q Quake) []any {
+	attrs := []any{"quake_key", quakeLocationKey(q), "magnitude", q.Magnitude}
+	if n, _, ok := getBulletinNumber(q.Bulletin); ok {
+		attrs = append(attrs, "bulletin_no", n)
+	}
+	return attrs
+}
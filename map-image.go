@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg" // decoders for the dimensions of the downloaded map
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// static map centered on a quake, {lat}, {lon} and {key} are replaced when fetching
+	DEFAULT_MAP_IMAGE_URL = "https://maps.geoapify.com/v1/staticmap?style=osm-bright&width=600&height=400&center=lonlat:{lon},{lat}&zoom=7&marker=lonlat:{lon},{lat};color:%23ff0000;size:large&apiKey={key}"
+	// largest map image downloaded and uploaded to Matrix
+	MAX_MAP_IMAGE_BYTES = 5 << 20
+)
+
+// mapImageURL fills MAP_IMAGE_URL with the coordinates of a quake and MAP_IMAGE_API_KEY
+func mapImageURL(lat, lon float64) string {
+	return strings.NewReplacer(
+		"{lat}", strconv.FormatFloat(lat, 'f', -1, 64),
+		"{lon}", strconv.FormatFloat(lon, 'f', -1, 64),
+		"{key}", url.QueryEscape(mapImageAPIKey),
+	).Replace(mapImageURLTemplate)
+}
+
+// attachMapImage posts a static map of a quake to the room as an m.image reply to its alert.
+// Failures are only logged, the alert itself was already delivered.
+func attachMapImage(ctx context.Context, roomID, replyTo string, q Quake) {
+	lat, lon, ok := quakeCoords(q)
+	if !ok {
+		return
+	}
+	imageURL := mapImageURL(lat, lon)
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would attach the map image of %s | M%s to Matrix room %s", q.DateTime, q.Magnitude, roomID)
+		return
+	}
+
+	data, contentType, err := downloadMapImage(ctx, imageURL)
+	if err != nil {
+		log.Printf("⚠️ Failed to download the map image: %v", err)
+		return
+	}
+	ext, _, _ := strings.Cut(strings.TrimPrefix(contentType, "image/"), ";")
+	mxcURI, err := uploadMatrixMedia(ctx, data, contentType, "quake-map."+ext)
+	if err != nil {
+		log.Printf("⚠️ Failed to upload the map image to Matrix: %v", err)
+		return
+	}
+
+	info := map[string]any{"mimetype": contentType, "size": len(data)}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info["w"], info["h"] = cfg.Width, cfg.Height
+	}
+	body := fmt.Sprintf("Map of the M%s quake, %s", q.Magnitude, buildCoordinates(q.Latitude, q.Longitude))
+	payload := map[string]any{
+		"msgtype": "m.image",
+		"body":    body,
+		"url":     mxcURI,
+		"info":    info,
+	}
+	if replyTo != "" {
+		payload["m.relates_to"] = map[string]any{
+			"m.in_reply_to": map[string]string{"event_id": replyTo},
+		}
+	}
+	if _, err := sendMatrixEvent(ctx, roomID, body, payload); err != nil {
+		log.Printf("⚠️ Failed to send the map image: %v", err)
+	}
+}
+
+// downloadMapImage fetches a static map, returning the image and its content type
+func downloadMapImage(ctx context.Context, imageURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", USER_AGENT)
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("http get error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status not OK: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MAX_MAP_IMAGE_BYTES+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the image: %w", err)
+	}
+	if len(data) > MAX_MAP_IMAGE_BYTES {
+		return nil, "", fmt.Errorf("image is larger than %d bytes", MAX_MAP_IMAGE_BYTES)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("response is %s, not an image", contentType)
+	}
+	return data, contentType, nil
+}
+
+// uploadMatrixMedia uploads a file to the homeserver's media repository and returns its mxc:// URI
+func uploadMatrixMedia(ctx context.Context, data []byte, contentType, fileName string) (string, error) {
+	uploadURL := fmt.Sprintf("%s/_matrix/media/v3/upload?filename=%s",
+		strings.TrimRight(matrixBaseURL, "/"), url.QueryEscape(fileName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := matrixClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("http post error: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("Matrix API error: %s", string(bytes.TrimSpace(body)))
+	}
+
+	var uploaded struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := json.Unmarshal(body, &uploaded); err != nil || uploaded.ContentURI == "" {
+		return "", fmt.Errorf("unexpected upload response: %s", string(bytes.TrimSpace(body)))
+	}
+	return uploaded.ContentURI, nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mention notifying the whole room, added to alerts reaching MENTION_ROOM_MAGNITUDE
+const ROOM_MENTION = "@room"
+
+// time of the last Matrix send, used to space out posts
+var lastMatrixPost time.Time
+
+// number of messages (to any notifier) that failed to deliver after all retries, for the -once exit code
+var sendFailures int
+
+// ---- Matrix posting ----
+// matrixNotifier posts alerts to a Matrix room
+type matrixNotifier struct {
+	roomID string
+}
+
+func (n matrixNotifier) String() string { return NOTIFIER_MATRIX }
+
+func (n matrixNotifier) Notify(plain, html string) error {
+	_, err := sendMatrixMessage(context.Background(), n.roomID, plain, html, "")
+	return err
+}
+
+// notifyThreaded posts a message as a reply to rootID, or edits rootID in place when edit is set,
+// and returns the event ID of the sent message. An empty rootID posts a standalone message.
+func (n matrixNotifier) notifyThreaded(ctx context.Context, plain, html, rootID string, edit bool) (string, error) {
+	if edit {
+		return editMatrixMessage(ctx, n.roomID, rootID, plain, html)
+	}
+	return sendMatrixMessage(ctx, n.roomID, plain, html, rootID)
+}
+
+// findPostedOriginal looks up the posted record of the alert a revision follows up on,
+// first by the previous bulletin and then by location key
+func findPostedOriginal(postedQuakes map[string]PostedQuake, oldQuake Quake) PostedQuake {
+	for _, postQ := range postedQuakes {
+		if isKnownBulletin(oldQuake, postQ.Quake) {
+			return postQ
+		}
+	}
+	return postedQuakes[quakeLocationKey(oldQuake)]
+}
+
+// threadRootID returns the event ID of the initial alert of a posted quake, empty if unknown
+func threadRootID(posted PostedQuake) string {
+	if posted.ThreadRootID != "" {
+		return posted.ThreadRootID
+	}
+	return posted.EventID
+}
+
+// withRoomMention prefixes a message with @room so it notifies everyone in the room
+func withRoomMention(msg, formatted string) (string, string) {
+	return ROOM_MENTION + " " + msg, ROOM_MENTION + " " + formatted
+}
+
+// shouldMentionRoom reports whether an alert reaches MENTION_ROOM_MAGNITUDE, for updates only when
+// the revision is the one crossing it so the room isn't pinged twice for the same quake
+func shouldMentionRoom(q Quake, updated bool, old Quake) bool {
+	if mentionRoomMagnitude <= 0 || !q.MagnitudeOK || q.MagnitudeValue < mentionRoomMagnitude {
+		return false
+	}
+	return !updated || !old.MagnitudeOK || old.MagnitudeValue < mentionRoomMagnitude
+}
+
+// matrixMessageContent builds the m.room.message content of a plain/HTML message. Messages starting
+// with an @room mention also carry it in m.mentions for clients using intentional mentions.
+func matrixMessageContent(msg, formatted string) map[string]any {
+	var content map[string]any
+	if plainOnly {
+		// omit the HTML entirely so bridges don't show raw tags
+		body := stripLeadingEmoji(msg)
+		if rest, ok := strings.CutPrefix(msg, ROOM_MENTION+" "); ok {
+			body = ROOM_MENTION + " " + stripLeadingEmoji(rest)
+		}
+		content = map[string]any{
+			"msgtype": "m.text",
+			"body":    body,
+		}
+	} else {
+		content = map[string]any{
+			"msgtype":        "m.text",
+			"body":           msg,
+			"format":         "org.matrix.custom.html",
+			"formatted_body": formatted,
+		}
+	}
+	if strings.HasPrefix(msg, ROOM_MENTION+" ") {
+		content["m.mentions"] = map[string]any{"room": true}
+	}
+	return content
+}
+
+// sendMatrixMessage posts a plain/HTML message to a Matrix room, retrying with backoff.
+// A non-empty replyTo makes the message a reply to that event. Returns the new event ID.
+func sendMatrixMessage(ctx context.Context, roomID, msg, formatted, replyTo string) (string, error) {
+	payload := matrixMessageContent(msg, formatted)
+	if replyTo != "" {
+		payload["m.relates_to"] = map[string]any{
+			"m.in_reply_to": map[string]string{"event_id": replyTo},
+		}
+	}
+	return sendMatrixEvent(ctx, roomID, msg, payload)
+}
+
+// editMatrixMessage replaces the content of an earlier message with an m.replace edit,
+// clients without edit support show the "* "-prefixed fallback instead. Returns the edit's event ID.
+func editMatrixMessage(ctx context.Context, roomID, eventID, msg, formatted string) (string, error) {
+	payload := matrixMessageContent("* "+msg, "* "+formatted)
+	payload["m.new_content"] = matrixMessageContent(msg, formatted)
+	payload["m.relates_to"] = map[string]string{
+		"rel_type": "m.replace",
+		"event_id": eventID,
+	}
+	return sendMatrixEvent(ctx, roomID, msg, payload)
+}
+
+// sendMatrixEvent sends an m.room.message event with the given content, retrying with backoff.
+// msg is only used for the dry-run log. Cancelling ctx aborts the request and any wait between attempts.
+func sendMatrixEvent(ctx context.Context, roomID, msg string, payload map[string]any) (eventID string, err error) {
+	// last HTTP status code for the metrics, "none" when no response arrived
+	code := "none"
+	start := time.Now()
+	defer func() {
+		if dryRun {
+			return
+		}
+		metricPostDuration.observe(time.Since(start))
+		if err != nil {
+			sendFailures++
+			metricMatrixPosts.inc("error", code)
+		} else {
+			metricMatrixPosts.inc("ok", code)
+		}
+	}()
+
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would post to Matrix room %s:\n%s", roomID, msg)
+		if html, ok := payload["formatted_body"].(string); ok {
+			log.Printf("🧪 [dry-run] HTML body:\n%s", html)
+		}
+		return "", nil
+	}
+
+	if matrixBaseURL == "" || roomID == "" || accessToken == "" {
+		return "", fmt.Errorf("missing Matrix environment variables")
+	}
+
+	txnId := fmt.Sprintf("%d", time.Now().UnixNano()/1e6) // unique transaction ID in ms
+
+	matrixURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(matrixBaseURL, "/"),
+		url.PathEscape(roomID),
+		url.PathEscape(txnId),
+	)
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %v", err)
+	}
+
+	waitForPostSlot(ctx)
+
+	var resp *http.Response
+	var body []byte
+	var lastErr error
+
+	attempt := 1
+	for ; ; attempt++ {
+		// build a fresh request (and body reader) per attempt, a consumed body
+		// from a failed attempt must never be resent empty
+		req, err := http.NewRequestWithContext(ctx, "PUT", matrixURL, bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err = matrixClient.Do(req)
+		if err != nil {
+			slog.Warn("Matrix send attempt failed (network error)", "attempt", attempt, "error", err)
+			lastErr = err
+		} else {
+			body, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			code = strconv.Itoa(resp.StatusCode)
+			lastErr = nil // report the latest HTTP error rather than an earlier network error
+
+			if resp.StatusCode < 300 {
+				var sent struct {
+					EventID string `json:"event_id"`
+				}
+				if err := json.Unmarshal(body, &sent); err != nil {
+					log.Printf("⚠️ Failed to parse Matrix send response: %v", err)
+				}
+				return sent.EventID, nil // success
+			}
+
+			slog.Warn("Matrix send attempt failed",
+				"attempt", attempt, "http_status", resp.StatusCode, "body", string(bytes.TrimSpace(body)))
+
+			if resp.StatusCode == http.StatusTooManyRequests {
+				if delay, ok := retryAfterDelay(resp, body); ok {
+					if attempt >= matrixMaxRetries {
+						break
+					}
+					if delay > matrixMaxRetryAfter {
+						slog.Warn(fmt.Sprintf("Matrix asked to wait %s, clamping to MATRIX_MAX_RETRY_AFTER %s", delay, matrixMaxRetryAfter),
+							"attempt", attempt, "http_status", resp.StatusCode)
+						delay = matrixMaxRetryAfter
+					}
+					slog.Warn(fmt.Sprintf("Matrix rate limited, retrying after %s", delay), "attempt", attempt, "http_status", resp.StatusCode)
+					if err := sleepCtx(ctx, delay); err != nil {
+						return "", err
+					}
+					continue
+				}
+			}
+		}
+
+		if attempt >= matrixMaxRetries {
+			break
+		}
+		if err := sleepCtx(ctx, time.Duration(attempt*attempt)*matrixRetryBackoff); err != nil { // backoff
+			return "", err
+		}
+	}
+
+	if lastErr != nil {
+		return "", fmt.Errorf("Matrix request failed after %d attempts: %v", attempt, lastErr)
+	}
+	return "", fmt.Errorf("Matrix API error after %d attempts: %s", attempt, string(body))
+}
+
+// waitForPostSlot sleeps until MIN_POST_INTERVAL_MS has passed since the previous post,
+// so swarms of alerts don't run into the homeserver's rate limits. Returns early when ctx is cancelled.
+func waitForPostSlot(ctx context.Context) {
+	interval := time.Duration(minPostIntervalMs) * time.Millisecond
+	sleepCtx(ctx, time.Until(lastMatrixPost.Add(interval)))
+	lastMatrixPost = time.Now()
+}
+
+// sleepCtx sleeps for d, returning ctx's error early when it is cancelled
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfterDelay returns how long a 429 asks us to wait, preferring the retry_after_ms
+// field of the Matrix error body over the Retry-After header (in seconds or as an HTTP date)
+func retryAfterDelay(resp *http.Response, body []byte) (time.Duration, bool) {
+	var matrixErr struct {
+		RetryAfterMs *int64 `json:"retry_after_ms"`
+	}
+	if json.Unmarshal(body, &matrixErr) == nil && matrixErr.RetryAfterMs != nil && *matrixErr.RetryAfterMs >= 0 {
+		return time.Duration(*matrixErr.RetryAfterMs) * time.Millisecond, true
+	}
+
+	val := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if val == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// matrixRequest is a request received by the fake homeserver
+type matrixRequest struct {
+	method, path, auth string
+	content            map[string]any
+}
+
+// fakeHomeserver mimics the Matrix send endpoint, failing the first failures requests with a 500,
+// or with a 429 asking to wait retryAfterMs when it is set
+type fakeHomeserver struct {
+	mu           sync.Mutex
+	failures     int
+	retryAfterMs int64
+	requests     []matrixRequest
+}
+
+func (h *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := matrixRequest{method: r.Method, path: r.URL.Path, auth: r.Header.Get("Authorization")}
+	_ = json.Unmarshal(body, &req.content)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, req)
+	if len(h.requests) <= h.failures && h.retryAfterMs > 0 {
+		http.Error(w, `{"errcode":"M_LIMIT_EXCEEDED","retry_after_ms":`+strconv.FormatInt(h.retryAfterMs, 10)+`}`, http.StatusTooManyRequests)
+		return
+	}
+	if len(h.requests) <= h.failures {
+		http.Error(w, `{"errcode":"M_UNKNOWN","error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"event_id":"$event` + strconv.Itoa(len(h.requests)) + `"}`))
+}
+
+// useHomeserver points the Matrix settings at a fake homeserver, with fast retries
+func useHomeserver(t *testing.T, failures int) *fakeHomeserver {
+	t.Helper()
+	h := &fakeHomeserver{failures: failures}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	useMatrixConfig(t, srv.URL, "!room:example.org", "secret-token")
+
+	savedDryRun, savedPlain, savedInterval := dryRun, plainOnly, minPostIntervalMs
+	savedRetries, savedBackoff, savedFailures := matrixMaxRetries, matrixRetryBackoff, sendFailures
+	savedRetryAfter := matrixMaxRetryAfter
+	t.Cleanup(func() {
+		dryRun, plainOnly, minPostIntervalMs = savedDryRun, savedPlain, savedInterval
+		matrixMaxRetries, matrixRetryBackoff, sendFailures = savedRetries, savedBackoff, savedFailures
+		matrixMaxRetryAfter = savedRetryAfter
+	})
+	dryRun, plainOnly, minPostIntervalMs = false, false, 0
+	matrixMaxRetries, matrixRetryBackoff = 3, time.Millisecond
+	return h
+}
+
+func TestSendMatrixMessage(t *testing.T) {
+	q := bulletinQuake("B2")
+	old := bulletinQuake("B1")
+	old.Magnitude = "3.6"
+	old = withDerivedFields(old)
+
+	tests := []struct {
+		name    string
+		updated bool
+		old     Quake
+	}{
+		{"new quake", false, Quake{}},
+		{"updated quake", true, old},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := useHomeserver(t, 0)
+			msg, formatted := formatMatrixMsg(tt.updated, tt.old, q, "")
+			eventID, err := sendMatrixMessage(context.Background(), matrixRoomID, msg, formatted, "")
+			if err != nil {
+				t.Fatalf("sendMatrixMessage: %v", err)
+			}
+			if eventID != "$event1" {
+				t.Errorf("event ID = %q, want $event1", eventID)
+			}
+			if len(h.requests) != 1 {
+				t.Fatalf("%d requests, want 1", len(h.requests))
+			}
+			req := h.requests[0]
+			if req.method != http.MethodPut {
+				t.Errorf("method = %s, want PUT", req.method)
+			}
+			if prefix := "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/"; !strings.HasPrefix(req.path, prefix) || len(req.path) == len(prefix) {
+				t.Errorf("path = %s, want %s<txn>", req.path, prefix)
+			}
+			if req.auth != "Bearer secret-token" {
+				t.Errorf("Authorization = %q", req.auth)
+			}
+			want := map[string]any{
+				"msgtype":        "m.text",
+				"body":           msg,
+				"format":         "org.matrix.custom.html",
+				"formatted_body": formatted,
+			}
+			for key, val := range want {
+				if req.content[key] != val {
+					t.Errorf("%s = %v, want %v", key, req.content[key], val)
+				}
+			}
+			if tt.updated && !strings.Contains(formatted, "3.6") {
+				t.Errorf("update does not mention the previous magnitude:\n%s", formatted)
+			}
+		})
+	}
+}
+
+func TestSendMatrixMessageRetries(t *testing.T) {
+	h := useHomeserver(t, 1)
+	if _, err := sendMatrixMessage(context.Background(), matrixRoomID, "plain", "<b>html</b>", ""); err != nil {
+		t.Fatalf("sendMatrixMessage after a 500: %v", err)
+	}
+	if len(h.requests) != 2 {
+		t.Fatalf("%d requests, want a retry after the 500", len(h.requests))
+	}
+	// the retry resends the same body
+	if h.requests[1].content["formatted_body"] != "<b>html</b>" {
+		t.Errorf("retry sent %v", h.requests[1].content)
+	}
+
+	h = useHomeserver(t, 10)
+	if _, err := sendMatrixMessage(context.Background(), matrixRoomID, "plain", "<b>html</b>", ""); err == nil {
+		t.Fatal("sendMatrixMessage succeeded although every attempt failed")
+	}
+	if len(h.requests) != matrixMaxRetries {
+		t.Errorf("%d requests, want MATRIX_MAX_RETRIES %d", len(h.requests), matrixMaxRetries)
+	}
+}
+
+func TestSendMatrixMessageCancelled(t *testing.T) {
+	h := useHomeserver(t, 10)
+	matrixRetryBackoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := sendMatrixMessage(ctx, matrixRoomID, "plain", "<b>html</b>", "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("sendMatrixMessage = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled send returned after %s", elapsed)
+	}
+	if len(h.requests) != 1 {
+		t.Errorf("%d requests, want none after the cancelled backoff", len(h.requests))
+	}
+}
+
+func TestSendMatrixMessageClampsRetryAfter(t *testing.T) {
+	h := useHomeserver(t, 1)
+	h.retryAfterMs = time.Hour.Milliseconds()
+	matrixMaxRetryAfter = 10 * time.Millisecond
+
+	start := time.Now()
+	if _, err := sendMatrixMessage(context.Background(), matrixRoomID, "plain", "<b>html</b>", ""); err != nil {
+		t.Fatalf("sendMatrixMessage after a 429: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("an hour long Retry-After was waited for %s, want it clamped", elapsed)
+	}
+	if len(h.requests) != 2 {
+		t.Errorf("%d requests, want a retry after the 429", len(h.requests))
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// languages of the alert messages, combined with "+" in MESSAGE_LANG for multilingual messages
+const (
+	LANG_EN  = "en"
+	LANG_FIL = "fil"
+)
+
+// separators between the languages of a multilingual message
+const (
+	LANG_DIVIDER_PLAIN = "\n\n— — —\n\n"
+	LANG_DIVIDER_HTML  = "<hr>"
+)
+
+// messageCatalog holds the fixed strings of the alert messages by language and message ID, so adding
+// a language only takes a new entry. Strings missing from a language fall back to English.
+var messageCatalog = map[string]map[string]string{
+	LANG_EN: {
+		"alert.light":     "Light Earthquake Alert!",
+		"alert.moderate":  "Moderate Earthquake Alert!",
+		"alert.strong":    "Strong Earthquake Alert!",
+		"update.title":    "Earthquake Bulletin Update!",
+		"datetime":        "Date & Time",
+		"location":        "Location",
+		"location.new":    "New Location",
+		"location.prev":   "Previous",
+		"location.old":    "Old",
+		"magnitude":       "Magnitude",
+		"depth":           "Depth",
+		"coordinates":     "Coordinates",
+		"bulletin":        "Bulletin",
+		"bulletin.link":   "View PHIVOLCS report",
+		"update.revised":  "Revised by PHIVOLCS",
+		"update.final":    "Final",
+		"alert.stay_safe": "Stay safe!",
+		"ref":             "Ref",
+		"quiet.title":     "%d earthquakes were held during quiet hours",
+		"quiet.title.one": "1 earthquake was held during quiet hours",
+		"quiet.revised":   "revised",
+	},
+	LANG_FIL: {
+		"alert.light":     "Babala: Mahinang Lindol!",
+		"alert.moderate":  "Babala: Katamtamang Lindol!",
+		"alert.strong":    "Babala: Malakas na Lindol!",
+		"update.title":    "Update sa Ulat ng Lindol!",
+		"datetime":        "Petsa at Oras",
+		"location":        "Lokasyon",
+		"location.new":    "Bagong Lokasyon",
+		"location.prev":   "Dati",
+		"location.old":    "Dati",
+		"magnitude":       "Magnitude",
+		"depth":           "Lalim",
+		"coordinates":     "Koordinado",
+		"bulletin":        "Bulletin",
+		"bulletin.link":   "Tingnan ang ulat ng PHIVOLCS",
+		"update.revised":  "Binago ng PHIVOLCS",
+		"update.final":    "Huling Ulat",
+		"alert.stay_safe": "Mag-ingat po!",
+		"ref":             "Sanggunian",
+		"quiet.title":     "%d lindol ang hindi muna inianunsyo habang quiet hours",
+		"quiet.title.one": "1 lindol ang hindi muna inianunsyo habang quiet hours",
+		"quiet.revised":   "binago",
+	},
+}
+
+// parseMessageLangs splits MESSAGE_LANG, e.g. "en+fil", into the catalog languages in order
+func parseMessageLangs(spec string) ([]string, error) {
+	var langs []string
+	seen := map[string]bool{}
+	for _, lang := range strings.Split(spec, "+") {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if _, ok := messageCatalog[lang]; !ok {
+			return nil, fmt.Errorf("MESSAGE_LANG %q: unknown language %q (expected en, fil or both joined with +)", spec, lang)
+		}
+		if !seen[lang] {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+	return langs, nil
+}
+
+// messageLangs returns the languages alerts are written in, English when MESSAGE_LANG is invalid
+func messageLangs() []string {
+	langs, err := parseMessageLangs(messageLang)
+	if err != nil {
+		// rejected by validateConfig, only reachable if it was skipped
+		return []string{LANG_EN}
+	}
+	return langs
+}
+
+// tr returns the string of a message ID in a language
+func tr(lang, id string) string {
+	if s, ok := messageCatalog[lang][id]; ok {
+		return s
+	}
+	return messageCatalog[LANG_EN][id]
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of testdata/golden")
+
+// useMessageLang sets MESSAGE_LANG for the duration of a test
+func useMessageLang(t *testing.T, spec string) {
+	t.Helper()
+	saved := messageLang
+	messageLang = spec
+	t.Cleanup(func() { messageLang = saved })
+}
+
+// checkGolden compares got with the file of testdata/golden, rewriting it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	fileName := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		if err := os.WriteFile(fileName, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestFormatMatrixMsgGolden(t *testing.T) {
+	savedLat, savedLon, savedName, savedShow, savedDisplay := refPointLat, refPointLon, refPointName, showAlertDistance, distanceDisplayRadiusKm
+	t.Cleanup(func() {
+		refPointLat, refPointLon, refPointName, showAlertDistance, distanceDisplayRadiusKm = savedLat, savedLon, savedName, savedShow, savedDisplay
+	})
+	refPointLat, refPointLon, refPointName, showAlertDistance, distanceDisplayRadiusKm = 10.3157, 123.8854, "Cebu City", false, 0
+
+	q := bulletinQuake("B3F")
+	old := bulletinQuake("B1")
+	old.Magnitude, old.Depth, old.Latitude = "3.6", "005", "09.90"
+	old.Location = "008 km S 20° W of Sagbayan (Bohol)"
+	old = withDerivedFields(old)
+
+	for _, lang := range []string{"en", "fil", "en+fil"} {
+		for _, variant := range []string{"new", "update"} {
+			t.Run(lang+"-"+variant, func(t *testing.T) {
+				useMessageLang(t, lang)
+				plain, formatted := formatMatrixMsg(variant == "update", old, q, "EQ-000123")
+				checkGolden(t, "message-"+lang+"-"+variant+".txt", plain)
+				checkGolden(t, "message-"+lang+"-"+variant+".html", formatted)
+			})
+		}
+	}
+}
+
+func TestParseMessageLangs(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"en", []string{LANG_EN}},
+		{"FIL", []string{LANG_FIL}},
+		{" en + fil ", []string{LANG_EN, LANG_FIL}},
+		{"fil+en+fil", []string{LANG_FIL, LANG_EN}},
+		{"ceb", nil},
+		{"en+", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseMessageLangs(tt.spec)
+		if (err == nil) != (tt.want != nil) || len(got) != len(tt.want) {
+			t.Errorf("parseMessageLangs(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("parseMessageLangs(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		}
+	}
+
+	// every language translates every string of the English catalog
+	for lang, strs := range messageCatalog {
+		for id := range messageCatalog[LANG_EN] {
+			if strs[id] == "" {
+				t.Errorf("%s misses %q", lang, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal Prometheus text-format metrics, served at /metrics on STATUS_LISTEN_ADDR.
+// Names follow the <namespace>_<subsystem>_<name>_<unit> scheme, e.g. phivolcs_fetch_duration_seconds.
+
+// default histogram buckets in seconds, for HTTP round trips
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// counterVec is a counter partitioned by label values
+type counterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+// inc increments the counter for the given label values, in the order of the labels
+func (c *counterVec) inc(labelValues ...string) {
+	c.add(1, labelValues...)
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(labelValues, "\x00")] += v
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, strings.Split(k, "\x00")), formatFloat(c.values[k]))
+	}
+}
+
+// histogram tracks observations in cumulative buckets
+type histogram struct {
+	name, help string
+	buckets    []float64
+	mu         sync.Mutex
+	counts     []uint64
+	sum        float64
+	count      uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+// gauge is a single value that can go up and down
+type gauge struct {
+	name, help string
+	mu         sync.Mutex
+	value      float64
+}
+
+func (g *gauge) set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+func (g *gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value))
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		}
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", n, v)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	metricFetches       = newCounterVec("phivolcs_fetch_requests_total", "PHIVOLCS page fetches by result (ok, not_modified, error).", "result")
+	metricFetchDuration = newHistogram("phivolcs_fetch_duration_seconds", "Duration of PHIVOLCS page fetches.", latencyBuckets)
+	metricRowsParsed    = newCounterVec("phivolcs_rows_parsed_total", "Quake table rows parsed.")
+	metricQuakes        = newCounterVec("phivolcs_quakes_detected_total", "Quakes detected for posting by kind (new, update).", "kind")
+	metricMatrixPosts   = newCounterVec("phivolcs_matrix_posts_total", "Matrix sends by result (ok, error) and last HTTP status code.", "result", "code")
+	metricPostDuration  = newHistogram("phivolcs_matrix_post_duration_seconds", "Duration of Matrix sends including retries.", latencyBuckets)
+	metricNewestQuake   = &gauge{name: "phivolcs_newest_quake_timestamp_seconds", help: "Unix time of the newest quake seen on PHIVOLCS."}
+	metricAftershock    = &gauge{name: "phivolcs_aftershock_mode", help: "1 while polling faster after a strong nearby quake."}
+	metricLocalThresh   = &gauge{name: "phivolcs_local_magnitude_threshold", help: "Minimum magnitude posted within REF_RADIUS_KM.", value: localMagThresh}
+	metricGlobalThresh  = &gauge{name: "phivolcs_global_magnitude_threshold", help: "Minimum magnitude posted elsewhere.", value: globalMagThresh}
+)
+
+// recordNewestQuake updates the newest quake gauge from a parsed page
+func recordNewestQuake(quakes []Quake) {
+	var newest time.Time
+	for _, q := range quakes {
+		if q.OccurredAt.After(newest) {
+			newest = q.OccurredAt
+		}
+	}
+	if !newest.IsZero() {
+		metricNewestQuake.set(float64(newest.Unix()))
+	}
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metricFetches.write(w)
+	metricFetchDuration.write(w)
+	metricRowsParsed.write(w)
+	metricQuakes.write(w)
+	metricMatrixPosts.write(w)
+	metricPostDuration.write(w)
+	metricNewestQuake.write(w)
+	metricAftershock.write(w)
+	metricLocalThresh.write(w)
+	metricGlobalThresh.write(w)
+}
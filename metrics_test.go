@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics fetches the /metrics endpoint of srv and returns the samples by series, e.g.
+// `phivolcs_fetch_requests_total{result="ok"}`
+func scrapeMetrics(t *testing.T, srv *httptest.Server) map[string]float64 {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("scraping /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	samples := map[string]float64{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Errorf("unparseable sample %q", line)
+			continue
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handleMetrics)
+	metrics := httptest.NewServer(mux)
+	t.Cleanup(metrics.Close)
+	before := scrapeMetrics(t, metrics)
+
+	// one successful fetch of a page with 4 rows
+	page, err := os.ReadFile("testdata/phivolcs-front-page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	phivolcs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(page)
+	}))
+	t.Cleanup(phivolcs.Close)
+	useScrapeTLS(t, "", false)
+	doc, err := fetchDocument(context.Background(), phivolcs.URL)
+	if err != nil {
+		t.Fatalf("fetchDocument: %v", err)
+	}
+	quakes, _ := parseFirstN(doc, 10)
+	recordNewestQuake(quakes)
+
+	// one Matrix post
+	useHomeserver(t, 0)
+	if _, err := sendMatrixMessage(context.Background(), matrixRoomID, "plain", "<b>html</b>", ""); err != nil {
+		t.Fatalf("sendMatrixMessage: %v", err)
+	}
+
+	after := scrapeMetrics(t, metrics)
+	increments := map[string]float64{
+		`phivolcs_fetch_requests_total{result="ok"}`:          1,
+		`phivolcs_fetch_duration_seconds_count`:               1,
+		`phivolcs_rows_parsed_total`:                          4,
+		`phivolcs_matrix_posts_total{result="ok",code="200"}`: 1,
+		`phivolcs_matrix_post_duration_seconds_count`:         1,
+	}
+	for series, want := range increments {
+		if got := after[series] - before[series]; got != want {
+			t.Errorf("%s went up by %v, want %v", series, got, want)
+		}
+	}
+	if want := float64(quakes[0].OccurredAt.Unix()); after["phivolcs_newest_quake_timestamp_seconds"] != want {
+		t.Errorf("newest quake gauge = %v, want %v", after["phivolcs_newest_quake_timestamp_seconds"], want)
+	}
+	for _, series := range []string{"phivolcs_local_magnitude_threshold", "phivolcs_global_magnitude_threshold", "phivolcs_aftershock_mode"} {
+		if _, ok := after[series]; !ok {
+			t.Errorf("%s missing from /metrics", series)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram("test_duration_seconds", "Test durations.", []float64{0.5, 1})
+	h.observe(200 * time.Millisecond)
+	h.observe(time.Second)
+	h.observe(3 * time.Second)
+	var b strings.Builder
+	h.write(&b)
+	for _, want := range []string{
+		`test_duration_seconds_bucket{le="0.5"} 1`,
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="+Inf"} 3`,
+		`test_duration_seconds_sum 4.2`,
+		`test_duration_seconds_count 3`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("histogram output misses %q:\n%s", want, b.String())
+		}
+	}
+}
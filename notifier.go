@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	NOTIFIER_MATRIX   = "matrix"
+	NOTIFIER_TELEGRAM = "telegram"
+	NOTIFIER_DISCORD  = "discord"
+	NOTIFIER_WEBHOOK  = "webhook"
+	NOTIFIER_EMAIL    = "email"
+	// reference shown in alerts, from the persisted sequence number
+	ALERT_REF_FORMAT = "EQ-%06d"
+)
+
+// Notifier is a sink alerts are posted to
+type Notifier interface {
+	// Notify posts a message given as plain text and as HTML
+	Notify(plain, html string) error
+}
+
+// quakeNotifier is implemented by sinks that build their own alert layout from the quake
+// instead of using the formatted message
+type quakeNotifier interface {
+	notifyQuake(updated bool, oldQuake, q Quake) error
+}
+
+// sinks alerts are posted to, built from NOTIFIERS at startup
+var notifiers []Notifier
+
+// parseNotifierNames splits the comma-separated NOTIFIERS value into lowercased names
+func parseNotifierNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// notifierEnabled reports whether the named sink is listed in NOTIFIERS. With CONFIG_FILE, the
+// messages that go to MATRIX_ROOM_ID rather than to destinations (aftershock summaries, the digest,
+// recovery notices) are only posted when it is set.
+func notifierEnabled(name string) bool {
+	if configFile != "" && name == NOTIFIER_MATRIX && matrixRoomID == "" {
+		return false
+	}
+	for _, n := range parseNotifierNames(notifierNames) {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notifierSettings are where the sinks post, the credentials are shared from the environment
+type notifierSettings struct {
+	matrixRoomID      string
+	telegramChatID    string
+	discordWebhookURL string
+	webhookURL        string
+	emailTo           string
+}
+
+// newNotifiers builds the sinks listed in NOTIFIERS, names are checked by validateConfig
+func newNotifiers() []Notifier {
+	return buildNotifiers(parseNotifierNames(notifierNames), notifierSettings{
+		matrixRoomID:      matrixRoomID,
+		telegramChatID:    telegramChatID,
+		discordWebhookURL: discordWebhookURL,
+		webhookURL:        webhookURL,
+		emailTo:           emailTo,
+	})
+}
+
+// buildNotifiers builds the named sinks posting where s says
+func buildNotifiers(names []string, s notifierSettings) []Notifier {
+	var ns []Notifier
+	for _, name := range names {
+		switch name {
+		case NOTIFIER_MATRIX:
+			ns = append(ns, matrixNotifier{roomID: s.matrixRoomID})
+		case NOTIFIER_TELEGRAM:
+			ns = append(ns, telegramNotifier{token: telegramBotToken, chatID: s.telegramChatID})
+		case NOTIFIER_DISCORD:
+			ns = append(ns, discordNotifier{webhookURL: s.discordWebhookURL})
+		case NOTIFIER_WEBHOOK:
+			ns = append(ns, webhookNotifier{url: s.webhookURL, authHeader: webhookAuthHeader})
+		case NOTIFIER_EMAIL:
+			ns = append(ns, emailNotifier{
+				host: smtpHost, port: smtpPort,
+				user: smtpUser, pass: smtpPass,
+				from: emailFrom, to: parseEmailList(s.emailTo),
+			})
+		}
+	}
+	return ns
+}
+
+// ErrAlertClaimed is returned by postAlert when another instance sharing the state claimed the
+// alert, that instance posts it and saves its record
+var ErrAlertClaimed = errors.New("alert claimed by another instance")
+
+// postAlert formats the alert for a quake and posts it to the notifiers of every destination whose
+// rules it passes, holding it for the ones in quiet hours. Returns the record to keep for the quake
+// with the event IDs of the Matrix messages, which are threaded under (or edit, with
+// UPDATE_MODE=edit) the initial alert of original in each room for updates. Other sinks get the
+// message on its own.
+func postAlert(ctx context.Context, updatedQuake Quake, updated bool, oldQuake Quake, original PostedQuake) (PostedQuake, error) {
+	posted := newPostedQuake(updatedQuake)
+	posted.ThreadRootID = threadRootID(original)
+	posted.AlertRef = original.AlertRef
+	for name, root := range original.DestinationRoots {
+		posted.setDestinationRoot(name, root)
+	}
+	if alreadySent(updatedQuake, updated) {
+		slog.Warn(fmt.Sprintf("⚠️ Identical alert already posted, skipping: %s | M%s | %s", updatedQuake.DateTime, updatedQuake.Magnitude, updatedQuake.Location),
+			quakeLogAttrs(updatedQuake)...)
+		return posted, nil
+	}
+	// with a shared state backend only the instance winning the claim posts, post anyway when
+	// the backend is unreachable rather than risk missing the alert
+	hash := alertHash(updatedQuake, updated)
+	if claimed, err := stateStore.Claim(hash); err != nil {
+		slog.Warn(fmt.Sprintf("⚠️ Failed to claim the alert, posting anyway: %v", err), quakeLogAttrs(updatedQuake)...)
+	} else if !claimed {
+		slog.Info(fmt.Sprintf("🤝 Alert claimed by another instance, skipping: %s | M%s | %s", updatedQuake.DateTime, updatedQuake.Magnitude, updatedQuake.Location),
+			quakeLogAttrs(updatedQuake)...)
+		return posted, ErrAlertClaimed
+	}
+
+	// the reference takes a sequence number, only once a destination posts or holds the alert
+	now := time.Now()
+	verdicts := make([]alertVerdict, len(destinations))
+	numbered := false
+	for i, d := range destinations {
+		var reason string
+		verdicts[i], reason = d.evaluate(updatedQuake, updated, oldQuake, now)
+		if verdicts[i] == VERDICT_SKIP {
+			slog.Debug("Alert not posted to destination", append(quakeLogAttrs(updatedQuake), "destination", d.name, "reason", reason)...)
+		} else {
+			numbered = true
+		}
+	}
+	if numbered {
+		posted.AlertRef = alertRefFor(updated, original)
+	}
+	msg, formatted := formatMatrixMsg(updated, oldQuake, updatedQuake, posted.AlertRef)
+	var delivered []string
+	var errs []error
+	for i, d := range destinations {
+		switch verdicts[i] {
+		case VERDICT_SKIP:
+			continue
+		case VERDICT_HOLD:
+			deferAlert(deferredAlert{Quake: updatedQuake, Updated: updated, Old: oldQuake, Destination: d.name})
+			continue
+		}
+		if updated {
+			dropSupersededAlert(d.name, oldQuake)
+		}
+
+		rootID := d.threadRoot(original)
+		for _, n := range d.notifierList() {
+			var err error
+			if m, ok := n.(matrixNotifier); ok {
+				roomMsg, roomFormatted := msg, formatted
+				if shouldMentionRoom(updatedQuake, updated, oldQuake) {
+					roomMsg, roomFormatted = withRoomMention(msg, formatted)
+				}
+				edit := updated && rootID != "" && updateMode == UPDATE_MODE_EDIT
+				var eventID string
+				eventID, err = m.notifyThreaded(ctx, roomMsg, roomFormatted, rootID, edit)
+				if eventID != "" {
+					if d == destinations[0] {
+						posted.EventID, posted.RoomID = eventID, m.roomID
+					} else if rootID == "" {
+						posted.setDestinationRoot(d.name, eventID)
+					}
+				}
+				// a revision only gets a new map when it moved the epicenter
+				if err == nil && attachMapImages && !edit && (!updated || coordsChanged(oldQuake, updatedQuake)) {
+					attachMapImage(ctx, m.roomID, eventID, updatedQuake)
+				}
+			} else if qn, ok := n.(quakeNotifier); ok {
+				err = qn.notifyQuake(updated, oldQuake, updatedQuake)
+			} else {
+				err = n.Notify(msg, formatted)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", n, err))
+			} else {
+				delivered = append(delivered, fmt.Sprint(n))
+			}
+		}
+	}
+	if len(delivered) > 0 {
+		postedAt := time.Now().UTC()
+		posted.PostedAt = &postedAt
+		posted.Notifier = strings.Join(delivered, ",")
+	}
+
+	err := errors.Join(errs...)
+	if err != nil && len(delivered) == 0 {
+		// nothing went out, the alert may be claimed again
+		if relErr := stateStore.Release(hash); relErr != nil {
+			slog.Warn(fmt.Sprintf("⚠️ Failed to release the alert claim: %v", relErr), quakeLogAttrs(updatedQuake)...)
+		}
+	}
+	// an alert that reached any sink is not sent again, one only held or skipped is still to be sent
+	if len(delivered) > 0 {
+		markSent(updatedQuake, updated)
+		status.recordPosted(updatedQuake)
+		slog.Debug("Posted alert", append(quakeLogAttrs(updatedQuake), "event_id", posted.EventID, "updated", updated)...)
+	}
+	return posted, err
+}
+
+// alertRefFor returns the reference shown in an alert: the one of the original alert for revisions,
+// the next sequence number otherwise. Empty when no number could be taken.
+func alertRefFor(updated bool, original PostedQuake) string {
+	if updated && original.AlertRef != "" {
+		return original.AlertRef
+	}
+	seq, err := stateStore.NextSequence()
+	if err != nil {
+		log.Printf("⚠️ Failed to take an alert sequence number: %v", err)
+		return ""
+	}
+	return fmt.Sprintf(ALERT_REF_FORMAT, seq)
+}
+
+// notifyAll posts a message to every notifier, e.g. tsunami information
+func notifyAll(plain, html string) error {
+	var errs []error
+	for _, n := range notifiers {
+		if err := n.Notify(plain, html); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testQuake returns a quake above the default alert thresholds
+func testQuake() Quake {
+	return withDerivedFields(Quake{DateTime: "02 March 2024 - 01:05:00 AM", Magnitude: "7.0", Location: "030 km N 72° E of Hinatuan (Surigao Del Sur)"})
+}
+
+// fakeNotifier records the messages posted to it, failing every post when fail is set
+type fakeNotifier struct {
+	fail bool
+	sent *[]string
+}
+
+func (n fakeNotifier) String() string { return "fake" }
+
+func (n fakeNotifier) Notify(plain, html string) error {
+	if n.fail {
+		return errors.New("unreachable")
+	}
+	*n.sent = append(*n.sent, plain)
+	return nil
+}
+
+// useNotifiers makes the environment destination post to ns for the duration of a test
+func useNotifiers(t *testing.T, ns ...Notifier) {
+	saved := notifiers
+	notifiers = ns
+	t.Cleanup(func() { notifiers = saved })
+}
+
+func TestPostAlertMarksSentOnlyWhenDelivered(t *testing.T) {
+	var sent []string
+	tests := []struct {
+		name      string
+		notifiers []Notifier
+		magnitude string
+		wantSent  bool
+		wantErr   bool
+	}{
+		{"delivered", []Notifier{fakeNotifier{sent: &sent}}, "7.0", true, false},
+		{"every notifier failed", []Notifier{fakeNotifier{fail: true}}, "7.0", false, true},
+		{"delivered to one of two", []Notifier{fakeNotifier{fail: true}, fakeNotifier{sent: &sent}}, "7.0", true, true},
+		{"below the threshold", []Notifier{fakeNotifier{sent: &sent}}, "0.5", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			useNotifiers(t, tt.notifiers...)
+			q := testQuake()
+			q.Magnitude = tt.magnitude
+			q = withDerivedFields(q)
+			posted, err := postAlert(context.Background(), q, false, q, PostedQuake{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("postAlert error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := alreadySent(q, false); got != tt.wantSent {
+				t.Errorf("alreadySent = %v, want %v", got, tt.wantSent)
+			}
+			if got := posted.PostedAt != nil; got != tt.wantSent {
+				t.Errorf("recorded as posted = %v, want %v", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestPostAlertNumbersOnlyPostedOrHeldAlerts(t *testing.T) {
+	useTempState(t)
+	var sent []string
+	useNotifiers(t, fakeNotifier{sent: &sent})
+
+	below := testQuake()
+	below.Magnitude = "0.5"
+	below = withDerivedFields(below)
+	if posted, _ := postAlert(context.Background(), below, false, below, PostedQuake{}); posted.AlertRef != "" {
+		t.Errorf("skipped alert numbered %s", posted.AlertRef)
+	}
+	q := testQuake()
+	posted, err := postAlert(context.Background(), q, false, q, PostedQuake{})
+	if err != nil {
+		t.Fatalf("postAlert: %v", err)
+	}
+	if want := fmt.Sprintf(ALERT_REF_FORMAT, 1); posted.AlertRef != want || !strings.Contains(sent[0], "Ref: "+want) {
+		t.Errorf("first posted alert numbered %q, want %s", posted.AlertRef, want)
+	}
+
+	// revisions keep the number of the alert they revise
+	revised := q
+	revised.Magnitude = "7.1"
+	posted, _ = postAlert(context.Background(), withDerivedFields(revised), true, q, posted)
+	if want := fmt.Sprintf(ALERT_REF_FORMAT, 1); posted.AlertRef != want {
+		t.Errorf("revision numbered %q, want %s", posted.AlertRef, want)
+	}
+}
+
+func TestPostAlertNumbersHeldAlerts(t *testing.T) {
+	useTempState(t)
+	var sent []string
+	useNotifiers(t, fakeNotifier{sent: &sent})
+	saved, savedMag := quietHours, quietOverrideMagnitude
+	quietHours, quietOverrideMagnitude = "00:00-23:59", 9
+	t.Cleanup(func() { quietHours, quietOverrideMagnitude = saved, savedMag })
+
+	q := testQuake()
+	posted, err := postAlert(context.Background(), q, false, q, PostedQuake{})
+	if err != nil {
+		t.Fatalf("postAlert: %v", err)
+	}
+	if len(sent) != 0 || len(stateStore.LoadDeferred()) != 1 {
+		t.Fatalf("alert not held: %d sent, %d held", len(sent), len(stateStore.LoadDeferred()))
+	}
+	if want := fmt.Sprintf(ALERT_REF_FORMAT, 1); posted.AlertRef != want {
+		t.Errorf("held alert numbered %q, want %s", posted.AlertRef, want)
+	}
+}
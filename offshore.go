@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// PHIVOLCS relative position, e.g. "034 km S 67° E of General Luna (Surigao Del Norte)"
+var relativePositionRe = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d+)?)\s*km\s+([NS])\s*(?:(\d+(?:\.\d+)?)\s*°?\s*([EW]))?\s+of\s+(.+?)\s*$`)
+
+// land polygons loaded from OFFSHORE_LAND_FILE at startup, nil to classify no quake as offshore
+var landArea *geoFence
+
+// relativePosition is the distance and bearing from the place a PHIVOLCS location is relative to
+type relativePosition struct {
+	distanceKm float64
+	// degrees clockwise from north
+	azimuth float64
+	place   string
+}
+
+// parseRelativePosition reads the distance, bearing and place of a PHIVOLCS location
+func parseRelativePosition(location string) (relativePosition, bool) {
+	m := relativePositionRe.FindStringSubmatch(location)
+	if m == nil {
+		return relativePosition{}, false
+	}
+	dist, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return relativePosition{}, false
+	}
+	// "N 45° W" is 45 degrees west of north, a bare "N" or "S" is due north or south
+	var angle float64
+	if m[3] != "" {
+		if angle, err = strconv.ParseFloat(m[3], 64); err != nil || angle > 90 {
+			return relativePosition{}, false
+		}
+	}
+	north, east := m[2] == "N" || m[2] == "n", m[4] == "E" || m[4] == "e"
+	var azimuth float64
+	switch {
+	case north && east:
+		azimuth = angle
+	case north:
+		azimuth = math.Mod(360-angle, 360)
+	case east:
+		azimuth = 180 - angle
+	default:
+		azimuth = 180 + angle
+	}
+	return relativePosition{distanceKm: dist, azimuth: azimuth, place: m[5]}, true
+}
+
+// compassPoint names the 16-point compass direction of an azimuth, e.g. "ESE" for 112.5
+func compassPoint(azimuth float64) string {
+	points := [...]string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+	i := int(math.Floor(math.Mod(azimuth, 360)/22.5+0.5)) % len(points)
+	return points[i]
+}
+
+// isOffshore classifies a quake as offshore when its epicenter is outside the OFFSHORE_LAND_FILE
+// polygons. Without a land file, or coordinates, no quake is offshore: the distance PHIVOLCS gives
+// to the nearest town says nothing about the coastline.
+func isOffshore(q Quake) bool {
+	if landArea == nil {
+		return false
+	}
+	lat, lon, ok := quakeCoords(q)
+	return ok && !landArea.contains(lat, lon)
+}
+
+// formatOffshoreLine returns the line labelling an offshore quake in alerts, e.g.
+// "Offshore, ~34 km ESE of General Luna (Surigao Del Norte)"
+func formatOffshoreLine(q Quake) (string, string) {
+	if !q.Offshore {
+		return "", ""
+	}
+	label := "Offshore"
+	if pos, ok := parseRelativePosition(q.Location); ok {
+		label = fmt.Sprintf("Offshore, ~%.0f km %s of %s", pos.distanceKm, compassPoint(pos.azimuth), pos.place)
+	}
+	return label + "\n", "🌊 " + label + "<br>"
+}
@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+// useLandArea loads the coarse land polygons of testdata for the duration of a test
+func useLandArea(t *testing.T) {
+	t.Helper()
+	fence, err := loadGeofence("testdata/ph-land-sample.geojson")
+	if err != nil {
+		t.Fatalf("loadGeofence: %v", err)
+	}
+	landArea = fence
+	t.Cleanup(func() { landArea = nil })
+}
+
+func TestIsOffshoreHistoricalEvents(t *testing.T) {
+	useLandArea(t)
+	tests := []struct {
+		name     string
+		lat, lon string
+		location string
+		offshore bool
+	}{
+		{"2023 Hinatuan M7.4", "8.52", "126.59", "030 km N 72° E of Hinatuan (Surigao Del Sur)", true},
+		{"2012 Guiuan M7.6", "10.81", "126.64", "106 km N 81° E of Guiuan (Eastern Samar)", true},
+		{"2013 Bohol M7.2", "9.86", "124.07", "006 km S 24° W of Sagbayan (Bohol)", false},
+		{"2019 Cotabato M6.6", "6.91", "125.07", "006 km S 32° E of Tulunan (Cotabato)", false},
+		{"2022 Abra M7.0", "17.64", "120.63", "003 km N 63° W of Tayum (Abra)", false},
+		// far from the named town but on land, the distance alone must not make it offshore
+		{"inland far from town", "7.60", "124.80", "032 km N 80° E of Tulunan (Cotabato)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Quake{Latitude: tt.lat, Longitude: tt.lon, Location: tt.location}
+			if got := isOffshore(q); got != tt.offshore {
+				t.Errorf("isOffshore = %v, want %v", got, tt.offshore)
+			}
+		})
+	}
+}
+
+func TestIsOffshoreWithoutLandFile(t *testing.T) {
+	landArea = nil
+	q := Quake{Latitude: "8.52", Longitude: "126.59", Location: "030 km N 72° E of Hinatuan (Surigao Del Sur)"}
+	if isOffshore(q) {
+		t.Error("quake classified offshore without OFFSHORE_LAND_FILE")
+	}
+}
+
+func TestIsOffshoreUnparseableCoordinates(t *testing.T) {
+	useLandArea(t)
+	if isOffshore(Quake{Latitude: "—", Longitude: "126.59"}) {
+		t.Error("quake without coordinates classified offshore")
+	}
+}
+
+func TestParseRelativePosition(t *testing.T) {
+	tests := []struct {
+		location string
+		dist     float64
+		azimuth  float64
+		place    string
+	}{
+		{"030 km N 72° E of Hinatuan (Surigao Del Sur)", 30, 72, "Hinatuan (Surigao Del Sur)"},
+		{"006 km S 24° W of Sagbayan (Bohol)", 6, 204, "Sagbayan (Bohol)"},
+		{"017 km S 71° E of Tulunan (Cotabato)", 17, 109, "Tulunan (Cotabato)"},
+		{"012 km N 45° W of Talisay City (Cebu)", 12, 315, "Talisay City (Cebu)"},
+		{"022 km N of Calatagan (Batangas)", 22, 0, "Calatagan (Batangas)"},
+		{"004 km S of Calatagan (Batangas)", 4, 180, "Calatagan (Batangas)"},
+	}
+	for _, tt := range tests {
+		pos, ok := parseRelativePosition(tt.location)
+		if !ok {
+			t.Errorf("parseRelativePosition(%q) failed", tt.location)
+			continue
+		}
+		if pos.distanceKm != tt.dist || pos.azimuth != tt.azimuth || pos.place != tt.place {
+			t.Errorf("parseRelativePosition(%q) = %+v, want %v km at %v° of %q", tt.location, pos, tt.dist, tt.azimuth, tt.place)
+		}
+	}
+	for _, location := range []string{"", "Talisay City (Cebu)", "012 km N 95° W of Talisay City (Cebu)"} {
+		if _, ok := parseRelativePosition(location); ok {
+			t.Errorf("parseRelativePosition(%q) succeeded", location)
+		}
+	}
+}
+
+func TestFormatOffshoreLine(t *testing.T) {
+	q := Quake{Location: "030 km N 72° E of Hinatuan (Surigao Del Sur)", Offshore: true}
+	plain, html := formatOffshoreLine(q)
+	if want := "Offshore, ~30 km ENE of Hinatuan (Surigao Del Sur)\n"; plain != want {
+		t.Errorf("plain = %q, want %q", plain, want)
+	}
+	if want := "🌊 Offshore, ~30 km ENE of Hinatuan (Surigao Del Sur)<br>"; html != want {
+		t.Errorf("html = %q, want %q", html, want)
+	}
+	q.Offshore = false
+	if plain, html := formatOffshoreLine(q); plain != "" || html != "" {
+		t.Errorf("inland quake labelled %q, %q", plain, html)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// originPattern is one entry of ORIGIN_INCLUDE or ORIGIN_EXCLUDE, matched against the origin
+// normalized with normalizeAddr (lowercase, no punctuation or spaces, so "(Cebu)" reads "cebu")
+type originPattern struct {
+	raw    string
+	substr string
+	re     *regexp.Regexp
+}
+
+// originPatternCache holds the patterns of ORIGIN_INCLUDE or ORIGIN_EXCLUDE as last compiled,
+// compiled again only when a reload changes the spec
+type originPatternCache struct {
+	mu       sync.Mutex
+	spec     string
+	patterns []originPattern
+}
+
+var includePatterns, excludePatterns originPatternCache
+
+// parseOriginPatterns parses comma-separated case-insensitive substrings, or regexes prefixed with "re:"
+func parseOriginPatterns(env, spec string) ([]originPattern, error) {
+	var patterns []originPattern
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(part, "re:"); ok {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s pattern %q: %w", env, part, err)
+			}
+			patterns = append(patterns, originPattern{raw: part, re: re})
+			continue
+		}
+		substr := normalizeAddr(part)
+		if substr == "" {
+			return nil, fmt.Errorf("%s pattern %q has no letters or digits", env, part)
+		}
+		patterns = append(patterns, originPattern{raw: part, substr: substr})
+	}
+	return patterns, nil
+}
+
+func (p originPattern) matches(normalizedOrigin string) bool {
+	if p.re != nil {
+		return p.re.MatchString(normalizedOrigin)
+	}
+	return strings.Contains(normalizedOrigin, p.substr)
+}
+
+// get returns the compiled patterns of spec, the value of env
+func (c *originPatternCache) get(env, spec string) []originPattern {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spec != spec {
+		// an invalid spec is rejected by validateConfig, only reachable if it was skipped
+		c.patterns, _ = parseOriginPatterns(env, spec)
+		c.spec = spec
+	}
+	return c.patterns
+}
+
+// matchOrigin returns the first of patterns matching the origin of q
+func matchOrigin(patterns []originPattern, q Quake) (string, bool) {
+	origin := normalizeAddr(q.Origin)
+	for _, p := range patterns {
+		if p.matches(origin) {
+			return p.raw, true
+		}
+	}
+	return "", false
+}
+
+// originIncluded reports whether the origin of q matches ORIGIN_INCLUDE, lowering its threshold to LOCAL_MAG_THRESH
+func originIncluded(q Quake) bool {
+	_, ok := matchOrigin(includePatterns.get("ORIGIN_INCLUDE", originInclude), q)
+	return ok
+}
+
+// originExcluded reports whether the origin of q matches ORIGIN_EXCLUDE, which suppresses it whatever
+// its magnitude and wins over ORIGIN_INCLUDE. The reason names the matching patterns.
+func originExcluded(q Quake) (string, bool) {
+	excl, ok := matchOrigin(excludePatterns.get("ORIGIN_EXCLUDE", originExclude), q)
+	if !ok {
+		return "", false
+	}
+	reason := fmt.Sprintf("origin %q matches ORIGIN_EXCLUDE %q", q.Origin, excl)
+	if incl, ok := matchOrigin(includePatterns.get("ORIGIN_INCLUDE", originInclude), q); ok {
+		reason += fmt.Sprintf(" and ORIGIN_INCLUDE %q, exclude wins", incl)
+	}
+	return reason, true
+}
+
+// logOriginExcluded logs a quake suppressed by ORIGIN_EXCLUDE, outside dry runs too since the rule is explicit
+func logOriginExcluded(q Quake, reason string) {
+	slog.Info(fmt.Sprintf("🚫 Not posting %s | M%s | %s: %s", q.DateTime, q.Magnitude, q.Location, reason), quakeLogAttrs(q)...)
+}
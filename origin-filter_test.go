@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// useOriginFilter sets ORIGIN_INCLUDE and ORIGIN_EXCLUDE for the duration of a test
+func useOriginFilter(t *testing.T, include, exclude string) {
+	t.Helper()
+	savedInclude, savedExclude := originInclude, originExclude
+	originInclude, originExclude = include, exclude
+	t.Cleanup(func() { originInclude, originExclude = savedInclude, savedExclude })
+}
+
+func TestOriginFilter(t *testing.T) {
+	useOriginFilter(t, "Bohol,re:^tectonic", "Sagbayan")
+	tests := []struct {
+		origin   string
+		included bool
+		excluded bool
+	}{
+		{"006 km S 24° W of Sagbayan (Bohol)", true, true},
+		{"010 km N 12° E of Carmen (Bohol)", true, false},
+		{"Tectonic", true, false},
+		{"Volcanic", false, false},
+	}
+	for _, tt := range tests {
+		q := Quake{Origin: tt.origin}
+		if got := originIncluded(q); got != tt.included {
+			t.Errorf("originIncluded(%q) = %v, want %v", tt.origin, got, tt.included)
+		}
+		reason, excluded := originExcluded(q)
+		if excluded != tt.excluded {
+			t.Errorf("originExcluded(%q) = %v, want %v", tt.origin, excluded, tt.excluded)
+		}
+		if excluded && !strings.Contains(reason, "exclude wins") {
+			t.Errorf("reason %q does not say ORIGIN_EXCLUDE wins", reason)
+		}
+	}
+}
+
+func TestOriginPatternsCompiledOnce(t *testing.T) {
+	useOriginFilter(t, "re:bohol$", "")
+	first := includePatterns.get("ORIGIN_INCLUDE", originInclude)
+	if len(first) != 1 || first[0].re == nil {
+		t.Fatalf("patterns = %+v, want one regex", first)
+	}
+	if again := includePatterns.get("ORIGIN_INCLUDE", originInclude); again[0].re != first[0].re {
+		t.Error("ORIGIN_INCLUDE compiled again although it did not change")
+	}
+
+	// a reload changing the spec takes effect on the next quake
+	q := Quake{Origin: "017 km S 71° E of Tulunan (Cotabato)"}
+	if originIncluded(q) {
+		t.Fatal("Cotabato origin matches re:bohol$")
+	}
+	originInclude = "Cotabato"
+	if !originIncluded(q) {
+		t.Error("ORIGIN_INCLUDE reloaded to Cotabato does not match")
+	}
+	originInclude = ""
+	if originIncluded(q) {
+		t.Error("origin still included after ORIGIN_INCLUDE was unset")
+	}
+}
+
+func TestOriginFilterParenthesizedProvince(t *testing.T) {
+	useOriginFilter(t, "Cebu,Negros Oriental,re:bohol$", "")
+	tests := []struct {
+		origin   string
+		included bool
+	}{
+		{"020 km N 55° E of Medellin (Cebu)", true},
+		{"003 km S 10° W of Cebu City (Cebu)", true},
+		{"012 km N 30° W of Dumaguete City (Negros Oriental)", true},
+		{"006 km S 24° W of Sagbayan (Bohol)", true},
+		{"012 km N 30° W of Sipalay City (Negros Occidental)", false},
+		// re: patterns see the normalized origin too, the closing parenthesis is gone
+		{"Bohol Sea", false},
+		{"017 km S 71° E of Tulunan (Cotabato)", false},
+	}
+	for _, tt := range tests {
+		if got := originIncluded(Quake{Origin: tt.origin}); got != tt.included {
+			t.Errorf("originIncluded(%q) = %v, want %v", tt.origin, got, tt.included)
+		}
+	}
+}
+
+func TestOriginFilterThreshold(t *testing.T) {
+	useThresholds(t, 3, 5)
+	q := withDerivedFields(Quake{
+		DateTime:  "01 October 2025 - 09:12 PM",
+		Magnitude: "4.0",
+		Depth:     "010",
+		Latitude:  "14.60",
+		Longitude: "121.00",
+		Location:  "020 km N 55° E of Medellin (Cebu)",
+	})
+	q.Origin = q.Location
+	if got := thresholdFor(q); got != 5 {
+		t.Fatalf("threshold far from the reference point = %v, want GLOBAL_MAG_THRESH 5", got)
+	}
+
+	useOriginFilter(t, "(Cebu)", "")
+	if got := thresholdFor(q); got != 3 {
+		t.Errorf("threshold with ORIGIN_INCLUDE = %v, want LOCAL_MAG_THRESH 3", got)
+	}
+
+	// ORIGIN_EXCLUDE suppresses the quake whatever its magnitude
+	q.Magnitude = "7.0"
+	if changed, _ := processQuakes([]Quake{q}, map[string]Quake{}, map[string]PostedQuake{}); len(changed) != 1 {
+		t.Fatal("M7.0 quake not detected without ORIGIN_EXCLUDE")
+	}
+	useOriginFilter(t, "Cebu", "Medellin")
+	if changed, _ := processQuakes([]Quake{q}, map[string]Quake{}, map[string]PostedQuake{}); len(changed) != 0 {
+		t.Errorf("excluded quake detected: %+v", changed)
+	}
+}
+
+func TestParseOriginPatternsInvalid(t *testing.T) {
+	for _, spec := range []string{"re:(cebu", "()", "Cebu, - ,Bohol"} {
+		if _, err := parseOriginPatterns("ORIGIN_INCLUDE", spec); err == nil {
+			t.Errorf("parseOriginPatterns accepted %q", spec)
+		}
+	}
+	patterns, err := parseOriginPatterns("ORIGIN_INCLUDE", " Cebu , ,re:^bohol ")
+	if err != nil || len(patterns) != 2 || patterns[0].substr != "cebu" || patterns[1].re == nil {
+		t.Errorf("parseOriginPatterns = %+v, %v", patterns, err)
+	}
+}
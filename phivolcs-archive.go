@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// Build the URL of the PHIVOLCS monthly archive page for the given month,
+// e.g. https://earthquake.phivolcs.dost.gov.ph/EQLatest-Monthly/2025/2025_September.html
+func monthlyArchiveURL(year int, month time.Month) string {
+	return fmt.Sprintf("%s/EQLatest-Monthly/%d/%d_%s.html", PHIVOLCS_BASE_URL, year, year, month.String())
+}
+
+// Fetch a PHIVOLCS page and parse up to n quakes from its quake table
+func fetchAndParse(ctx context.Context, pageURL string, n int) ([]Quake, error) {
+	doc, err := fetchDocument(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseFirstN(doc, n)
+}
+
+// fetchLatestQuakes parses the PHIVOLCS front page, falling back to the current month's
+// archive page (which carries the same table) when the front page fails or has no rows.
+// Returns the quakes together with the URL of the page they were parsed from.
+//
+// The front page is fetched conditionally using validators, which are only replaced once
+// the page parsed successfully. ErrNotModified is returned as-is without falling back.
+func fetchLatestQuakes(ctx context.Context, n int, validators *pageValidators) ([]Quake, string, error) {
+	next := *validators
+	var quakes []Quake
+	doc, err := fetchDocumentIfModified(ctx, PHIVOLCS_BASE_URL, &next)
+	if errors.Is(err, ErrNotModified) {
+		return nil, "", err
+	}
+	if err == nil {
+		lastPageTitle = pageTitle(doc)
+		quakes, err = parseFirstN(doc, n)
+	}
+	if err == nil && len(quakes) > 0 {
+		*validators = next
+		return quakes, PHIVOLCS_BASE_URL, nil
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch quakes from %s: %v", PHIVOLCS_BASE_URL, err)
+	} else {
+		err = fmt.Errorf("%w from %s", ErrNoRowsParsed, PHIVOLCS_BASE_URL)
+		log.Printf("⚠️ Parsed zero quakes from %s", PHIVOLCS_BASE_URL)
+	}
+
+	// archive pages are named after the month in Philippine time
+	now := time.Now().In(manilaLoc)
+	archiveURL := monthlyArchiveURL(now.Year(), now.Month())
+	log.Printf("📚 Falling back to monthly archive %s", archiveURL)
+
+	archived, archiveErr := fetchAndParse(ctx, archiveURL, n)
+	if archiveErr != nil {
+		return nil, "", errors.Join(err, fmt.Errorf("archive fallback: %w", archiveErr))
+	}
+	if len(archived) == 0 {
+		return nil, "", errors.Join(err, fmt.Errorf("archive fallback: %w from %s", ErrNoRowsParsed, archiveURL))
+	}
+	log.Printf("📚 Parsed %d quakes from fallback source %s", len(archived), archiveURL)
+	return archived, archiveURL, nil
+}
+
+// fetchMonth fetches the PHIVOLCS archive page of a month and parses every quake listed on it
+func fetchMonth(ctx context.Context, year int, month time.Month) ([]Quake, error) {
+	return fetchAndParse(ctx, monthlyArchiveURL(year, month), math.MaxInt)
+}
+
+// runBackfill fetches the monthly archive pages for the given comma-separated months
+// (YYYY-MM[,YYYY-MM...]) and records every quake in both the cache and posted files
+// without posting anything, so a fresh or recovered deployment doesn't re-alert them.
+func runBackfill(ctx context.Context, months string) error {
+	var parsed []time.Time
+	for _, m := range strings.Split(months, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		month, err := time.Parse("2006-01", m)
+		if err != nil {
+			return fmt.Errorf("invalid backfill month %q (expected YYYY-MM): %w", m, err)
+		}
+		parsed = append(parsed, month)
+	}
+	return ingestMonths(ctx, parsed, time.Time{})
+}
+
+// parseImportFrom parses IMPORT_FROM, a YYYY-MM or YYYY-MM-DD date in Philippine time
+func parseImportFrom(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01"} {
+		if t, err := time.ParseInLocation(layout, s, manilaLoc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("IMPORT_FROM %q must be YYYY-MM or YYYY-MM-DD", s)
+}
+
+// runImport backfills the quakes from IMPORT_FROM up to now at startup, month by month, like runBackfill
+func runImport(ctx context.Context, from time.Time) error {
+	var months []time.Time
+	now := time.Now().In(manilaLoc)
+	for m := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, manilaLoc); !m.After(now); m = m.AddDate(0, 1, 0) {
+		months = append(months, m)
+	}
+	log.Printf("📥 Importing %d months of PHIVOLCS archives since %s", len(months), from.Format("2006-01-02"))
+	return ingestMonths(ctx, months, from)
+}
+
+// ingestMonths records every quake of the given months that occurred at or after since in the state
+// store (and the quake archive when enabled) without posting anything
+func ingestMonths(ctx context.Context, months []time.Time, since time.Time) error {
+	lastFetchQuakes := stateStore.LoadFetched()
+	postedQuakes := stateStore.LoadPosted()
+
+	total := 0
+	for _, month := range months {
+		quakes, err := fetchMonth(ctx, month.Year(), month.Month())
+		if err != nil {
+			return fmt.Errorf("backfill of %s failed: %w", month.Format("2006-01"), err)
+		}
+		quakes = quakesSince(quakes, since)
+
+		for _, q := range quakes {
+			lastFetchQuakes[quakeOriginKey(q)] = q
+			// keep already posted records, they carry the event IDs of their Matrix alerts
+			if _, ok := postedQuakes[quakeLocationKey(q)]; !ok {
+				postedQuakes[quakeLocationKey(q)] = newPostedQuake(q)
+			}
+		}
+		archive.record(quakes)
+		total += len(quakes)
+		log.Printf("📥 Backfilled %d quakes from %s", len(quakes), monthlyArchiveURL(month.Year(), month.Month()))
+	}
+
+	// posted entries older than POSTED_RETENTION are pruned when saving, same as in the poll loop
+	stateStore.SaveFetched(mapEqToSlice(lastFetchQuakes))
+	stateStore.SavePosted(postedToSlice(postedQuakes))
+	archive.sync()
+	log.Printf("✅ Backfill complete, %d quakes ingested", total)
+	return nil
+}
+
+// quakesSince keeps the quakes that occurred at or after since, all of them when since is zero
+func quakesSince(quakes []Quake, since time.Time) []Quake {
+	if since.IsZero() {
+		return quakes
+	}
+	var kept []Quake
+	for _, q := range quakes {
+		if !q.OccurredAt.Before(since) {
+			kept = append(kept, q)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMonthlyArchiveURL(t *testing.T) {
+	want := PHIVOLCS_BASE_URL + "/EQLatest-Monthly/2025/2025_September.html"
+	if got := monthlyArchiveURL(2025, time.September); got != want {
+		t.Errorf("monthlyArchiveURL = %s, want %s", got, want)
+	}
+}
+
+func TestParseArchivePage(t *testing.T) {
+	doc := loadTestPage(t, "testdata/phivolcs-archive-page.html")
+	doc.Url, _ = url.Parse(monthlyArchiveURL(2025, time.September))
+	quakes, err := parseFirstN(doc, 100)
+	if err != nil {
+		t.Fatalf("parseFirstN: %v", err)
+	}
+	if len(quakes) != 3 {
+		t.Fatalf("parsed %d quakes, want 3", len(quakes))
+	}
+	// links relative to the archive page resolve to the same URLs as on the front page
+	wantBulletins := []string{
+		PHIVOLCS_BASE_URL + "/2025_Earthquake_Information/September/2025_0930_151005_B1.html",
+		PHIVOLCS_BASE_URL + "/2025_Earthquake_Information/September/2025_0930_134417_B2F.html",
+		PHIVOLCS_BASE_URL + "/2025_Earthquake_Information/September/2025_0901_002312_B1.html",
+	}
+	for i, want := range wantBulletins {
+		if quakes[i].Bulletin != want {
+			t.Errorf("bulletin %d = %s, want %s", i, quakes[i].Bulletin, want)
+		}
+	}
+	if q := quakes[1]; q.Magnitude != "6.9" || q.Location != "019 km N 55° E of Medellin (Cebu)" || q.DateTime != "30 September 2025 - 09:44:17 PM" {
+		t.Errorf("second row = %+v", q)
+	}
+
+	// the front page and the archive identify the same quake with the same key
+	front := loadTestPage(t, "testdata/phivolcs-front-page.html")
+	latest, err := parseFirstN(front, 10)
+	if err != nil {
+		t.Fatalf("parseFirstN: %v", err)
+	}
+	if a, b := quakeLocationKey(latest[3]), quakeLocationKey(quakes[0]); a != b || latest[3].Bulletin != quakes[0].Bulletin {
+		t.Errorf("front page %s (%s) and archive %s (%s) differ", a, latest[3].Bulletin, b, quakes[0].Bulletin)
+	}
+}
@@ -1,29 +1,40 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/unicode/norm"
 )
 
 type Quake struct {
-	// Date and Time when the seismic event occurred
-	// Format: "02 January 2006 - 03:04 PM"
+	// Date and Time when the seismic event occurred, for display and serialization
+	// Format: "02 January 2006 - 03:04:05 PM"
 	DateTime string `json:"datetime"`
+	// DateTime parsed in Philippine time, zero if unparseable.
+	// Not serialized, re-derived from DateTime when loading cache files.
+	OccurredAt time.Time `json:"-"`
 	// Approximate Latitude in decimal degrees
 	Latitude string `json:"latitude"`
 	// Approximate Longitude in decimal degrees
@@ -32,12 +43,40 @@ type Quake struct {
 	Depth string `json:"depth"`
 	// Magnitude as string (e.g. "5.2")
 	Magnitude string `json:"magnitude"`
+	// Magnitude parsed once, only meaningful when MagnitudeOK is set.
+	// Not serialized, re-derived from Magnitude when loading cache files.
+	MagnitudeValue float64 `json:"-"`
+	MagnitudeOK    bool    `json:"-"`
 	// Location description including the relative position
 	Location string `json:"location"`
 	// Origin location without the relative position
 	Origin string `json:"origin"`
+	// province in parentheses at the end of Location (e.g. "Batangas"), empty if there is none
+	Province string `json:"province,omitempty"`
+	// classified offshore by isOffshore, re-derived when loading cache files
+	Offshore bool `json:"offshore,omitempty"`
 	// PHIVOLCS bulletin URL
 	Bulletin string `json:"bulletin"`
+	// magnitude scale as stated in the bulletin page (e.g. "Mw", "Ms"), empty if the bulletin was not fetched
+	MagType string `json:"mag_type,omitempty"`
+	// "YES"/"NO" as stated in the bulletin page, empty if the bulletin was not fetched
+	ExpectingDamage string `json:"expecting_damage,omitempty"`
+	// "YES"/"NO" as stated in the bulletin page, empty if the bulletin was not fetched
+	ExpectingAftershocks string `json:"expecting_aftershocks,omitempty"`
+	// USGS event page of the matching event, empty when not enriched or no match
+	USGSEventURL string `json:"usgs_event_url,omitempty"`
+	// USGS magnitude with its type (e.g. "Mww 6.1")
+	USGSMagnitude string `json:"usgs_magnitude,omitempty"`
+	// whether the bulletin page mentions a tsunami
+	MentionsTsunami bool `json:"mentions_tsunami,omitempty"`
+	// number of locations listed under "Reported Intensities" in the bulletin page
+	FeltReports int `json:"felt_reports,omitempty"`
+	// highest reported intensity in roman numerals (e.g. "V"), empty if none were listed
+	MaxIntensity string `json:"max_intensity,omitempty"`
+	// problems found while sanitizing the table row, with the raw cell text
+	ParseWarnings []string `json:"parse_warnings,omitempty"`
+	// row failed validation, cached so it doesn't look new but never posted
+	Ineligible bool `json:"ineligible,omitempty"`
 }
 
 const (
@@ -47,17 +86,97 @@ const (
 	DEFAULT_REF_POINT_LON = 123.90
 	DEFAULT_REF_RADIUS_KM = 110.0
 	DEFAULT_MAX_ROWS      = 500
+	COORD_DECIMALS        = 2 // decimal places coordinates are normalized to, as published by PHIVOLCS
+	DEFAULT_POLL_INTERVAL = 150 * time.Second
+	// how long posted quakes are remembered
+	DEFAULT_POSTED_RETENTION = 60 * 24 * time.Hour
+	// first retry delay after a fetch/parse error
+	DEFAULT_ERROR_RETRY_INTERVAL = 30 * time.Second
+	// faster polling for a while after a strong nearby quake
+	DEFAULT_AFTERSHOCK_TRIGGER_MAG   = 6.0
+	DEFAULT_AFTERSHOCK_POLL_INTERVAL = 45 * time.Second
+	DEFAULT_AFTERSHOCK_WINDOW        = 6 * time.Hour
+	// exit codes of the -once mode
+	EXIT_OK            = 0
+	EXIT_FETCH_FAILED  = 1
+	EXIT_NOTIFY_FAILED = 2
+	// SMTP submission port, STARTTLS is used when the server offers it
+	DEFAULT_SMTP_PORT = "587"
+	// exit code of -selftest when a step fails
+	EXIT_SELFTEST_FAILED = 3
+	// time allowed to finish the current cycle after SIGTERM/SIGINT
+	DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+	DEFAULT_FETCH_TIMEOUT    = 30 * time.Second
+	// default tolerances when matching a quake to a USGS event
+	DEFAULT_USGS_MATCH_MINUTES = 3
+	DEFAULT_USGS_MATCH_KM      = 100.0
+	// tsunami information page and defaults for watching it after strong quakes
+	DEFAULT_TSUNAMI_INFO_URL     = "https://www.phivolcs.dost.gov.ph/index.php/tsunami/tsunami-information"
+	DEFAULT_TSUNAMI_CHECK_MAG    = 6.5
+	DEFAULT_TSUNAMI_WATCH_WINDOW = 12 * time.Hour
+	DEFAULT_MIN_POST_INTERVAL_MS = 1000
+	// attempts at sending a Matrix message, waiting MATRIX_RETRY_BACKOFF times the attempt squared in between
+	DEFAULT_MATRIX_MAX_RETRIES   = 5
+	DEFAULT_MATRIX_RETRY_BACKOFF = time.Second
+	// longest rate limit wait honored before retrying, as long as the fetch error backoff
+	DEFAULT_MATRIX_MAX_RETRY_AFTER = MAX_ERROR_BACKOFF
+	// bulletin pages fetched in parallel, and the minimum time between starting two fetches
+	DEFAULT_BULLETIN_FETCH_CONCURRENCY = 4
+	DEFAULT_BULLETIN_FETCH_INTERVAL_MS = 250
+	// cycles without parsed quakes, or age of the freshest quake, before alerting about a layout change
+	DEFAULT_LAYOUT_ALERT_CYCLES = 3
+	DEFAULT_STALE_AFTER         = 12 * time.Hour
+	// magnitude tiers of the new-quake alert styling
+	DEFAULT_SEVERITY_MODERATE_MAG = 4.5
+	DEFAULT_SEVERITY_STRONG_MAG   = 6.0
+	// how similar (0-100) a revised location must stay to the announced one to count as unchanged
+	DEFAULT_UPDATE_LOCATION_SIMILARITY = 80
+	// consecutive fetch failures before polling slows down to the degraded interval
+	DEFAULT_FETCH_FAILURE_THRESHOLD = 10
+	DEFAULT_DEGRADED_POLL_INTERVAL  = 30 * time.Minute
+	// how bulletin updates are posted when the initial alert's event is known
+	UPDATE_MODE_REPLY = "reply"
+	UPDATE_MODE_EDIT  = "edit"
+	// quakes at or above this magnitude are posted even during quiet hours
+	DEFAULT_QUIET_OVERRIDE_MAG = 6.0
+	// window after a mainshock, and distance from it, within which smaller quakes are clustered
+	DEFAULT_CLUSTER_WINDOW    = 6 * time.Hour
+	DEFAULT_CLUSTER_RADIUS_KM = 30.0
 	// file to store last fetched quakes to check if a quake needs to be updated
 	CACHE_FILE = "last_quakes.json"
 	// file to keep track of already posted quakes
 	POST_QUAKE_FILE = "posted_quakes.json" // files to store posted matrix quakes
+	// file to keep the ETag/Last-Modified of the last parsed PHIVOLCS page for conditional GETs
+	FETCH_STATE_FILE = "fetch_state.json"
+	// file to remember watched quakes and the last posted tsunami advisory
+	TSUNAMI_STATE_FILE = "tsunami_state.json"
+	// file to cache scraped bulletin details by bulletin URL
+	BULLETIN_CACHE_FILE = "bulletin_cache.json"
+	// file to queue alerts deferred during quiet hours
+	DEFERRED_ALERTS_FILE = "deferred_alerts.json"
+	// file to keep the aftershock summaries being edited
+	CLUSTER_STATE_FILE = "clusters.json"
+	// file to keep content hashes of posted alerts, guarding against duplicates
+	POSTED_HASHES_FILE = "posted_hashes.json"
+	// file to keep the sub-threshold quakes of the past 24 hours for the daily digest
+	DIGEST_STATE_FILE = "digest.json"
+	// file to keep the last alert sequence number of the file state backend
+	SEQUENCE_FILE = "alert_sequence.json"
+	// SQLite database of the sqlite state backend
+	STATE_DB_FILE = "state.db"
+	// file to cache the geocoded REF_POINT_PLACE
+	GEOCODE_CACHE_FILE = "geocode_cache.json"
+	// Nominatim search endpoint used to geocode REF_POINT_PLACE
+	DEFAULT_GEOCODER_URL = "https://nominatim.openstreetmap.org/search"
+	// User-Agent sent to PHIVOLCS so they can identify the client
+	USER_AGENT = "phivolcs-eq-to-matrix (+https://github.com/vincejv/phivolcs-eq-to-matrix)"
 	// PHIVOLCS URL and defaults
 	PHIVOLCS_BASE_URL = "https://earthquake.phivolcs.dost.gov.ph"
-	// minimum magnitude to consider for posting even outside the refRadiusKm of refPoint
+	// default minimum magnitude to consider for posting even outside the refRadiusKm of refPoint
 	// e.g. a strong quake far away should still be reported
 	// while a weaker quake nearby should also be reported
 	GLOBAL_MAG_THRESH = 4.5
-	// minimum magnitude to consider when within refRadiusKm of refPoint (otherwise use globalMagThresh)
+	// default minimum magnitude to consider when within refRadiusKm of refPoint or inside GEOFENCE_FILE (otherwise use globalMagThresh)
 	LOCAL_MAG_THRESH = 4.0
 	// Google maps URL format
 	MAPS_BASE_URL = "https://www.google.com/maps?q="
@@ -79,111 +198,549 @@ var (
 	refPointLat = getEnvFloat("REF_POINT_LAT", DEFAULT_REF_POINT_LAT)
 	refPointLon = getEnvFloat("REF_POINT_LON", DEFAULT_REF_POINT_LON)
 	refRadiusKm = getEnvFloat("REF_RADIUS_KM", DEFAULT_REF_RADIUS_KM)
+	// minimum magnitudes posted inside the local area and elsewhere, 0 posts everything
+	localMagThresh  = getEnvFloat("LOCAL_MAG_THRESH", LOCAL_MAG_THRESH)
+	globalMagThresh = getEnvFloat("GLOBAL_MAG_THRESH", GLOBAL_MAG_THRESH)
+	// raise the threshold gradually from the local to the global one up to twice REF_RADIUS_KM
+	thresholdFalloff = getEnvBool("FALLOFF", false)
+	falloffExponent  = getEnvFloat("FALLOFF_EXPONENT", 1)
+	// show the distance to the reference point and the threshold it implied in alerts
+	showAlertDistance = getEnvBool("SHOW_ALERT_DISTANCE", false)
+	// name of the reference point in the distance line of alerts, e.g. "Cebu City"
+	refPointName = os.Getenv("REF_POINT_NAME")
+	// only show the distance line for quakes this close to the reference point, 0 to always show it
+	distanceDisplayRadiusKm = getEnvFloat("DISTANCE_DISPLAY_RADIUS_KM", 0)
+	// languages of the alert messages: en, fil or en+fil for both in one message
+	messageLang = getEnvString("MESSAGE_LANG", LANG_EN)
+	// GeoJSON Polygon/MultiPolygon used instead of the radius for the local threshold
+	geofenceFile = os.Getenv("GEOFENCE_FILE")
+	// JSON file of destinations with their own notifiers and rules, replacing the notifier settings above
+	configFile = os.Getenv("CONFIG_FILE")
+	// offshore quakes, outside the GeoJSON land polygons, need OFFSHORE_MAG_OFFSET more magnitude
+	offshoreLandFile  = os.Getenv("OFFSHORE_LAND_FILE")
+	offshoreMagOffset = getEnvFloat("OFFSHORE_MAG_OFFSET", 0)
+	// PEIS level (e.g. "IV") any reported intensity must reach to post a quake below the thresholds, disabled when unset
+	minReportedIntensity = os.Getenv("MIN_REPORTED_INTENSITY")
+	// place name geocoded at startup into the reference point, e.g. "Cebu City"
+	refPointPlace = os.Getenv("REF_POINT_PLACE")
+	geocoderURL   = getEnvString("GEOCODER_URL", DEFAULT_GEOCODER_URL)
+	// when set, export the posted quake history as CSV to this path ("-" for stdout) and exit
+	exportCSVPath = os.Getenv("EXPORT_CSV")
+	// append-only JSON Lines log of every quake and revision seen, disabled when empty
+	archiveFile = os.Getenv("ARCHIVE_FILE")
+	// when set, convert ARCHIVE_FILE to this format (csv) on stdout and exit
+	exportArchiveFormat = os.Getenv("EXPORT_ARCHIVE")
+	// when set, replay the quake snapshots of this JSON file through the detection and exit
+	replayFile = os.Getenv("REPLAY_FILE")
+	// address for the optional HTTP API (e.g. ":8080"), disabled when empty
+	apiListenAddr = os.Getenv("API_LISTEN_ADDR")
+	// address for the /healthz and /status endpoints (e.g. ":8081"), disabled when unset
+	statusListenAddr = os.Getenv("STATUS_LISTEN_ADDR")
+	// time to wait between polls of the PHIVOLCS page
+	pollInterval = getEnvDuration("POLL_INTERVAL", DEFAULT_POLL_INTERVAL)
+	// posted quakes older than this are forgotten, e.g. "60d" or "720h"
+	postedRetention = getEnvDurationOrDays("POSTED_RETENTION", DEFAULT_POSTED_RETENTION)
+	// first retry delay after a fetch/parse error, doubled on each consecutive error
+	errorRetryInterval = getEnvDuration("ERROR_RETRY_INTERVAL", DEFAULT_ERROR_RETRY_INTERVAL)
+	// poll faster after a strong quake within REF_RADIUS_KM, extended by further such quakes
+	aftershockTriggerMag   = getEnvFloat("AFTERSHOCK_TRIGGER_MAG", DEFAULT_AFTERSHOCK_TRIGGER_MAG)
+	aftershockPollInterval = getEnvDuration("AFTERSHOCK_POLL_INTERVAL", DEFAULT_AFTERSHOCK_POLL_INTERVAL)
+	aftershockWindow       = getEnvDuration("AFTERSHOCK_WINDOW", DEFAULT_AFTERSHOCK_WINDOW)
+	// drain timeout on SIGTERM/SIGINT before exiting forcefully
+	shutdownTimeout = getEnvDuration("SHUTDOWN_TIMEOUT", DEFAULT_SHUTDOWN_TIMEOUT)
+	// run a single fetch, diff, post and save cycle and exit, e.g. from cron
+	runOnce = getEnvBool("RUN_ONCE", false)
+	// log messages instead of posting them to Matrix
+	dryRun = getEnvBool("DRY_RUN", false)
+	// directory all state files are kept in, e.g. a persistent volume; DATA_DIR is accepted as well
+	stateDir = getEnvString("STATE_DIR", getEnvString("DATA_DIR", "."))
+	// how long to wait for another instance to release the state lock, unset exits right away
+	lockWait = getEnvDuration("LOCK_WAIT", 0)
+	// where fetched and posted quakes are kept: JSON files, a SQLite database or Redis
+	stateBackend = strings.ToLower(getEnvString("STATE_BACKEND", STATE_BACKEND_FILE))
+	// Redis server of STATE_BACKEND=redis, e.g. redis://:password@localhost:6379/0
+	redisURL = os.Getenv("REDIS_URL")
+	// KEY=VALUE file whose reloadable settings are re-read on SIGHUP
+	envFile = os.Getenv("ENV_FILE")
+	// comma-separated sinks alerts are posted to: matrix, telegram, discord, webhook, email
+	notifierNames = getEnvString("NOTIFIERS", NOTIFIER_MATRIX)
+	// Telegram bot token and chat (numeric ID or @channel) for the telegram notifier
+	telegramBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+	telegramChatID   = os.Getenv("TELEGRAM_CHAT_ID")
+	// Discord channel webhook for the discord notifier
+	discordWebhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	// endpoint the webhook notifier POSTs quakes to as JSON, with an optional Authorization header value
+	webhookURL        = os.Getenv("WEBHOOK_URL")
+	webhookAuthHeader = os.Getenv("WEBHOOK_AUTH_HEADER")
+	// SMTP server and addresses for the email notifier, EMAIL_TO is comma-separated
+	smtpHost  = os.Getenv("SMTP_HOST")
+	smtpPort  = getEnvString("SMTP_PORT", DEFAULT_SMTP_PORT)
+	smtpUser  = os.Getenv("SMTP_USER")
+	smtpPass  = os.Getenv("SMTP_PASS")
+	emailFrom = os.Getenv("EMAIL_FROM")
+	emailTo   = os.Getenv("EMAIL_TO")
+	// "text" keeps the classic log lines, "json" writes one object per line
+	logFormat = getEnvString("LOG_FORMAT", LOG_FORMAT_TEXT)
+	// minimum level logged: debug, info, warn or error
+	logLevel = getEnvString("LOG_LEVEL", "info")
+	// PEM bundle of extra CAs trusted when fetching PHIVOLCS pages
+	phivolcsCAFile = os.Getenv("PHIVOLCS_CA_FILE")
+	// skip TLS verification of PHIVOLCS pages, only when explicitly enabled
+	phivolcsInsecureTLS = getEnvBool("PHIVOLCS_INSECURE_TLS", false)
+	// timeout of a single PHIVOLCS request, including reading the body
+	fetchTimeout = getEnvDuration("FETCH_TIMEOUT", DEFAULT_FETCH_TIMEOUT)
+	// cross-check quakes with the USGS FDSN feed before posting
+	usgsEnrich       = getEnvBool("USGS_ENRICH", false)
+	usgsMatchMinutes = getEnvInt("USGS_MATCH_MINUTES", DEFAULT_USGS_MATCH_MINUTES)
+	usgsMatchKm      = getEnvFloat("USGS_MATCH_KM", DEFAULT_USGS_MATCH_KM)
+	// send only the plain body without HTML and leading emoji, for bridges to IRC/SMS
+	plainOnly = getEnvBool("PLAIN_ONLY", false)
+	// tsunami information follow-ups, checked after quakes at or above the magnitude
+	tsunamiInfoURL        = getEnvString("TSUNAMI_INFO_URL", DEFAULT_TSUNAMI_INFO_URL)
+	tsunamiCheckMagnitude = getEnvFloat("TSUNAMI_CHECK_MAGNITUDE", DEFAULT_TSUNAMI_CHECK_MAG)
+	tsunamiWatchWindow    = getEnvDuration("TSUNAMI_WATCH_WINDOW", DEFAULT_TSUNAMI_WATCH_WINDOW)
+	// post the above-threshold quakes already listed on the first run with no state files,
+	// off by default since it can flood the room with hundreds of historical alerts
+	// (unrelated to the -backfill flag, which imports monthly archives)
+	backfillOnFirstRun = getEnvBool("BACKFILL", false)
+	// quakes this recent are still posted on the first run instead of being seeded, unset seeds all
+	firstRunPostWindow = getEnvDuration("FIRST_RUN_POST_WINDOW", 0)
+	// minimum time between two Matrix posts in milliseconds
+	minPostIntervalMs = getEnvInt("MIN_POST_INTERVAL_MS", DEFAULT_MIN_POST_INTERVAL_MS)
+	// attempts at sending a Matrix message and the base of the quadratic backoff between them
+	matrixMaxRetries   = getEnvInt("MATRIX_MAX_RETRIES", DEFAULT_MATRIX_MAX_RETRIES)
+	matrixRetryBackoff = getEnvDuration("MATRIX_RETRY_BACKOFF", DEFAULT_MATRIX_RETRY_BACKOFF)
+	// cap on the wait a 429 from the homeserver asks for, a huge Retry-After must not stall polling
+	matrixMaxRetryAfter = getEnvDuration("MATRIX_MAX_RETRY_AFTER", DEFAULT_MATRIX_MAX_RETRY_AFTER)
+	// bounded worker pool for fetching bulletin pages, polite to PHIVOLCS during swarms
+	bulletinFetchConcurrency = getEnvInt("BULLETIN_FETCH_CONCURRENCY", DEFAULT_BULLETIN_FETCH_CONCURRENCY)
+	bulletinFetchIntervalMs  = getEnvInt("BULLETIN_FETCH_INTERVAL_MS", DEFAULT_BULLETIN_FETCH_INTERVAL_MS)
+	// operator alerts when PHIVOLCS stops parsing, logged only when no admin room is set
+	matrixAdminRoomID = os.Getenv("MATRIX_ADMIN_ROOM_ID")
+	layoutAlertCycles = getEnvInt("LAYOUT_ALERT_CYCLES", DEFAULT_LAYOUT_ALERT_CYCLES)
+	staleAfter        = getEnvDuration("STALE_AFTER", DEFAULT_STALE_AFTER)
+	// back off to a long poll interval while PHIVOLCS stays unreachable, alerting once per outage
+	fetchFailureThreshold = getEnvInt("FETCH_FAILURE_THRESHOLD", DEFAULT_FETCH_FAILURE_THRESHOLD)
+	degradedPollInterval  = getEnvDuration("DEGRADED_POLL_INTERVAL", DEFAULT_DEGRADED_POLL_INTERVAL)
+	// post a notice to MATRIX_ROOM_ID when fetches succeed again after such an outage
+	notifyOnRecovery = getEnvBool("NOTIFY_ON_RECOVERY", false)
+	// "reply" threads updates under the initial alert, "edit" edits it in place
+	updateMode = strings.ToLower(getEnvString("UPDATE_MODE", UPDATE_MODE_REPLY))
+	// HH:MM window in Philippine time during which weaker alerts are held, disabled when unset.
+	// QUIET_HOURS gives both ends at once, e.g. "22:00-07:00".
+	quietHours             = os.Getenv("QUIET_HOURS")
+	quietHoursStart        = os.Getenv("QUIET_HOURS_START")
+	quietHoursEnd          = os.Getenv("QUIET_HOURS_END")
+	quietOverrideMagnitude = getEnvFloat("QUIET_MIN_MAG", getEnvFloat("QUIET_OVERRIDE_MAGNITUDE", DEFAULT_QUIET_OVERRIDE_MAG))
+	// comma-separated substrings (or "re:" regexes) of the origin, included quakes get the local
+	// threshold wherever they are and excluded ones are never posted
+	originInclude = os.Getenv("ORIGIN_INCLUDE")
+	originExclude = os.Getenv("ORIGIN_EXCLUDE")
+	// comma-separated provinces, quakes elsewhere need the global threshold, disabled when unset
+	provincesFilter = os.Getenv("PROVINCES_FILTER")
+	// threshold offsets by depth, e.g. "0-30:-0.3,30-70:0,70-300:+0.5,300+:+1.0", disabled when unset
+	depthRules = os.Getenv("DEPTH_RULES")
+	// post a static map of the epicenter after each Matrix alert, from a provider URL template
+	attachMapImages     = getEnvBool("ATTACH_MAP_IMAGE", false)
+	mapImageURLTemplate = getEnvString("MAP_IMAGE_URL", DEFAULT_MAP_IMAGE_URL)
+	mapImageAPIKey      = os.Getenv("MAP_IMAGE_API_KEY")
+	// alerts from this magnitude mention @room in Matrix for a loud notification, 0 disables it
+	mentionRoomMagnitude = getEnvFloat("MENTION_ROOM_MAGNITUDE", 0)
+	// magnitudes from which new-quake alerts are styled as moderate (🟠) and strong (🔴) instead of light (🟢)
+	severityModerateMag = getEnvFloat("SEVERITY_MODERATE_MAG", DEFAULT_SEVERITY_MODERATE_MAG)
+	severityStrongMag   = getEnvFloat("SEVERITY_STRONG_MAG", DEFAULT_SEVERITY_STRONG_MAG)
+	// smallest changes since the last alert that make a revision worth posting, 0 ignores that value.
+	// With all of them 0 every revision is posted.
+	updateMinMagDelta        = getEnvFloat("UPDATE_MIN_MAG_DELTA", 0)
+	updateMinDepthDeltaKm    = getEnvFloat("UPDATE_MIN_DEPTH_DELTA_KM", 0)
+	updateMinDistDeltaKm     = getEnvFloat("UPDATE_MIN_DIST_DELTA_KM", 0)
+	updateLocationSimilarity = getEnvFloat("UPDATE_LOCATION_SIMILARITY", DEFAULT_UPDATE_LOCATION_SIMILARITY)
+	// quakes below this are never posted, whatever the regional threshold, 0 disables the floor
+	absoluteMinMagnitude = getEnvFloat("ABSOLUTE_MIN_MAGNITUDE", 0)
+	// summarize aftershocks of a posted quake in one edited message instead of individual alerts
+	clusterAftershocks = getEnvBool("CLUSTER_AFTERSHOCKS", false)
+	clusterWindow      = getEnvDuration("CLUSTER_WINDOW", DEFAULT_CLUSTER_WINDOW)
+	clusterRadiusKm    = getEnvFloat("CLUSTER_RADIUS_KM", DEFAULT_CLUSTER_RADIUS_KM)
+	// only quakes from this magnitude start a cluster, 0 lets any posted quake start one
+	aftershockMainshockMag = getEnvFloat("AFTERSHOCK_MAINSHOCK_MAG", 0)
+	// clustered aftershocks from this magnitude are also posted on their own, 0 posts none of them
+	aftershockDisplayMag = getEnvFloat("AFTERSHOCK_DISPLAY_MAG", 0)
+	// post a new summary at most this often instead of editing it on every aftershock, 0 edits it
+	aftershockSummaryInterval = getEnvDuration("AFTERSHOCK_SUMMARY_INTERVAL", 0)
+	// HH:MM in Philippine time to post the daily digest of quakes below the threshold, disabled when unset
+	digestTime = os.Getenv("DIGEST_TIME")
+	// comma-separated YYYY-MM months to backfill from the PHIVOLCS archives (flag only)
+	backfillMonths string
+	// YYYY-MM[-DD] date from which the PHIVOLCS archives are imported into the state at startup
+	importFrom = os.Getenv("IMPORT_FROM")
+	// run the deployment self-test and exit (flag only)
+	selfTest bool
+	// post a single test alert to the notifiers and exit
+	sendTestAlert = getEnvBool("SEND_TEST_ALERT", false)
 )
 
 // ---- Main loop ----
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Println("🌋 PHIVOLCS-to-Matrix earthquake monitor started successfully ✅")
-	log.Printf("Parsing up to %d quake entries from PHIVOLCS", maxQuakeEntries)
+	parseFlags()
+	setupLogging()
+	var err error
+	if configFile != "" {
+		if destinations, err = loadDestinations(configFile); err != nil {
+			log.Fatalf("❌ Failed to load CONFIG_FILE: %v", err)
+		}
+		log.Printf("📬 Posting to the %d destinations of %s", len(destinations), configFile)
+	}
+	if geofenceFile != "" {
+		if geofence, err = loadGeofence(geofenceFile); err != nil {
+			log.Fatalf("❌ Failed to load GEOFENCE_FILE: %v", err)
+		}
+		log.Printf("🗺️ Using the %d polygons of %s for the local magnitude threshold", len(geofence.polygons), geofenceFile)
+	}
+	if offshoreLandFile != "" {
+		if landArea, err = loadGeofence(offshoreLandFile); err != nil {
+			log.Fatalf("❌ Failed to load OFFSHORE_LAND_FILE: %v", err)
+		}
+		log.Printf("🏝️ Using the %d polygons of %s to tell offshore quakes", len(landArea.polygons), offshoreLandFile)
+	}
+	if err := validateConfig(); err != nil {
+		// the tests exit with their own code when a step fails
+		if selfTest || sendTestAlert {
+			log.Printf("❌ Self-test failed at the configuration step:\n%v", err)
+			os.Exit(EXIT_SELFTEST_FAILED)
+		}
+		log.Fatalf("❌ Invalid configuration:\n%v", err)
+	}
+	if err := prepareStateDir(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
-	for {
-		doc, err := fetchDocument(PHIVOLCS_BASE_URL)
-		if err != nil {
-			log.Printf("Fetch error: %v", err)
-			time.Sleep(30 * time.Second)
-			continue
+	// one-off replay mode, keeps its state in memory and never touches the network
+	if replayFile != "" {
+		if err := runReplay(os.Stdout, replayFile); err != nil {
+			log.Fatalf("❌ Replay failed: %v", err)
 		}
+		return
+	}
 
-		latestQuakes, err := parseFirstN(doc, maxQuakeEntries)
+	// exporting and the tests only read state, they may run next to the monitor
+	releaseLock := func() {}
+	if exportCSVPath == "" && exportArchiveFormat == "" && !selfTest && !sendTestAlert {
+		release, err := acquireInstanceLock()
 		if err != nil {
-			log.Printf("Parse error: %v", err)
-			time.Sleep(30 * time.Second)
-			continue
+			log.Fatalf("❌ %v", err)
 		}
+		releaseLock = release
+		defer releaseLock()
+	}
+	loadStateFiles()
+	store, err := openStateStore()
+	if err != nil {
+		log.Fatalf("❌ Failed to open the state store: %v", err)
+	}
+	stateStore = store
+	defer stateStore.Close()
+	if err := initHTTPClients(); err != nil {
+		log.Fatalf("❌ Failed to set up HTTP clients: %v", err)
+	}
 
-		// this is used to determine if a quake is new or updated
-		lastFetchQuakes := readAllQuakesFromFile(CACHE_FILE, quakeOriginKey)
+	// one-off export mode, runs without entering the poll loop
+	if exportCSVPath != "" {
+		if err := exportPostedQuakesCSV(exportCSVPath); err != nil {
+			log.Fatalf("❌ CSV export failed: %v", err)
+		}
+		return
+	}
+	if exportArchiveFormat != "" {
+		if err := exportArchive(exportArchiveFormat); err != nil {
+			log.Fatalf("❌ Archive export failed: %v", err)
+		}
+		return
+	}
 
-		// this is used to determine if a quake has already been posted to matrix
-		postedQuakes := readAllQuakesFromFile(POST_QUAKE_FILE, quakeLocationKey)
+	// one-off backfill mode, seeds the state files without posting
+	if backfillMonths != "" {
+		if err := runBackfill(context.Background(), backfillMonths); err != nil {
+			log.Fatalf("❌ Backfill failed: %v", err)
+		}
+		return
+	}
+
+	resolveRefPointPlace(context.Background(), nominatimGeocoder{endpoint: geocoderURL})
+
+	// one-off self-test mode, posts a test alert without touching the state files
+	if selfTest {
+		os.Exit(runSelfTest(context.Background()))
+	}
+	if sendTestAlert {
+		os.Exit(runTestAlert())
+	}
 
-		var changed []Quake
-		var postedQuakesToSave []Quake
-		var updated []struct {
-			New Quake
-			Old Quake
+	notifiers = allNotifiers()
+	// the flags are parsed after the gauges were initialized from the environment
+	metricLocalThresh.set(localMagThresh)
+	metricGlobalThresh.set(globalMagThresh)
+	if archiveFile != "" {
+		if archive, err = openQuakeArchive(archiveFile); err != nil {
+			log.Fatalf("❌ Failed to open ARCHIVE_FILE: %v", err)
+		}
+		defer archive.Close()
+	}
+	if importFrom != "" {
+		from, _ := parseImportFrom(importFrom) // checked by validateConfig
+		if err := runImport(context.Background(), from); err != nil {
+			log.Printf("❌ Import of the PHIVOLCS archives failed, polling anyway: %v", err)
 		}
+	}
 
-		// parse each quake from latest fetch
-		for _, currentQuake := range latestQuakes {
-			// check if quake exists in last fetch (by origin and datetime)
-			updatedQuakeKey := quakeOriginKey(currentQuake)
-			previousQuake, updateExists := lastFetchQuakes[updatedQuakeKey]
+	log.Println("🌋 PHIVOLCS-to-Matrix earthquake monitor started successfully ✅")
+	log.Printf("Parsing up to %d quake entries from PHIVOLCS", maxQuakeEntries)
+	log.Printf("Posting quakes from M%.1f in the local area and M%.1f elsewhere", localMagThresh, globalMagThresh)
+	if phivolcsInsecureTLS {
+		log.Println("⚠️⚠️⚠️ PHIVOLCS_INSECURE_TLS is set, TLS certificates of PHIVOLCS pages are NOT verified ⚠️⚠️⚠️")
+	}
 
-			if !updateExists {
-				if bulletinNo, _ := getBulletinNumber(currentQuake.Bulletin); bulletinNo != 1 {
-					previousQuake, updateExists = determinePastQuakeThroughHeuristics(lastFetchQuakes, currentQuake)
+	var servers []*http.Server
+	if !runOnce {
+		servers = startHTTPServers()
+	}
+
+	if err := validateMatrixCredentials(); err != nil {
+		log.Printf("⚠️ Matrix credentials could not be validated: %v", err)
+	} else {
+		status.setMatrixValidated(true)
+	}
+
+	// SIGTERM/SIGINT stop polling and cut Matrix retry waits short, the current cycle still writes its state
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go exitAfterDrainTimeout(ctx)
+	watchReloadSignal()
+
+	validators := readPageValidators(stateReadPath(FETCH_STATE_FILE))
+	notModifiedCycles := 0
+	consecutiveErrors := 0
+	firstRun := !stateStore.Exists()
+	exitCode := EXIT_OK
+	for ctx.Err() == nil {
+		fetchStart := time.Now()
+		latestQuakes, _, err := fetchLatestQuakes(ctx, maxQuakeEntries, &validators)
+		if errors.Is(err, ErrNotModified) {
+			notModifiedCycles++
+			consecutiveErrors = 0
+			breaker.succeeded()
+			status.recordFetch(true, consecutiveErrors, notModifiedCycles)
+			slog.Info(fmt.Sprintf("PHIVOLCS page not modified (304), skipping cycle (%d cycles skipped so far)", notModifiedCycles),
+				"http_status", http.StatusNotModified)
+			if runOnce {
+				break
+			}
+			sleepBeforeNextPoll(ctx, currentPollInterval())
+			continue
+		} else if errors.Is(err, ErrTableNotFound) || errors.Is(err, ErrNoRowsParsed) {
+			slog.Warn("⚠️ No quakes parsed, the PHIVOLCS page layout may have changed", "error", err)
+			layout.parseFailed(err)
+			consecutiveErrors++
+			status.recordFetch(false, consecutiveErrors, notModifiedCycles)
+			if runOnce {
+				exitCode = EXIT_FETCH_FAILED
+				break
+			}
+			sleepBeforeNextPoll(ctx, errorBackoff(consecutiveErrors))
+			continue
+		} else if err != nil {
+			consecutiveErrors++
+			status.recordFetch(false, consecutiveErrors, notModifiedCycles)
+			// the outage was already escalated once, keep the retries out of the error log
+			logFetchError := slog.Error
+			if breaker.degraded() {
+				logFetchError = slog.Debug
+			}
+			logFetchError(fmt.Sprintf("Fetch error after %s", time.Since(fetchStart).Round(time.Millisecond)),
+				"consecutive_errors", consecutiveErrors, "error", err)
+			if runOnce {
+				exitCode = EXIT_FETCH_FAILED
+				break
+			}
+			sleepBeforeNextPoll(ctx, breaker.failed(consecutiveErrors, err))
+			continue
+		}
+		consecutiveErrors = 0
+		breaker.succeeded()
+		status.recordFetch(true, consecutiveErrors, notModifiedCycles)
+		layout.parsed(latestQuakes)
+		recordNewestQuake(latestQuakes)
+
+		// on a fresh deploy only seed the state files, otherwise every listed quake looks new
+		if firstRun && !backfillOnFirstRun {
+			firstRun = false
+			if seedFirstRun(latestQuakes, validators) {
+				if runOnce {
+					break
 				}
+				sleepBeforeNextPoll(ctx, currentPollInterval())
+				continue
 			}
+		}
+		firstRun = false
 
-			if !updateExists {
-				// new quake detected
-				postedQuakeKey := quakeLocationKey(currentQuake)
-				_, postedExists := postedQuakes[postedQuakeKey]
-				if !postedExists {
-					magVal, err := strconv.ParseFloat(currentQuake.Magnitude, 64)
-					threshold := magnitudeThresholdFor(currentQuake.Latitude, currentQuake.Longitude)
-
-					if err == nil && magVal >= threshold {
-						changed = append(changed, currentQuake)
-						postedQuakesToSave = append(postedQuakesToSave, currentQuake)
-					}
-				}
-			} else if quakeChanged(previousQuake, currentQuake) &&
-				!updatedQuakeHasBeenPosted(postedQuakes, currentQuake) &&
-				isCurrentAndPastQSignificant(currentQuake, previousQuake) {
-				// updated quake detected
-				updated = append(updated, struct {
-					New Quake
-					Old Quake
-				}{currentQuake, previousQuake})
-				postedQuakesToSave = append(postedQuakesToSave, currentQuake)
+		// this is used to determine if a quake is new or updated
+		lastFetchQuakes := stateStore.LoadFetched()
+
+		// this is used to determine if a quake has already been posted to matrix
+		postedQuakes := stateStore.LoadPosted()
+
+		// a state file was recovered too poorly to tell what was posted, so the listed quakes are
+		// recorded as posted without alerts rather than risking a flood of re-posts
+		if problems := takeStateRecoveryProblems(); len(problems) > 0 {
+			alertStateRecovery(problems)
+			seeded := postedByKey(postedQuakesOf(latestQuakes))
+			for key, p := range postedQuakes {
+				seeded[key] = p
+			}
+			archive.record(latestQuakes)
+			archive.sync()
+			stateStore.SaveFetched(latestQuakes)
+			stateStore.SavePosted(postedToSlice(seeded))
+			savePageValidators(validators, statePath(FETCH_STATE_FILE))
+			if runOnce {
+				break
 			}
+			sleepBeforeNextPoll(ctx, currentPollInterval())
+			continue
+		}
+
+		var postedQuakesToSave []PostedQuake
+		carryOverBulletinDetails(latestQuakes, lastFetchQuakes)
+		enrichIntensityCandidates(ctx, latestQuakes, postedQuakes, time.Now())
+		changed, updated := processQuakes(latestQuakes, lastFetchQuakes, postedQuakes)
+		enrichDetected(ctx, latestQuakes, changed, updated)
+		archive.record(latestQuakes)
+		for _, q := range changed {
+			metricQuakes.inc("new")
+			noteQuakeForAftershockMode(q)
 		}
+		for range updated {
+			metricQuakes.inc("update")
+		}
+
+		// post what was held back during quiet hours before anything new
+		flushed := flushDeferredAlerts(ctx, postedQuakes)
+		postedCount := len(postedQuakes)
 
 		if len(changed) == 0 && len(updated) == 0 {
 			log.Println("No new or updated earthquakes detected.")
+			if flushed {
+				stateStore.SavePosted(postedToSlice(postedQuakes))
+			}
 		} else {
-			// Append to existing slice
-			postedQuakesToSave = append(postedQuakesToSave, mapEqToSlice(postedQuakes)...)
-
 			// Send new quakes
 			for i := len(changed) - 1; i >= 0; i-- {
 				q := changed[i]
-				log.Printf("🆕 New quake detected: %s | M%s | %s", q.DateTime, q.Magnitude, q.Location)
-				if err := postToMatrix(q, false, q); err != nil { // optional: pass q as oldQuake to avoid zero-value
-					log.Printf("Matrix post failed: %v", err)
+				if usgsEnrich {
+					enrichWithUSGS(ctx, &q)
+				}
+				slog.Info(fmt.Sprintf("🆕 New quake detected: %s | M%s | %s", q.DateTime, q.Magnitude, q.Location), quakeLogAttrs(q)...)
+				// cluster summaries are edited in place, which only Matrix supports
+				if clusterAftershocks && notifierEnabled(NOTIFIER_MATRIX) {
+					if mainshock, ok := findMainshock(postedQuakes, postedQuakesToSave, q); ok {
+						addToCluster(ctx, mainshock, q)
+						if !displayAftershock(q) {
+							postedQuakesToSave = append(postedQuakesToSave, newPostedQuake(q))
+							continue
+						}
+					}
+				}
+				posted, err := postAlert(ctx, q, false, q, PostedQuake{}) // optional: pass q as oldQuake to avoid zero-value
+				if errors.Is(err, ErrAlertClaimed) {
+					// the instance that claimed it saves the record
+					continue
+				} else if err != nil {
+					slog.Error("Alert post failed", append(quakeLogAttrs(q), "error", err)...)
+				}
+				postedQuakesToSave = append(postedQuakesToSave, posted)
+				if isTsunamiTrigger(q) {
+					watchTsunamiFor(q)
 				}
 			}
 
 			// Send updated quakes
 			for i := len(updated) - 1; i >= 0; i-- {
 				u := updated[i]
-				log.Printf("🔁 Earthquake bulletin update: %s | %s → %s | %s", u.New.DateTime, u.Old, u.New.Magnitude, u.New.Location)
-				if err := postToMatrix(u.New, true, u.Old); err != nil {
-					log.Printf("Matrix post failed: %v", err)
+				original := findPostedOriginal(postedQuakes, u.Old)
+				if u.Silent {
+					// the record follows the revision so the next one diffs against the newest data
+					delete(postedQuakes, quakeLocationKey(original.Quake))
+					stateStore.ForgetPosted(quakeLocationKey(original.Quake))
+					postedQuakesToSave = append(postedQuakesToSave, silentRevision(original, u.New))
+					continue
+				}
+				if usgsEnrich {
+					enrichWithUSGS(ctx, &u.New)
+				}
+				slog.Info(fmt.Sprintf("🔁 Earthquake bulletin update: %s | %s → %s | %s", u.New.DateTime, u.Old.Magnitude, u.New.Magnitude, u.New.Location),
+					quakeLogAttrs(u.New)...)
+				// thread the revision under (or edit) the initial alert when we know its event
+				posted, err := postAlert(ctx, u.New, true, u.Old, original)
+				if errors.Is(err, ErrAlertClaimed) {
+					// the instance that claimed it saves the records, don't write back the stale original
+					delete(postedQuakes, quakeLocationKey(original.Quake))
+					continue
+				} else if err != nil {
+					slog.Error("Alert post failed", append(quakeLogAttrs(u.New), "error", err)...)
+				}
+				if original.Announced != nil {
+					// a record kept by silent revisions is superseded by the alert
+					delete(postedQuakes, quakeLocationKey(original.Quake))
+					stateStore.ForgetPosted(quakeLocationKey(original.Quake))
+				}
+				postedQuakesToSave = append(postedQuakesToSave, posted)
+				if isTsunamiTrigger(u.New) {
+					watchTsunamiFor(u.New)
 				}
 			}
 
-			// only save if there are new posts
-			saveAllQuakesToFile(postedQuakesToSave, POST_QUAKE_FILE)
+			// Append to existing slice, only save if there are new posts
+			postedQuakesToSave = append(postedQuakesToSave, postedToSlice(postedQuakes)...)
+			stateStore.SavePosted(postedQuakesToSave)
+			postedCount = len(postedQuakesToSave)
+		}
+
+		checkTsunamiAdvisories(ctx)
+		flushClusterSummaries(ctx)
+		digest.record(latestQuakes, postedQuakes, time.Now())
+		digest.postIfDue(ctx, time.Now())
+
+		stateStore.SaveFetched(latestQuakes)
+		savePageValidators(validators, statePath(FETCH_STATE_FILE))
+		archive.sync()
+		status.recordCycle(len(latestQuakes), postedCount, inAftershockMode())
+		if inAftershockMode() {
+			metricAftershock.set(1)
+		} else {
+			metricAftershock.set(0)
 		}
 
-		saveAllQuakesToFile(latestQuakes, CACHE_FILE)
+		if runOnce {
+			if sendFailures > 0 {
+				log.Printf("❌ %d messages failed to deliver", sendFailures)
+				exitCode = EXIT_NOTIFY_FAILED
+			}
+			break
+		}
+		sleepBeforeNextPoll(ctx, currentPollInterval())
+	}
 
-		log.Println("Sleeping for 150 seconds before next poll...")
-		time.Sleep(150 * time.Second)
+	for _, srv := range servers {
+		shutdownAPIServer(srv)
+	}
+	log.Println("👋 Shutting down")
+	// os.Exit skips the deferred calls
+	archive.Close()
+	stateStore.Close()
+	releaseLock()
+	if exitCode != EXIT_OK {
+		os.Exit(exitCode)
 	}
 }
 
@@ -203,45 +760,184 @@ func getEnvInt(envVar string, defaultVal int) int {
 }
 
 // getEnvFloat reads a float environment variable and falls back to a default if not set or invalid.
+// An explicit 0 or negative value is kept, ranges are checked by validateConfig.
 func getEnvFloat(envVar string, defaultVal float64) float64 {
-	val := os.Getenv(envVar)
+	val := strings.TrimSpace(os.Getenv(envVar))
 	if val == "" {
 		return defaultVal
 	}
 	f, err := strconv.ParseFloat(val, 64)
-	if err != nil || f <= 0 {
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
 		log.Printf("⚠️ Invalid %s value (%s), using default %.2f", envVar, val, defaultVal)
 		return defaultVal
 	}
 	return f
 }
 
+// getEnvString reads a string environment variable and falls back to a default if not set.
+func getEnvString(envVar string, defaultVal string) string {
+	if val := os.Getenv(envVar); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "2m30s") and falls back to a default if not set or invalid.
+func getEnvDuration(envVar string, defaultVal time.Duration) time.Duration {
+	val := os.Getenv(envVar)
+	if val == "" {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Invalid %s value (%s), using default %s", envVar, val, defaultVal)
+		return defaultVal
+	}
+	return d
+}
+
+// getEnvDurationOrDays reads a duration environment variable that also accepts days ("60d" or "60"),
+// falling back to a default if not set or invalid.
+func getEnvDurationOrDays(envVar string, defaultVal time.Duration) time.Duration {
+	val := os.Getenv(envVar)
+	if val == "" {
+		return defaultVal
+	}
+	d, err := parseDurationOrDays(val)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s value (%s), using default %s", envVar, val, defaultVal)
+		return defaultVal
+	}
+	return d
+}
+
+// parseDurationOrDays parses a positive Go duration ("720h") or a number of days ("30d" or "30")
+func parseDurationOrDays(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64); err == nil {
+		if days <= 0 {
+			return 0, fmt.Errorf("%q is not positive", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q is not positive", s)
+	}
+	return d, nil
+}
+
+// getEnvBool reads a boolean environment variable (e.g. "true", "1") and falls back to a default if not set or invalid.
+func getEnvBool(envVar string, defaultVal bool) bool {
+	val := os.Getenv(envVar)
+	if val == "" {
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s value (%s), using default %t", envVar, val, defaultVal)
+		return defaultVal
+	}
+	return b
+}
+
 // Fetch and parse HTML
-func fetchDocument(url string) (*goquery.Document, error) {
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	client := &http.Client{Transport: tr}
-	resp, err := client.Get(url)
+func fetchDocument(ctx context.Context, url string) (*goquery.Document, error) {
+	return fetchDocumentIfModified(ctx, url, nil)
+}
+
+// Fetch and parse HTML with a conditional GET when validators are given, returning
+// ErrNotModified on 304 and updating the validators on success
+func fetchDocumentIfModified(ctx context.Context, url string, validators *pageValidators) (doc *goquery.Document, err error) {
+	start := time.Now()
+	defer func() {
+		metricFetchDuration.observe(time.Since(start))
+		switch {
+		case errors.Is(err, ErrNotModified):
+			metricFetches.inc("not_modified")
+		case err != nil:
+			metricFetches.inc("error")
+		default:
+			metricFetches.inc("ok")
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", USER_AGENT)
+	// setting Accept-Encoding ourselves disables the transport's transparent decompression
+	req.Header.Set("Accept-Encoding", "gzip")
+	if validators != nil {
+		validators.apply(req)
+	}
+
+	resp, err := scrapeClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("http get error: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && validators != nil {
+		return nil, ErrNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("status not OK: %s", resp.Status)
 	}
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("gzip decode error: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// some pages are windows-1252 without a proper charset header, decode to UTF-8
+	// using the Content-Type header and meta tags so e.g. "Peñablanca" isn't mojibake
+	utf8Body, err := charset.NewReader(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("charset decode error: %w", err)
+	}
+
+	doc, err = goquery.NewDocumentFromReader(utf8Body)
 	if err != nil {
 		return nil, fmt.Errorf("goquery parse error: %w", err)
 	}
+	// keep the final (post-redirect) page URL so relative links can be resolved
+	doc.Url = resp.Request.URL
+	if validators != nil {
+		validators.update(resp)
+	}
 	return doc, nil
 }
 
-// Extract datetime (in UTC) from bulletin URL if possible
-func extractDateTimeFromURL(url string) (string, error) {
+// Resolve a bulletin link (which PHIVOLCS writes with backslashes and relative to the page)
+// to an absolute URL
+func absoluteBulletinURL(pageURL *url.URL, link string) string {
+	link = strings.ReplaceAll(strings.TrimSpace(link), "\\", "/")
+	ref, err := url.Parse(link)
+	if err != nil {
+		return fmt.Sprintf("%s/%s", PHIVOLCS_BASE_URL, strings.TrimLeft(link, "/"))
+	}
+	if pageURL == nil {
+		pageURL, _ = url.Parse(PHIVOLCS_BASE_URL + "/")
+	}
+	return pageURL.ResolveReference(ref).String()
+}
+
+// Extract datetime (in UTC) from bulletin URL if possible, returned in Philippine time
+func extractDateTimeFromURL(url string) (time.Time, error) {
 	// Example: https://earthquake.phivolcs.dost.gov.ph/2025_Earthquake_Information/September/2025_0930_164854_B1.html
 	re := regexp.MustCompile(`(\d{4})_(\d{2})(\d{2})_(\d{6})`)
 	match := re.FindStringSubmatch(url)
 	if len(match) != 5 {
-		return "", fmt.Errorf("no datetime in URL")
+		return time.Time{}, fmt.Errorf("no datetime in URL")
 	}
 
 	// Parse values
@@ -253,21 +949,17 @@ func extractDateTimeFromURL(url string) (string, error) {
 	// Interim internal format: "2006-01-02 15:04:05" in UTC (time in URL is in UTC)
 	// Note: time.Parse uses reference time "Mon Jan 2 15:04:05 MST 2006"
 	// to determine the format, so we use that exact date/time in the layout.
-	// We then convert to local time (Philippine time, UTC+8)
-	// when formatting the final output and storing interally.
+	// We then convert to local time (Asia/Manila) for storing internally.
 	// This is important for correct sorting and comparison of quake times.
 	// PHIVOLCS Bulletin URL reports times in UTC, but we want to store in local time.
 	// We assume the time in the URL is always in UTC.
 	t, err := time.Parse("2006-01-02 15:04:05", fmt.Sprintf("%s-%s-%s %s:%s:%s", year, month, day, hh, mm, ss))
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
 
-	// Convert from UTC to Philippine time (+8)
-	t = t.Add(8 * time.Hour)
-
-	// Format in the desired local format
-	return t.Format(DATE_TIME_LAYOUT), nil
+	// Convert from UTC to Philippine time
+	return t.In(manilaLoc), nil
 }
 
 // Haversine formula to calculate distance between two lat/lon points in kilometers
@@ -281,18 +973,39 @@ func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
 	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 }
 
-// Determine magnitude threshold based on distance from reference point
+// bearingDeg returns the initial great-circle bearing from the first point to the second,
+// in degrees clockwise from north within 0..360
+func bearingDeg(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180.0, lat2*math.Pi/180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+	y := math.Sin(dLon) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180.0/math.Pi+360, 360)
+}
+
+// Determine the magnitude a quake must reach to be posted: the regional threshold,
+// raised to ABSOLUTE_MIN_MAGNITUDE when that is higher
 func magnitudeThresholdFor(latStr, lonStr string) float64 {
-	lat, err1 := strconv.ParseFloat(latStr, 64)
-	lon, err2 := strconv.ParseFloat(lonStr, 64)
-	if err1 != nil || err2 != nil {
-		return GLOBAL_MAG_THRESH // fallback if coordinates invalid
+	return math.Max(regionalThresholdFor(latStr, lonStr), absoluteMinMagnitude)
+}
+
+// Determine magnitude threshold based on distance from reference point, or on GEOFENCE_FILE when set.
+// Quakes with unparseable coordinates are outside every local area.
+func regionalThresholdFor(latStr, lonStr string) float64 {
+	lat, ok1 := parseCoord(latStr)
+	lon, ok2 := parseCoord(lonStr)
+	if !ok1 || !ok2 {
+		slog.Warn(fmt.Sprintf("⚠️ Unparseable coordinates %q, %q, using the global threshold", latStr, lonStr))
+		return globalMagThresh
 	}
 
-	if distanceKm(lat, lon, refPointLat, refPointLon) <= refRadiusKm {
-		return LOCAL_MAG_THRESH // local threshold
+	if geofence != nil {
+		if geofence.contains(lat, lon) {
+			return localMagThresh // local threshold
+		}
+		return globalMagThresh // outside area
 	}
-	return GLOBAL_MAG_THRESH // outside area
+	return thresholdAtDistance(distanceKm(lat, lon, refPointLat, refPointLon), currentThresholdConfig())
 }
 
 // Normalize date time string from PHIVOLCS raw table to ensure consistent format
@@ -305,33 +1018,137 @@ func normalizeDateTime(date string) string {
 	return date
 }
 
+// Normalize a coordinate to COORD_DECIMALS places so "123.90", "123.900" and " 123.9" compare equal.
+// Values that aren't numbers are only trimmed.
+func normalizeCoord(coord string) string {
+	coord = strings.TrimSpace(coord)
+	f, ok := parseCoord(coord)
+	if !ok {
+		return coord
+	}
+	return strconv.FormatFloat(f, 'f', COORD_DECIMALS, 64)
+}
+
+// depthChanged reports whether two quakes have different normalized depths
+func depthChanged(a, b Quake) bool {
+	return normalizeDepth(a.Depth) != normalizeDepth(b.Depth)
+}
+
+// coordsChanged reports whether two quakes are at different normalized coordinates
+func coordsChanged(a, b Quake) bool {
+	return normalizeCoord(a.Latitude) != normalizeCoord(b.Latitude) ||
+		normalizeCoord(a.Longitude) != normalizeCoord(b.Longitude)
+}
+
+// Canonical quake table column names
+const (
+	COL_DATE_TIME = "datetime"
+	COL_LATITUDE  = "latitude"
+	COL_LONGITUDE = "longitude"
+	COL_DEPTH     = "depth"
+	COL_MAGNITUDE = "magnitude"
+	COL_LOCATION  = "location"
+)
+
+// columns that must all be present in a header row for a table to be considered the quake table
+var requiredQuakeColumns = []string{COL_DATE_TIME, COL_LATITUDE, COL_LONGITUDE, COL_DEPTH, COL_MAGNITUDE, COL_LOCATION}
+
+// ErrTableNotFound is returned when no table on the page has the expected quake header row,
+// which usually means PHIVOLCS changed their page layout
+var ErrTableNotFound = errors.New("quake table not found")
+
+// Map a header cell text (e.g. "Date - Time (Philippine Time)", "Depth (km)") to its canonical column name
+func headerColumnName(text string) string {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	switch {
+	case strings.HasPrefix(text, "date"):
+		return COL_DATE_TIME
+	case strings.HasPrefix(text, "latitude"):
+		return COL_LATITUDE
+	case strings.HasPrefix(text, "longitude"):
+		return COL_LONGITUDE
+	case strings.HasPrefix(text, "depth"):
+		return COL_DEPTH
+	case strings.HasPrefix(text, "mag"):
+		return COL_MAGNITUDE
+	case strings.HasPrefix(text, "location"):
+		return COL_LOCATION
+	}
+	return ""
+}
+
+// Locate the quake table by its header row text, returning the data rows that follow
+// the header and a column name to cell index map
+func findQuakeTable(doc *goquery.Document) (*goquery.Selection, map[string]int, error) {
+	var dataRows *goquery.Selection
+	var columns map[string]int
+
+	doc.Find("table").EachWithBreak(func(_ int, table *goquery.Selection) bool {
+		// only rows of this table, not of tables nested inside it
+		rows := table.Find("tr").FilterFunction(func(_ int, tr *goquery.Selection) bool {
+			return tr.Closest("table").IsSelection(table)
+		})
+
+		rows.EachWithBreak(func(i int, tr *goquery.Selection) bool {
+			cols := make(map[string]int)
+			tr.ChildrenFiltered("th, td").Each(func(j int, cell *goquery.Selection) {
+				if name := headerColumnName(cell.Text()); name != "" {
+					if _, exists := cols[name]; !exists {
+						cols[name] = j
+					}
+				}
+			})
+			for _, name := range requiredQuakeColumns {
+				if _, ok := cols[name]; !ok {
+					return true
+				}
+			}
+			dataRows = rows.Slice(i+1, rows.Length())
+			columns = cols
+			return false
+		})
+		return columns == nil
+	})
+
+	if columns == nil {
+		return nil, nil, ErrTableNotFound
+	}
+	return dataRows, columns, nil
+}
+
 // Parse quake table
 func parseFirstN(doc *goquery.Document, n int) ([]Quake, error) {
 	var results []Quake
-	selector := "body > div > table:nth-child(4) > tbody > tr"
-	rows := doc.Find(selector)
+	rows, cols, err := findQuakeTable(doc)
+	if err != nil {
+		return nil, err
+	}
 
-	rows.EachWithBreak(func(i int, tr *goquery.Selection) bool {
-		if i >= n {
+	rows.EachWithBreak(func(_ int, tr *goquery.Selection) bool {
+		if len(results) >= n {
 			return false
 		}
-		tds := tr.Find("td")
-		if tds.Length() < 6 {
+		tds := tr.ChildrenFiltered("td")
+		if tds.Length() < len(requiredQuakeColumns) {
 			return true
 		}
+		cell := func(name string) *goquery.Selection {
+			return tds.Eq(cols[name])
+		}
 
-		link, _ := tds.Eq(0).Find("a").Attr("href")
-		date := normalizeDateTime(strings.TrimSpace(tds.Eq(0).Text()))
-		lat := strings.TrimSpace(tds.Eq(1).Text())
-		lon := strings.TrimSpace(tds.Eq(2).Text())
-		depth := strings.TrimSpace(tds.Eq(3).Text())
-		mag := strings.TrimSpace(tds.Eq(4).Text())
-		loc := strings.TrimSpace(strings.Join(strings.Fields(tds.Eq(5).Text()), " "))
+		link, _ := cell(COL_DATE_TIME).Find("a").Attr("href")
+		date := normalizeDateTime(strings.TrimSpace(cell(COL_DATE_TIME).Text()))
+		lat := strings.TrimSpace(cell(COL_LATITUDE).Text())
+		lon := strings.TrimSpace(cell(COL_LONGITUDE).Text())
+		depth := strings.TrimSpace(cell(COL_DEPTH).Text())
+		mag := strings.TrimSpace(cell(COL_MAGNITUDE).Text())
+		// NFC so a decomposed "n" + combining tilde compares equal to "ñ"
+		loc := norm.NFC.String(strings.TrimSpace(strings.Join(strings.Fields(cell(COL_LOCATION).Text()), " ")))
 		origin := extractOrigin(loc)
 
 		bulletinURL := ""
 		if link != "" {
-			bulletinURL = fmt.Sprintf("%s/%s", PHIVOLCS_BASE_URL, strings.ReplaceAll(link, "\\", "/"))
+			bulletinURL = absoluteBulletinURL(doc.Url, link)
 		}
 
 		// Attempt to parse time from bulletin URL as it is more precise
@@ -341,22 +1158,36 @@ func parseFirstN(doc *goquery.Document, n int) ([]Quake, error) {
 		// This is important for distinguishing multiple quakes
 		// that occur within the same minute.
 		dateTime := date
+		occurredAt, _ := parseQuakeTime(date)
 		if bulletinURL != "" {
 			if parsed, err := extractDateTimeFromURL(bulletinURL); err == nil {
-				dateTime = parsed
+				dateTime = parsed.Format(DATE_TIME_LAYOUT)
+				occurredAt = parsed
 			}
 		}
 
-		results = append(results, Quake{
-			DateTime:  dateTime,
-			Latitude:  lat,
-			Longitude: lon,
-			Depth:     depth,
-			Magnitude: mag,
-			Location:  loc,
-			Origin:    origin,
-			Bulletin:  bulletinURL,
-		})
+		q := Quake{
+			DateTime:   dateTime,
+			OccurredAt: occurredAt,
+			Latitude:   lat,
+			Longitude:  lon,
+			Depth:      depth,
+			Magnitude:  mag,
+			Location:   loc,
+			Origin:     origin,
+			Province:   provinceOf(loc),
+			Bulletin:   bulletinURL,
+		}
+		sanitizeQuakeRow(&q)
+		q.Offshore = isOffshore(q)
+		metricRowsParsed.inc()
+		for _, w := range q.ParseWarnings {
+			slog.Warn(fmt.Sprintf("⚠️ Row %q: %s", dateTime+" | "+loc, w), "quake_key", quakeLocationKey(q))
+		}
+		slog.Debug("Parsed quake row", append(quakeLogAttrs(q),
+			"latitude", q.Latitude, "longitude", q.Longitude, "depth", q.Depth, "origin", q.Origin,
+			"bulletin", q.Bulletin, "ineligible", q.Ineligible)...)
+		results = append(results, q)
 		return true
 	})
 
@@ -366,50 +1197,63 @@ func parseFirstN(doc *goquery.Document, n int) ([]Quake, error) {
 // ---- Cache handling ----
 func saveAllQuakesToFile(quakes []Quake, fileName string) {
 	data, _ := json.MarshalIndent(quakes, "", "  ")
-	err := os.WriteFile(fileName, data, 0644)
+	err := writeStateFile(fileName, data)
 	if err != nil {
 		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
 	}
 }
 func readAllQuakesFromFile(fileName string, keyFunc func(Quake) string) map[string]Quake {
-	data, err := os.ReadFile(fileName)
-	if err != nil {
+	var quakes []Quake
+	if err := readStateList(fileName, &quakes); errors.Is(err, fs.ErrNotExist) {
 		log.Printf("⚠️ File not found, starting fresh: %s", fileName)
 		return map[string]Quake{}
-	}
-
-	var quakes []Quake
-	if err := json.Unmarshal(data, &quakes); err != nil {
+	} else if err != nil {
 		log.Printf("⚠️ Failed to parse cache file (%s), resetting: %v", fileName, err)
 		return map[string]Quake{}
 	}
 
+	for i := range quakes {
+		quakes[i] = withDerivedFields(quakes[i])
+	}
+	return quakesByKey(quakes, keyFunc)
+}
+
+// withDerivedFields re-derives the unserialized fields of a quake loaded from a file
+func withDerivedFields(q Quake) Quake {
+	q = withOccurredAt(q)
+	setMagnitudeValue(&q)
+	if q.Province == "" {
+		// cache files written before the province was parsed
+		q.Province = provinceOf(q.Location)
+	}
+	q.Offshore = isOffshore(q)
+	return q
+}
+
+// quakesByKey builds a map of quakes keyed by keyFunc
+func quakesByKey(quakes []Quake, keyFunc func(Quake) string) map[string]Quake {
 	m := make(map[string]Quake)
 	for _, q := range quakes {
-		key := keyFunc(q)
-		m[key] = q
+		m[keyFunc(q)] = q
 	}
 	return m
 }
 
 // Determine if two quakes have the same date and time up to minute precision
 // (ignoring seconds) as PHIVOLCS sometimes rounds seconds inconsistently.
-func sameDateAndTimeHM(t1, t2 string) bool {
+func sameDateAndTimeHM(t1, t2 time.Time) bool {
 	return sameDateAndTimeHMWithDelta(t1, t2, 0)
 }
 
 // sameDateAndTimeHM returns true if two datetimes are equal up to minute precision,
 // allowing a ±delta minute tolerance. Example: delta = 1 → within one minute difference.
-func sameDateAndTimeHMWithDelta(t1, t2 string, delta int) bool {
-	layout := DATE_TIME_LAYOUT
-
-	d1, err1 := time.Parse(layout, t1)
-	d2, err2 := time.Parse(layout, t2)
-	if err1 != nil || err2 != nil {
+// Unknown (zero) times never match.
+func sameDateAndTimeHMWithDelta(t1, t2 time.Time, delta int) bool {
+	if t1.IsZero() || t2.IsZero() {
 		return false
 	}
 
-	diff := d1.Sub(d2)
+	diff := t1.Sub(t2)
 	if diff < 0 {
 		diff = -diff
 	}
@@ -420,23 +1264,23 @@ func sameDateAndTimeHMWithDelta(t1, t2 string, delta int) bool {
 // Determine if currentQuake is a revised bulletin of pastQuake
 // (same date/time up to minute precision and same origin, but higher bulletin number)
 func isRevisedQuake(currentQuake, pastQ Quake) bool {
-	currNum, ok1 := getBulletinNumber(currentQuake.Bulletin)
-	pastNum, ok2 := getBulletinNumber(pastQ.Bulletin)
+	currNum, _, ok1 := getBulletinNumber(currentQuake.Bulletin)
+	pastNum, _, ok2 := getBulletinNumber(pastQ.Bulletin)
 
 	if !ok1 || !ok2 {
 		return false
 	}
 
-	return sameDateAndTimeHM(currentQuake.DateTime, pastQ.DateTime) &&
+	return sameDateAndTimeHM(currentQuake.OccurredAt, pastQ.OccurredAt) &&
 		pastQ.Origin == currentQuake.Origin &&
 		currNum > pastNum
 }
 
 // Create a slice of quakes filtered by date/time (up to minute precision)
-func filterQuakesByDateTime(quakes []Quake, target string) []Quake {
+func filterQuakesByDateTime(quakes []Quake, target time.Time) []Quake {
 	var result []Quake
 	for _, q := range quakes {
-		if sameDateAndTimeHMWithDelta(q.DateTime, target, SIMILAR_Q_MIN_DELTA_THRESH) {
+		if sameDateAndTimeHMWithDelta(q.OccurredAt, target, SIMILAR_Q_MIN_DELTA_THRESH) {
 			result = append(result, q)
 		}
 	}
@@ -446,7 +1290,7 @@ func filterQuakesByDateTime(quakes []Quake, target string) []Quake {
 // Determine if currentQuake bulletin has already been posted/known
 // (same date/time up to minute precision and same bulletin URL)
 func isKnownBulletin(currentQuake, pastQ Quake) bool {
-	return sameDateAndTimeHM(currentQuake.DateTime, pastQ.DateTime) &&
+	return sameDateAndTimeHM(currentQuake.OccurredAt, pastQ.OccurredAt) &&
 		currentQuake.Bulletin == pastQ.Bulletin
 }
 
@@ -460,96 +1304,45 @@ func buildCoordinates(lat, lon string) string {
 	return fmt.Sprintf("%s°N, %s°E", lat, lon)
 }
 
-// ---- Matrix posting ----
-func postToMatrix(updatedQuake Quake, updated bool, oldQuake Quake) error {
-	if matrixBaseURL == "" || matrixRoomID == "" || accessToken == "" {
-		return fmt.Errorf("missing Matrix environment variables")
-	}
-
-	txnId := fmt.Sprintf("%d", time.Now().UnixNano()/1e6) // unique transaction ID in ms
-
-	matrixURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
-		strings.TrimRight(matrixBaseURL, "/"),
-		matrixRoomID,
-		url.PathEscape(txnId),
-	)
-
-	msg, formatted := formatMatrixMsg(updated, oldQuake, updatedQuake)
-	payload := map[string]string{
-		"msgtype":        "m.text",
-		"body":           msg,
-		"format":         "org.matrix.custom.html",
-		"formatted_body": formatted,
-	}
-
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	var resp *http.Response
-	var body []byte
-	var lastErr error
-
-	for attempt := 1; attempt <= 5; attempt++ {
-		data, _ := json.Marshal(payload)
-		req, err := http.NewRequest("PUT", matrixURL, bytes.NewReader(data))
-		if err != nil {
-			return fmt.Errorf("failed to create request: %v", err)
-		}
-		req.Header.Set("Authorization", "Bearer "+accessToken)
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err = client.Do(req)
-		if err != nil {
-			log.Printf("Matrix send attempt %d failed (network error): %v", attempt, err)
-			lastErr = err
-		} else {
-			body, _ = io.ReadAll(resp.Body)
-			resp.Body.Close()
-
-			if resp.StatusCode < 300 {
-				return nil // success
-			}
-
-			log.Printf("Matrix send attempt %d failed (HTTP %d): %s",
-				attempt, resp.StatusCode, bytes.TrimSpace(body))
-		}
-
-		time.Sleep(time.Duration(attempt*attempt) * time.Second) // backoff
-	}
-
-	if lastErr != nil {
-		return fmt.Errorf("Matrix request failed after retries: %v", lastErr)
+// Format the Matrix message based on whether it's an update or a new quake, in each MESSAGE_LANG
+// language separated by a divider. A non-empty ref is shown as the alert reference.
+func formatMatrixMsg(updated bool, oldQuake Quake, updatedQuake Quake, ref string) (string, string) {
+	var msgs, formatteds []string
+	for _, lang := range messageLangs() {
+		msg, formatted := formatMatrixMsgIn(lang, updated, oldQuake, updatedQuake, ref)
+		msgs, formatteds = append(msgs, msg), append(formatteds, formatted)
 	}
-	return fmt.Errorf("Matrix API error: %s", string(body))
+	return strings.Join(msgs, LANG_DIVIDER_PLAIN), strings.Join(formatteds, LANG_DIVIDER_HTML)
 }
 
-// Format the Matrix message based on whether it's an update or a new quake
-func formatMatrixMsg(updated bool, oldQuake Quake, updatedQuake Quake) (string, string) {
+// formatMatrixMsgIn formats the Matrix message in one language of the message catalog
+func formatMatrixMsgIn(lang string, updated bool, oldQuake Quake, updatedQuake Quake, ref string) (string, string) {
 	var msg, formatted string
 	if updated {
-		locChangedPlain := fmt.Sprintf("Location: %s", oldQuake.Location)
-		locChangedHTML := fmt.Sprintf("📍 Location: %s", oldQuake.Location)
+		locChangedPlain := fmt.Sprintf("%s: %s", tr(lang, "location"), oldQuake.Location)
+		locChangedHTML := fmt.Sprintf("📍 %s: %s", tr(lang, "location"), oldQuake.Location)
 		if updatedQuake.Location != oldQuake.Location {
-			locChangedPlain = fmt.Sprintf("New Location: %s\nPrevious: %s", updatedQuake.Location, oldQuake.Location)
-			locChangedHTML = fmt.Sprintf("<b>📍 New Location: %s</b><br>Old: %s", updatedQuake.Location, oldQuake.Location)
+			locChangedPlain = fmt.Sprintf("%s: %s\n%s: %s", tr(lang, "location.new"), updatedQuake.Location, tr(lang, "location.prev"), oldQuake.Location)
+			locChangedHTML = fmt.Sprintf("<b>📍 %s: %s</b><br>%s: %s", tr(lang, "location.new"), updatedQuake.Location, tr(lang, "location.old"), oldQuake.Location)
 		}
 
-		magChangedPlain := oldQuake.Magnitude
-		magChangedHTML := oldQuake.Magnitude
-		if updatedQuake.Magnitude != oldQuake.Magnitude {
-			magChangedPlain = fmt.Sprintf("%.1f → %.1f", parseMag(oldQuake.Magnitude), parseMag(updatedQuake.Magnitude))
-			magChangedHTML = fmt.Sprintf("%.1f → <b>%.1f</b>", parseMag(oldQuake.Magnitude), parseMag(updatedQuake.Magnitude))
+		magChangedPlain := formatMagnitude(updatedQuake)
+		magChangedHTML := formatMagnitude(updatedQuake)
+		if updatedQuake.Magnitude != oldQuake.Magnitude || bulletinFieldChanged(oldQuake.MagType, updatedQuake.MagType) {
+			magChangedPlain = fmt.Sprintf("%s → %s", formatMagnitude(oldQuake), formatMagnitude(updatedQuake))
+			magChangedHTML = fmt.Sprintf("%s → <b>%s</b>", formatMagnitude(oldQuake), formatMagnitude(updatedQuake))
 		}
 
-		depthChangedPlain := oldQuake.Depth
-		depthChangedHTML := oldQuake.Depth
-		if updatedQuake.Depth != oldQuake.Depth {
-			depthChangedPlain = fmt.Sprintf("%s → %s", oldQuake.Depth, updatedQuake.Depth)
-			depthChangedHTML = fmt.Sprintf("%s → <b>%s</b>", oldQuake.Depth, updatedQuake.Depth)
+		depthChangedPlain := formatDepth(oldQuake.Depth)
+		depthChangedHTML := formatDepth(oldQuake.Depth)
+		if depthChanged(oldQuake, updatedQuake) {
+			depthChangedPlain = fmt.Sprintf("%s → %s", formatDepth(oldQuake.Depth), formatDepth(updatedQuake.Depth))
+			depthChangedHTML = fmt.Sprintf("%s → <b>%s</b>", formatDepth(oldQuake.Depth), formatDepth(updatedQuake.Depth))
 		}
 
 		coordChangedPlain := buildCoordinates(oldQuake.Latitude, oldQuake.Longitude)
 		coordChangedHTML := buildMapsHtmlLink(oldQuake.Latitude, oldQuake.Longitude)
-		if updatedQuake.Latitude != oldQuake.Latitude || updatedQuake.Longitude != oldQuake.Longitude {
+		if coordsChanged(oldQuake, updatedQuake) {
 			coordChangedPlain = fmt.Sprintf("%s → %s",
 				buildCoordinates(oldQuake.Latitude, oldQuake.Longitude),
 				buildCoordinates(updatedQuake.Latitude, updatedQuake.Longitude))
@@ -558,29 +1351,70 @@ func formatMatrixMsg(updated bool, oldQuake Quake, updatedQuake Quake) (string,
 				buildMapsHtmlLink(updatedQuake.Latitude, updatedQuake.Longitude))
 		}
 
+		// optional lines shown before the bulletin link
+		flagsPlain, flagsHTML := formatBulletinFlags(true, oldQuake, updatedQuake)
+		usgsPlain, usgsHTML := formatUSGSLine(updatedQuake)
+		feltPlain, feltHTML := formatFeltReports(oldQuake, updatedQuake)
+		offshorePlain, offshoreHTML := formatOffshoreLine(updatedQuake)
+		extraPlain, extraHTML := offshorePlain+flagsPlain+feltPlain+usgsPlain, offshoreHTML+flagsHTML+feltHTML+usgsHTML
+
+		// PHIVOLCS doesn't revise a final bulletin any further
+		finalPlain, finalHTML := "", ""
+		if isFinalBulletin(updatedQuake.Bulletin) {
+			finalPlain, finalHTML = " ("+tr(lang, "update.final")+")", " <b>("+tr(lang, "update.final")+")</b>"
+		}
+
 		msg = fmt.Sprintf(
-			"💡 Earthquake Bulletin Update!\nDate & Time: %s\n%s\nMagnitude: %s\nDepth: %skm\nCoordinates: %s\nBulletin: %s\nRevised by PHIVOLCS 🔄",
-			updatedQuake.DateTime, locChangedPlain, magChangedPlain, depthChangedPlain, coordChangedPlain, updatedQuake.Bulletin,
+			"💡 %s\n%s: %s\n%s\n%s: %s\n%s: %s\n%s: %s\n%s%s: %s\n%s%s 🔄",
+			tr(lang, "update.title"), tr(lang, "datetime"), updatedQuake.DateTime, locChangedPlain, tr(lang, "magnitude"), magChangedPlain,
+			tr(lang, "depth"), depthChangedPlain, tr(lang, "coordinates"), coordChangedPlain, extraPlain, tr(lang, "bulletin"), updatedQuake.Bulletin,
+			tr(lang, "update.revised"), finalPlain,
 		)
 		formatted = fmt.Sprintf(
-			"💡 <b>Earthquake Bulletin Update!</b><br><br>📅 <b>Date & Time:</b> %s<br>%s<br>📈 <b>Magnitude:</b> %s<br>📊 <b>Depth:</b> %skm<br>🧭 <b>Coordinates:</b> %s<br>📄 <b>Bulletin:</b> <a href=\"%s\">View PHIVOLCS report</a><br><br>Revised by PHIVOLCS 🔄",
-			updatedQuake.DateTime, locChangedHTML, magChangedHTML, depthChangedHTML, coordChangedHTML, updatedQuake.Bulletin,
+			"💡 <b>%s</b><br><br>📅 <b>%s:</b> %s<br>%s<br>📈 <b>%s:</b> %s<br>📊 <b>%s:</b> %s<br>🧭 <b>%s:</b> %s<br>%s📄 <b>%s:</b> <a href=\"%s\">%s</a><br><br>%s%s 🔄",
+			tr(lang, "update.title"), tr(lang, "datetime"), updatedQuake.DateTime, locChangedHTML, tr(lang, "magnitude"), magChangedHTML,
+			tr(lang, "depth"), depthChangedHTML, tr(lang, "coordinates"), coordChangedHTML, extraHTML, tr(lang, "bulletin"), updatedQuake.Bulletin,
+			tr(lang, "bulletin.link"), tr(lang, "update.revised"), finalHTML,
 		)
 	} else {
+		// optional lines shown before the bulletin link
+		flagsPlain, flagsHTML := formatBulletinFlags(false, oldQuake, updatedQuake)
+		usgsPlain, usgsHTML := formatUSGSLine(updatedQuake)
+		distPlain, distHTML := formatDistanceLine(updatedQuake)
+		offshorePlain, offshoreHTML := formatOffshoreLine(updatedQuake)
+		feltPlain, feltHTML := formatFeltLine(updatedQuake)
+		extraPlain, extraHTML := offshorePlain+flagsPlain+feltPlain+distPlain+usgsPlain, offshoreHTML+flagsHTML+feltHTML+distHTML+usgsHTML
+
+		headlinePlain, headlineHTML := severityFor(updatedQuake).headlines(lang)
 		msg = fmt.Sprintf(
-			"🚨 New Earthquake Alert!\nDate & Time: %s\nLocation: %s\nMagnitude: %.1f\nDepth: %skm\nCoordinates: %s\nBulletin: %s\nStay safe! ⚠️",
-			updatedQuake.DateTime, updatedQuake.Location, parseMag(updatedQuake.Magnitude),
-			updatedQuake.Depth, buildCoordinates(updatedQuake.Latitude, updatedQuake.Longitude), updatedQuake.Bulletin,
+			"%s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s%s: %s\n%s ⚠️",
+			headlinePlain, tr(lang, "datetime"), updatedQuake.DateTime, tr(lang, "location"), updatedQuake.Location,
+			tr(lang, "magnitude"), formatMagnitude(updatedQuake), tr(lang, "depth"), formatDepth(updatedQuake.Depth),
+			tr(lang, "coordinates"), buildCoordinates(updatedQuake.Latitude, updatedQuake.Longitude), extraPlain,
+			tr(lang, "bulletin"), updatedQuake.Bulletin, tr(lang, "alert.stay_safe"),
 		)
 		formatted = fmt.Sprintf(
-			"🚨 <b>New Earthquake Alert!</b><br><br>📅 <b>Date & Time:</b> %s<br>📍 <b>Location:</b> %s<br>📈 <b>Magnitude:</b> %.1f<br>📊 <b>Depth:</b> %skm<br>🧭 <b>Coordinates:</b> %s<br>📄 <b>Bulletin:</b> <a href=\"%s\">View PHIVOLCS report</a><br><br>Stay safe! ⚠️",
-			updatedQuake.DateTime, updatedQuake.Location, parseMag(updatedQuake.Magnitude),
-			updatedQuake.Depth, buildMapsHtmlLink(updatedQuake.Latitude, updatedQuake.Longitude), updatedQuake.Bulletin,
+			"%s📅 <b>%s:</b> %s<br>📍 <b>%s:</b> %s<br>📈 <b>%s:</b> %s<br>📊 <b>%s:</b> %s<br>🧭 <b>%s:</b> %s<br>%s📄 <b>%s:</b> <a href=\"%s\">%s</a><br><br>%s ⚠️",
+			headlineHTML, tr(lang, "datetime"), updatedQuake.DateTime, tr(lang, "location"), updatedQuake.Location,
+			tr(lang, "magnitude"), formatMagnitude(updatedQuake), tr(lang, "depth"), formatDepth(updatedQuake.Depth),
+			tr(lang, "coordinates"), buildMapsHtmlLink(updatedQuake.Latitude, updatedQuake.Longitude), extraHTML,
+			tr(lang, "bulletin"), updatedQuake.Bulletin, tr(lang, "bulletin.link"), tr(lang, "alert.stay_safe"),
 		)
 	}
+	if ref != "" {
+		msg += fmt.Sprintf("\n%s: %s", tr(lang, "ref"), ref)
+		formatted += fmt.Sprintf("<br>🔖 %s: <code>%s</code>", tr(lang, "ref"), ref)
+	}
 	return msg, formatted
 }
 
+// Strip the leading emoji (including variation selectors and joiners) from a message
+func stripLeadingEmoji(s string) string {
+	return strings.TrimLeftFunc(s, func(r rune) bool {
+		return unicode.Is(unicode.So, r) || unicode.IsMark(r) || unicode.Is(unicode.Cf, r) || unicode.IsSpace(r)
+	})
+}
+
 func parseMag(m string) float64 {
 	v, _ := strconv.ParseFloat(m, 64)
 	return v
@@ -598,11 +1432,13 @@ func extractOrigin(fullLoc string) string {
 
 func quakeChanged(a, b Quake) bool {
 	return a.Magnitude != b.Magnitude ||
-		a.Depth != b.Depth ||
+		depthChanged(a, b) ||
 		a.Location != b.Location ||
-		a.Latitude != b.Latitude ||
-		a.Longitude != b.Longitude ||
-		a.Bulletin != b.Bulletin
+		coordsChanged(a, b) ||
+		a.Bulletin != b.Bulletin ||
+		bulletinFieldChanged(a.MagType, b.MagType) ||
+		bulletinFieldChanged(a.ExpectingDamage, b.ExpectingDamage) ||
+		bulletinFieldChanged(a.ExpectingAftershocks, b.ExpectingAftershocks)
 }
 
 func quakeLocationKey(q Quake) string {
@@ -613,43 +1449,61 @@ func quakeOriginKey(q Quake) string {
 	return q.DateTime + "|" + q.Origin
 }
 
-func getBulletinNumber(url string) (int, bool) {
-	// Regex to capture the digit after B (ignore optional F)
-	re := regexp.MustCompile(`_B(\d)F?\.html$`)
-	match := re.FindStringSubmatch(url)
-	if len(match) > 1 {
+// quakeTimeCoordKey identifies a quake by its time to the minute and its coordinates rounded
+// to 0.1° (about 11 km), so it survives PHIVOLCS rewording the location text between the
+// listing and the bulletin. Empty when the time or coordinates are unknown.
+func quakeTimeCoordKey(q Quake) string {
+	lat, lon, ok := quakeCoords(q)
+	if !ok || q.OccurredAt.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%s|%.1f|%.1f", q.OccurredAt.In(manilaLoc).Format("2006-01-02 15:04"), lat, lon)
+}
+
+// timeCoordKeys indexes the posted quakes by quakeTimeCoordKey
+func timeCoordKeys(postedQuakes map[string]PostedQuake) map[string]bool {
+	keys := make(map[string]bool, len(postedQuakes))
+	for _, p := range postedQuakes {
+		if k := quakeTimeCoordKey(p.Quake); k != "" {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+// Regex to capture the bulletin number after B and the optional F (final) suffix,
+// tolerating any casing and a trailing query string or fragment
+var bulletinNumberRe = regexp.MustCompile(`(?i)_B(\d+)(F?)\.html?(?:[?#].*)?$`)
+
+// getBulletinNumber returns the bulletin number of a bulletin URL (e.g. 12 for "..._B12F.html"),
+// whether it is the final bulletin, and whether the URL could be parsed at all
+func getBulletinNumber(url string) (int, bool, bool) {
+	match := bulletinNumberRe.FindStringSubmatch(url)
+	if len(match) > 2 {
 		num, err := strconv.Atoi(match[1])
 		if err == nil {
-			return num, true
+			return num, match[2] != "", true
 		}
 	}
-	return 0, false
+	return 0, false, false
 }
 
-// Remove entries older than 2 months and convert map to slice
-func mapEqToSlice(m map[string]Quake) []Quake {
-	var s []Quake
-	now := time.Now()
+// isFinalBulletin reports whether a bulletin URL is marked final with the F suffix (e.g. "..._B3F.html")
+func isFinalBulletin(url string) bool {
+	_, final, ok := getBulletinNumber(url)
+	return ok && final
+}
 
-	for k, v := range m {
-		t, err := time.Parse(DATE_TIME_LAYOUT, v.DateTime)
-		if err != nil {
-			log.Printf("⚠️ Failed to parse datetime %q: %v", v.DateTime, err)
-			continue
-		}
-		// skip entries older than 2 months
-		if t.Before(now.AddDate(0, -2, 0)) {
-			delete(m, k)
-			continue
-		}
+// mapEqToSlice returns the quakes of m sorted by datetime (newest first), quakes with an
+// unparseable datetime last
+func mapEqToSlice(m map[string]Quake) []Quake {
+	s := make([]Quake, 0, len(m))
+	for _, v := range m {
 		s = append(s, v)
 	}
 
-	// Sort by datetime (newest first)
 	sort.Slice(s, func(i, j int) bool {
-		ti, _ := time.Parse(DATE_TIME_LAYOUT, s[i].DateTime)
-		tj, _ := time.Parse(DATE_TIME_LAYOUT, s[j].DateTime)
-		return ti.After(tj)
+		return s[i].OccurredAt.After(s[j].OccurredAt)
 	})
 
 	return s
@@ -659,10 +1513,10 @@ func mapEqToSlice(m map[string]Quake) []Quake {
 // comparing it against the postedQuakes map. It returns true if a known bulletin
 // matching currentQuake is found in postedQuakes, indicating that the quake has
 // already been posted.
-func updatedQuakeHasBeenPosted(postedQuakes map[string]Quake, currentQuake Quake) bool {
+func updatedQuakeHasBeenPosted(postedQuakes map[string]PostedQuake, currentQuake Quake) bool {
 	skipPostingUpdate := false
 	for _, postQ := range postedQuakes {
-		if isKnownBulletin(currentQuake, postQ) {
+		if isKnownBulletin(currentQuake, postQ.Quake) {
 			skipPostingUpdate = true
 			break
 		}
@@ -673,13 +1527,14 @@ func updatedQuakeHasBeenPosted(postedQuakes map[string]Quake, currentQuake Quake
 // isCurrentAndPastQSignificant determines whether either the current or previous earthquake is considered significant
 // based on their respective magnitudes and location-specific thresholds. It returns true if the magnitude
 // of the current earthquake meets or exceeds the threshold for its location, or if the magnitude of the
-// previous earthquake meets or exceeds the threshold for its location.
+// previous earthquake meets or exceeds the threshold for its location, or either was felt at MIN_REPORTED_INTENSITY.
 func isCurrentAndPastQSignificant(currentQuake Quake, previousQuake Quake) bool {
-	thresholdForUpdatedQ := magnitudeThresholdFor(currentQuake.Latitude, currentQuake.Longitude)
-	thresholdForOldQ := magnitudeThresholdFor(previousQuake.Latitude, previousQuake.Longitude)
+	thresholdForUpdatedQ := detectionThresholdFor(currentQuake)
+	thresholdForOldQ := detectionThresholdFor(previousQuake)
 
-	isSignificant := parseMag(currentQuake.Magnitude) >= thresholdForUpdatedQ ||
-		parseMag(previousQuake.Magnitude) >= thresholdForOldQ
+	isSignificant := currentQuake.MagnitudeValue >= thresholdForUpdatedQ ||
+		previousQuake.MagnitudeValue >= thresholdForOldQ ||
+		feltQualifies(currentQuake) || feltQualifies(previousQuake)
 	return isSignificant
 }
 
@@ -697,11 +1552,11 @@ func determinePastQuakeThroughHeuristics(lastFetchQuakes map[string]Quake, curre
 		}
 	}
 
-	similarlyTimedQuakes := filterQuakesByDateTime(mapEqToSlice(lastFetchQuakes), currentQuake.DateTime)
+	similarlyTimedQuakes := filterQuakesByDateTime(mapEqToSlice(lastFetchQuakes), currentQuake.OccurredAt)
 	for _, pastQ := range similarlyTimedQuakes {
 		if AddressSimilarity(currentQuake.Origin, pastQ.Origin) >= SIMILAR_Q_ORIGIN_THRESH {
-			curQuakeBltnNo, _ := getBulletinNumber(currentQuake.Bulletin)
-			pastQuakeBltnNo, _ := getBulletinNumber(pastQ.Bulletin)
+			curQuakeBltnNo, _, _ := getBulletinNumber(currentQuake.Bulletin)
+			pastQuakeBltnNo, _, _ := getBulletinNumber(pastQ.Bulletin)
 			if curQuakeBltnNo > pastQuakeBltnNo {
 				previousQuake = pastQ
 				updateExists = true
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const testBulletinBase = "https://earthquake.phivolcs.dost.gov.ph/2024_Earthquake_Information/March/2024_0302_0105_"
+
+// bulletinQuake is a quake of the front page, with bulletin revision b
+func bulletinQuake(b string) Quake {
+	return withDerivedFields(Quake{
+		DateTime:  "02 March 2024 - 01:05:00 AM",
+		Latitude:  "09.86",
+		Longitude: "124.07",
+		Depth:     "010",
+		Magnitude: "4.0",
+		Location:  "006 km S 24° W of Sagbayan (Bohol)",
+		Origin:    "006 km S 24° W of Sagbayan (Bohol)",
+		Bulletin:  testBulletinBase + b + ".html",
+	})
+}
+
+func TestQuakeChanged(t *testing.T) {
+	base := bulletinQuake("B1")
+	tests := []struct {
+		name    string
+		edit    func(q *Quake)
+		changed bool
+	}{
+		{"identical", func(q *Quake) {}, false},
+		{"magnitude", func(q *Quake) { q.Magnitude = "4.3" }, true},
+		{"latitude", func(q *Quake) { q.Latitude = "09.90" }, true},
+		{"longitude", func(q *Quake) { q.Longitude = "124.10" }, true},
+		{"coordinate formatting", func(q *Quake) { q.Latitude = "9.86" }, false},
+		{"depth", func(q *Quake) { q.Depth = "025" }, true},
+		{"depth formatting", func(q *Quake) { q.Depth = "10" }, false},
+		{"revised bulletin", func(q *Quake) { q.Bulletin = testBulletinBase + "B2.html" }, true},
+		{"magnitude type learnt", func(q *Quake) { q.MagType = "Mw" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := base
+			tt.edit(&q)
+			if got := quakeChanged(base, q); got != tt.changed {
+				t.Errorf("quakeChanged = %v, want %v", got, tt.changed)
+			}
+		})
+	}
+}
+
+func TestIsRevisedQuake(t *testing.T) {
+	b1, b2 := bulletinQuake("B1"), bulletinQuake("B2")
+	otherOrigin := b2
+	otherOrigin.Origin = "017 km S 71° E of Tulunan (Cotabato)"
+	later := withDerivedFields(Quake{DateTime: "02 March 2024 - 01:07:00 AM", Origin: b1.Origin, Bulletin: b2.Bulletin})
+	noBulletin := b2
+	noBulletin.Bulletin = ""
+	tests := []struct {
+		name          string
+		current, past Quake
+		revised       bool
+	}{
+		{"higher bulletin", b2, b1, true},
+		{"same bulletin", b1, b1, false},
+		{"lower bulletin", b1, b2, false},
+		{"other origin", otherOrigin, b1, false},
+		{"other minute", later, b1, false},
+		{"no bulletin", noBulletin, b1, false},
+	}
+	for _, tt := range tests {
+		if got := isRevisedQuake(tt.current, tt.past); got != tt.revised {
+			t.Errorf("%s: isRevisedQuake = %v, want %v", tt.name, got, tt.revised)
+		}
+	}
+}
+
+func TestIsKnownBulletin(t *testing.T) {
+	b1, b2 := bulletinQuake("B1"), bulletinQuake("B2")
+	// PHIVOLCS reposting the same bulletin with a reworded location is still the known bulletin
+	repost := b1
+	repost.Location = "006 km S 23° W of Sagbayan (Bohol)"
+	if !isKnownBulletin(repost, b1) {
+		t.Error("same bulletin URL at the same minute not known")
+	}
+	if isKnownBulletin(b2, b1) {
+		t.Error("revised bulletin reported as known")
+	}
+	later := withDerivedFields(Quake{DateTime: "02 March 2024 - 01:06:00 AM", Bulletin: b1.Bulletin})
+	if isKnownBulletin(later, b1) {
+		t.Error("same bulletin URL a minute later reported as known")
+	}
+}
+
+func TestIsCurrentAndPastQSignificant(t *testing.T) {
+	savedLocal, savedGlobal, savedIntensity := localMagThresh, globalMagThresh, minReportedIntensity
+	t.Cleanup(func() {
+		localMagThresh, globalMagThresh, minReportedIntensity = savedLocal, savedGlobal, savedIntensity
+	})
+	localMagThresh, globalMagThresh, minReportedIntensity = 4, 4, ""
+
+	withMag := func(mag string) Quake {
+		q := bulletinQuake("B1")
+		q.Magnitude = mag
+		return withDerivedFields(q)
+	}
+	tests := []struct {
+		name            string
+		current, before string
+		significant     bool
+	}{
+		{"both below", "3.9", "3.8", false},
+		{"current at the threshold", "4.0", "3.8", true},
+		{"previous at the threshold", "3.9", "4.0", true},
+		{"downgraded below", "3.9", "4.1", true},
+	}
+	for _, tt := range tests {
+		if got := isCurrentAndPastQSignificant(withMag(tt.current), withMag(tt.before)); got != tt.significant {
+			t.Errorf("%s: isCurrentAndPastQSignificant(M%s, M%s) = %v, want %v", tt.name, tt.current, tt.before, got, tt.significant)
+		}
+	}
+
+	minReportedIntensity = "V"
+	felt := withMag("3.0")
+	felt.MaxIntensity = "V"
+	if !isCurrentAndPastQSignificant(felt, withMag("3.0")) {
+		t.Error("quake felt at MIN_REPORTED_INTENSITY not significant")
+	}
+}
+
+func TestGetBulletinNumber(t *testing.T) {
+	tests := []struct {
+		url   string
+		num   int
+		final bool
+		ok    bool
+	}{
+		{testBulletinBase + "B1.html", 1, false, true},
+		{testBulletinBase + "B10.html", 10, false, true},
+		{testBulletinBase + "B2F.html", 2, true, true},
+		{testBulletinBase + "B12F.html", 12, true, true},
+		{testBulletinBase + "b3f.HTML?ref=feed", 3, true, true},
+		{"https://earthquake.phivolcs.dost.gov.ph/2024_Earthquake_Information/March/2024_0302_0105.html", 0, false, false},
+		{"", 0, false, false},
+	}
+	for _, tt := range tests {
+		num, final, ok := getBulletinNumber(tt.url)
+		if num != tt.num || final != tt.final || ok != tt.ok {
+			t.Errorf("getBulletinNumber(%q) = %d, %v, %v, want %d, %v, %v", tt.url, num, final, ok, tt.num, tt.final, tt.ok)
+		}
+	}
+	// bulletin 10 revises bulletin 9, not bulletin 1
+	if !isRevisedQuake(bulletinQuake("B10"), bulletinQuake("B9")) {
+		t.Error("bulletin 10 not a revision of bulletin 9")
+	}
+}
+
+// loadTestPage parses an HTML fixture of testdata like the fetched front page
+func loadTestPage(t *testing.T, fileName string) *goquery.Document {
+	t.Helper()
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatalf("NewDocumentFromReader: %v", err)
+	}
+	return doc
+}
+
+func TestParseFirstNFrontPage(t *testing.T) {
+	doc := loadTestPage(t, "testdata/phivolcs-front-page.html")
+	quakes, err := parseFirstN(doc, 10)
+	if err != nil {
+		t.Fatalf("parseFirstN: %v", err)
+	}
+	if len(quakes) != 4 {
+		t.Fatalf("parsed %d quakes, want 4", len(quakes))
+	}
+
+	first := quakes[0]
+	want := Quake{
+		DateTime:  "01 October 2025 - 12:48:54 AM",
+		Latitude:  "11.12",
+		Longitude: "123.95",
+		Depth:     "5",
+		Magnitude: "4.3",
+		Location:  "019 km N 55° E of Medellin (Cebu)",
+		Origin:    "Medellin (Cebu)",
+		Province:  "Cebu",
+		Bulletin:  PHIVOLCS_BASE_URL + "/2025_Earthquake_Information/September/2025_0930_164854_B2F.html",
+	}
+	if first.DateTime != want.DateTime || first.Latitude != want.Latitude || first.Longitude != want.Longitude ||
+		first.Depth != want.Depth || first.Magnitude != want.Magnitude || first.Location != want.Location ||
+		first.Origin != want.Origin || first.Province != want.Province || first.Bulletin != want.Bulletin {
+		t.Errorf("first row = %+v\nwant %+v", first, want)
+	}
+	if first.MagnitudeValue != 4.3 || first.OccurredAt.IsZero() {
+		t.Errorf("first row magnitude %v, occurred at %v", first.MagnitudeValue, first.OccurredAt)
+	}
+
+	last := quakes[len(quakes)-1]
+	if last.DateTime != "30 September 2025 - 11:10:05 PM" || last.Location != "003 km N 63° W of Tayum (Abra)" ||
+		last.Magnitude != "3.0" || last.Province != "Abra" ||
+		!strings.HasSuffix(last.Bulletin, "/2025_Earthquake_Information/September/2025_0930_151005_B1.html") {
+		t.Errorf("last row = %+v", last)
+	}
+
+	// a row without a bulletin link keeps the minute precision time of the table
+	if q := quakes[2]; q.Bulletin != "" || q.DateTime != "30 September 2025 - 11:58:00 PM" {
+		t.Errorf("row without a bulletin = %+v", q)
+	}
+
+	if limited, _ := parseFirstN(doc, 2); len(limited) != 2 || limited[1].Magnitude != "2.5" {
+		t.Errorf("parseFirstN(doc, 2) = %+v", limited)
+	}
+}
+
+func TestParseFirstNWithoutQuakeTable(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body><table><tr><td>Maintenance</td></tr></table></body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseFirstN(doc, 10); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("parseFirstN = %v, want ErrTableNotFound", err)
+	}
+}
+
+func TestMapEqToSliceOrder(t *testing.T) {
+	m := map[string]Quake{}
+	for _, dt := range []string{
+		"01 March 2024 - 11:10:00 PM",
+		"02 March 2024 - 01:05:00 AM",
+		"not a datetime",
+		"02 March 2024 - 01:05:30 AM",
+		"28 February 2024 - 06:00:00 AM",
+	} {
+		q := withDerivedFields(Quake{DateTime: dt, Location: "006 km S 24° W of Sagbayan (Bohol)"})
+		m[quakeLocationKey(q)] = q
+	}
+	quakes := mapEqToSlice(m)
+	if len(quakes) != len(m) {
+		t.Fatalf("%d quakes, want %d", len(quakes), len(m))
+	}
+	for i := 1; i < len(quakes)-1; i++ {
+		if !quakes[i-1].OccurredAt.After(quakes[i].OccurredAt) {
+			t.Errorf("%s listed before %s", quakes[i-1].DateTime, quakes[i].DateTime)
+		}
+	}
+	if last := quakes[len(quakes)-1]; last.DateTime != "not a datetime" {
+		t.Errorf("last quake %s, want the unparseable datetime", last.DateTime)
+	}
+}
+
+func TestMapEqToSliceLeavesInputUntouched(t *testing.T) {
+	old := withDerivedFields(Quake{DateTime: "02 January 2020 - 01:05:00 AM", Location: "017 km S 71° E of Tulunan (Cotabato)"})
+	recent := bulletinQuake("B1")
+	m := map[string]Quake{quakeLocationKey(old): old, quakeLocationKey(recent): recent}
+	mapEqToSlice(m)
+	if len(m) != 2 {
+		t.Errorf("mapEqToSlice left %d of the 2 quakes in its input", len(m))
+	}
+	for _, q := range []Quake{old, recent} {
+		if got, ok := m[quakeLocationKey(q)]; !ok || got.Bulletin != q.Bulletin || !got.OccurredAt.Equal(q.OccurredAt) {
+			t.Errorf("quake %s changed in the input: %+v", q.DateTime, got)
+		}
+	}
+}
+
+func TestFetchDocumentWindows1252(t *testing.T) {
+	page, err := os.ReadFile("testdata/phivolcs-windows-1252.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// served like PHIVOLCS does, without a charset in the Content-Type header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write(page)
+	}))
+	t.Cleanup(srv.Close)
+	useScrapeTLS(t, "", false)
+
+	doc, err := fetchDocument(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("fetchDocument: %v", err)
+	}
+	quakes, err := parseFirstN(doc, 10)
+	if err != nil || len(quakes) != 2 {
+		t.Fatalf("parseFirstN = %d quakes, %v", len(quakes), err)
+	}
+	q := quakes[0]
+	if q.Location != "004 km N 12° W of Dueñas (Iloilo)" || q.Origin != "Dueñas (Iloilo)" {
+		t.Errorf("location %q, origin %q", q.Location, q.Origin)
+	}
+	if got := quakes[1].Origin; got != "Peñablanca (Cagayan)" {
+		t.Errorf("origin %q, want Peñablanca (Cagayan)", got)
+	}
+	if got := normalizeAddr(q.Origin); got != "dueñasiloilo" {
+		t.Errorf("normalizeAddr(%q) = %q", q.Origin, got)
+	}
+
+	// the cache keeps the UTF-8 text
+	data, err := json.Marshal(quakes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached []Quake
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatal(err)
+	}
+	if cached[0].Location != q.Location || quakeLocationKey(cached[0]) != quakeLocationKey(q) {
+		t.Errorf("location after the JSON round-trip = %q", cached[0].Location)
+	}
+}
+
+func TestNormalizeAddrComposesTilde(t *testing.T) {
+	// "n" followed by a combining tilde, as some pages encode "ñ"
+	if a, b := normalizeAddr("Due\u006e\u0303as (Iloilo)"), normalizeAddr("Dueñas (Iloilo)"); a != b {
+		t.Errorf("decomposed %q and composed %q differ", a, b)
+	}
+}
+
+func TestEquivalentCoordinatesUnchanged(t *testing.T) {
+	base := Quake{Latitude: "10.30", Longitude: "123.90", Magnitude: "4.0", Depth: "10"}
+	for _, form := range [][2]string{
+		{"10.3", "123.9"},
+		{"10.300", "123.900"},
+		{" 10.30 ", "123.90 "},
+		{"10.30°", "123.90°"},
+	} {
+		q := base
+		q.Latitude, q.Longitude = form[0], form[1]
+		if quakeChanged(base, q) {
+			t.Errorf("%q, %q counted as a change from %q, %q", form[0], form[1], base.Latitude, base.Longitude)
+		}
+	}
+	moved := base
+	moved.Longitude = "123.91"
+	if !quakeChanged(base, moved) {
+		t.Error("a 0.01° move not counted as a change")
+	}
+	if got := normalizeCoord(" 123.9 "); got != "123.90" {
+		t.Errorf("normalizeCoord = %q, want 123.90", got)
+	}
+}
+
+func TestBearingCompassPoints(t *testing.T) {
+	const cebuLat, cebuLon = 10.3157, 123.8854
+	points := []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+	for i, want := range points {
+		// a point 1° away in the middle of each sector
+		azimuth := float64(i) * 22.5
+		rad := azimuth * math.Pi / 180
+		lat, lon := cebuLat+math.Cos(rad), cebuLon+math.Sin(rad)/math.Cos(cebuLat*math.Pi/180)
+		bearing := bearingDeg(cebuLat, cebuLon, lat, lon)
+		if math.Abs(math.Remainder(bearing-azimuth, 360)) > 1 {
+			t.Errorf("bearing towards %s = %.2f, want about %.1f", want, bearing, azimuth)
+		}
+		if got := compassPoint(bearing); got != want {
+			t.Errorf("compassPoint(%.2f) = %s, want %s", bearing, got, want)
+		}
+	}
+
+	// towns in every quadrant around Cebu City
+	for _, tt := range []struct {
+		town     string
+		lat, lon float64
+		want     string
+	}{
+		{"Tacloban", 11.24, 125.00, "NE"},
+		{"Davao", 7.07, 125.61, "SSE"},
+		{"Dumaguete", 9.31, 123.31, "SSW"},
+		{"Iloilo", 10.72, 122.56, "WNW"},
+	} {
+		if got := compassPoint(bearingDeg(cebuLat, cebuLon, tt.lat, tt.lon)); got != tt.want {
+			t.Errorf("%s lies %s of Cebu City, want %s", tt.town, got, tt.want)
+		}
+	}
+
+	// sector boundaries go to the next point clockwise
+	for azimuth, want := range map[float64]string{0: "N", 11.24: "N", 11.25: "NNE", 112.5: "ESE", 348.74: "NNW", 348.75: "N", 359.9: "N", 360: "N"} {
+		if got := compassPoint(azimuth); got != want {
+			t.Errorf("compassPoint(%v) = %s, want %s", azimuth, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// upper bound of the retry delay after consecutive fetch/parse errors
+const MAX_ERROR_BACKOFF = 15 * time.Minute
+
+// end of the aftershock mode, polling faster until then; zero when it was never entered
+var aftershockModeUntil time.Time
+
+// noteQuakeForAftershockMode enters (or extends) the aftershock mode after a recent quake
+// of at least AFTERSHOCK_TRIGGER_MAG within REF_RADIUS_KM of the reference point
+func noteQuakeForAftershockMode(q Quake) {
+	if q.MagnitudeValue < aftershockTriggerMag || time.Since(q.OccurredAt) > aftershockWindow {
+		return
+	}
+	lat, lon, ok := quakeCoords(q)
+	if !ok || distanceKm(lat, lon, refPointLat, refPointLon) > refRadiusKm {
+		return
+	}
+
+	until := time.Now().Add(aftershockWindow)
+	if inAftershockMode() {
+		log.Printf("📡 Aftershock mode extended until %s after M%s %s", until.Format(time.RFC3339), q.Magnitude, q.Location)
+	} else {
+		log.Printf("📡 Entering aftershock mode after M%s %s, polling every %s until %s",
+			q.Magnitude, q.Location, aftershockPollInterval, until.Format(time.RFC3339))
+	}
+	aftershockModeUntil = until
+}
+
+// inAftershockMode reports whether the faster aftershock polling is active
+func inAftershockMode() bool {
+	return time.Now().Before(aftershockModeUntil)
+}
+
+// currentPollInterval returns AFTERSHOCK_POLL_INTERVAL during the aftershock mode and POLL_INTERVAL otherwise
+func currentPollInterval() time.Duration {
+	if inAftershockMode() {
+		return aftershockPollInterval
+	}
+	if !aftershockModeUntil.IsZero() {
+		log.Printf("📡 Aftershock mode ended, back to polling every %s", pollInterval)
+		aftershockModeUntil = time.Time{}
+	}
+	return pollInterval
+}
+
+// withJitter spreads d by ±10% so instances behind the same NAT don't poll PHIVOLCS in sync
+func withJitter(d time.Duration) time.Duration {
+	spread := int64(d) / 10
+	if spread <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(2*spread+1)-spread)
+}
+
+// errorBackoff doubles ERROR_RETRY_INTERVAL for each consecutive error (30s, 1m, 2m, ...) up to MAX_ERROR_BACKOFF
+func errorBackoff(consecutiveErrors int) time.Duration {
+	d := errorRetryInterval
+	for i := 1; i < consecutiveErrors && d < MAX_ERROR_BACKOFF; i++ {
+		d *= 2
+	}
+	if d > MAX_ERROR_BACKOFF {
+		d = MAX_ERROR_BACKOFF
+	}
+	return d
+}
+
+// sleepBeforeNextPoll sleeps for d with jitter applied, logging the chosen duration.
+// Returns early when ctx is cancelled.
+func sleepBeforeNextPoll(ctx context.Context, d time.Duration) {
+	d = withJitter(d).Round(time.Millisecond)
+	log.Printf("Sleeping for %s before next poll...", d)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		case <-reloadRequests:
+			// between cycles, so a reload never changes the configuration mid-cycle
+			reloadConfig()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"time"
+)
+
+// hashes of the alerts already sent with the time they were sent, a last line of defense
+// against re-posting when the posted quakes file is lost or its keys change
+var postedHashes = map[string]time.Time{}
+
+// alertHash identifies the content of an alert by the fields that make it up
+func alertHash(q Quake, updated bool) string {
+	kind := "new"
+	if updated {
+		kind = "update"
+	}
+	sum := sha1.Sum([]byte(kind + "|" + q.DateTime + "|" + q.Location + "|" + q.Magnitude + "|" + q.Bulletin))
+	return hex.EncodeToString(sum[:])
+}
+
+// alreadySent reports whether an identical alert was posted before
+func alreadySent(q Quake, updated bool) bool {
+	_, ok := postedHashes[alertHash(q, updated)]
+	return ok
+}
+
+// markSent records a posted alert and saves the hashes, dropping those older than POSTED_RETENTION
+func markSent(q Quake, updated bool) {
+	postedHashes[alertHash(q, updated)] = time.Now()
+	cutoff := time.Now().Add(-postedRetention)
+	for h, t := range postedHashes {
+		if t.Before(cutoff) {
+			delete(postedHashes, h)
+		}
+	}
+	savePostedHashes(postedHashes, statePath(POSTED_HASHES_FILE))
+}
+
+func readPostedHashes(fileName string) map[string]time.Time {
+	hashes := map[string]time.Time{}
+	if err := readStateFile(fileName, &hashes); errors.Is(err, fs.ErrNotExist) {
+		return hashes
+	} else if err != nil {
+		log.Printf("⚠️ Failed to parse posted hashes %s: %v", fileName, err)
+		return map[string]time.Time{}
+	}
+	return hashes
+}
+
+func savePostedHashes(hashes map[string]time.Time, fileName string) {
+	data, _ := json.MarshalIndent(hashes, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+	}
+}
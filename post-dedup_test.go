@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPostAlertSkipsAlreadySentAfterStateLoss(t *testing.T) {
+	useTempState(t)
+	var sent []string
+	useNotifiers(t, fakeNotifier{sent: &sent})
+	q := testQuake()
+	if _, err := postAlert(context.Background(), q, false, q, PostedQuake{}); err != nil {
+		t.Fatalf("postAlert: %v", err)
+	}
+
+	// the posted quakes are lost, the hashes survive the restart
+	postedHashes = readPostedHashes(statePath(POSTED_HASHES_FILE))
+	if _, err := postAlert(context.Background(), q, false, q, PostedQuake{}); err != nil {
+		t.Fatalf("postAlert: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Errorf("identical alert posted %d times, want 1", len(sent))
+	}
+
+	// a revision of the bulletin is a different alert
+	revised := q
+	revised.Magnitude = "7.1"
+	if _, err := postAlert(context.Background(), withDerivedFields(revised), true, q, PostedQuake{}); err != nil {
+		t.Fatalf("postAlert: %v", err)
+	}
+	if len(sent) != 2 {
+		t.Errorf("revision posted %d times, want 1", len(sent)-1)
+	}
+}
+
+func TestMarkSentPrunesOldHashes(t *testing.T) {
+	useTempState(t)
+	postedHashes["stale"] = time.Now().Add(-postedRetention - time.Hour)
+	markSent(testQuake(), false)
+	hashes := readPostedHashes(statePath(POSTED_HASHES_FILE))
+	if _, ok := hashes["stale"]; ok {
+		t.Error("hash older than POSTED_RETENTION kept")
+	}
+	if _, ok := hashes[alertHash(testQuake(), false)]; !ok {
+		t.Error("hash of the sent alert not saved")
+	}
+}
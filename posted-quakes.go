@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"sort"
+	"time"
+)
+
+// PostedQuake is the record kept for a posted quake: the quake as it was posted plus where and when
+// the alert was delivered. The fields are stored next to the quake's, so files written before the
+// delivery metadata existed load as they are.
+type PostedQuake struct {
+	Quake
+	// event ID of the Matrix message posted for this quake
+	EventID string `json:"matrix_event_id,omitempty"`
+	// event ID of the initial alert that bulletin revisions are threaded under
+	ThreadRootID string `json:"matrix_thread_root_id,omitempty"`
+	// Matrix room the message was posted to
+	RoomID string `json:"matrix_room_id,omitempty"`
+	// when the alert was delivered, nil if it was seeded, deferred or clustered instead
+	PostedAt *time.Time `json:"posted_at,omitempty"`
+	// comma-separated notifiers the alert was delivered through
+	Notifier string `json:"notifier,omitempty"`
+	// bulletin number of the posted revision
+	BulletinNo int `json:"bulletin_no,omitempty"`
+	// reference shown in the alerts of this quake, e.g. "EQ-000123", shared by its revisions
+	AlertRef string `json:"alert_ref,omitempty"`
+	// version shown in the last alert when later revisions were too small to post, nil when it is Quake
+	Announced *Quake `json:"announced,omitempty"`
+	// event IDs of the initial alerts in the Matrix rooms of the CONFIG_FILE destinations after the first
+	DestinationRoots map[string]string `json:"destination_roots,omitempty"`
+}
+
+// setDestinationRoot records the initial alert of the quake in the room of a destination
+func (p *PostedQuake) setDestinationRoot(name, eventID string) {
+	if p.DestinationRoots == nil {
+		p.DestinationRoots = map[string]string{}
+	}
+	p.DestinationRoots[name] = eventID
+}
+
+// newPostedQuake records q as posted without delivery metadata, e.g. when seeding the state
+func newPostedQuake(q Quake) PostedQuake {
+	bulletinNo, _, _ := getBulletinNumber(q.Bulletin)
+	return PostedQuake{Quake: q, BulletinNo: bulletinNo}
+}
+
+// postedQuakesOf records the quakes as posted without delivery metadata
+func postedQuakesOf(quakes []Quake) []PostedQuake {
+	posted := make([]PostedQuake, 0, len(quakes))
+	for _, q := range quakes {
+		posted = append(posted, newPostedQuake(q))
+	}
+	return posted
+}
+
+// postedByKey builds a map of posted quakes keyed by quakeLocationKey
+func postedByKey(posted []PostedQuake) map[string]PostedQuake {
+	m := make(map[string]PostedQuake, len(posted))
+	for _, p := range posted {
+		m[quakeLocationKey(p.Quake)] = p
+	}
+	return m
+}
+
+// postedToSlice returns the posted quakes of m sorted by datetime (newest first), quakes with an
+// unparseable datetime last
+func postedToSlice(m map[string]PostedQuake) []PostedQuake {
+	s := make([]PostedQuake, 0, len(m))
+	for _, p := range m {
+		s = append(s, p)
+	}
+	sort.Slice(s, func(i, j int) bool {
+		return s[i].OccurredAt.After(s[j].OccurredAt)
+	})
+	return s
+}
+
+// quakesOfPosted returns the quakes of the posted records, newest first
+func quakesOfPosted(m map[string]PostedQuake) []Quake {
+	posted := postedToSlice(m)
+	quakes := make([]Quake, 0, len(posted))
+	for _, p := range posted {
+		quakes = append(quakes, p.Quake)
+	}
+	return quakes
+}
+
+// prunePostedQuakes returns the quakes that occurred within retention before now, a quake exactly
+// at the edge is kept. Quakes with an unparseable datetime are kept too, so a format change at
+// PHIVOLCS can't wipe the posted history; they are logged so they don't pile up unnoticed.
+func prunePostedQuakes(posted []PostedQuake, retention time.Duration, now time.Time) []PostedQuake {
+	cutoff := now.Add(-retention)
+	kept := make([]PostedQuake, 0, len(posted))
+	for _, p := range posted {
+		if p.OccurredAt.IsZero() {
+			log.Printf("⚠️ Keeping posted quake with unparseable datetime %q, it is never pruned", p.DateTime)
+		} else if p.OccurredAt.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// withDerivedPostedFields re-derives the unserialized fields of a posted quake loaded from storage
+// and fills in the bulletin number of records saved before it was stored
+func withDerivedPostedFields(p PostedQuake) PostedQuake {
+	p.Quake = withDerivedFields(p.Quake)
+	if p.BulletinNo == 0 {
+		p.BulletinNo, _, _ = getBulletinNumber(p.Bulletin)
+	}
+	return p
+}
+
+func savePostedQuakesToFile(posted []PostedQuake, fileName string) {
+	data, _ := json.MarshalIndent(posted, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+	}
+}
+
+func readPostedQuakesFromFile(fileName string) map[string]PostedQuake {
+	var posted []PostedQuake
+	if err := readStateList(fileName, &posted); errors.Is(err, fs.ErrNotExist) {
+		log.Printf("⚠️ File not found, starting fresh: %s", fileName)
+		return map[string]PostedQuake{}
+	} else if err != nil {
+		log.Printf("⚠️ Failed to parse cache file (%s), resetting: %v", fileName, err)
+		return map[string]PostedQuake{}
+	}
+
+	for i := range posted {
+		posted[i] = withDerivedPostedFields(posted[i])
+	}
+	return postedByKey(posted)
+}
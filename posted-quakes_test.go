@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrunePostedQuakes(t *testing.T) {
+	now := time.Date(2024, time.May, 2, 1, 5, 0, 0, manilaLoc)
+	retention := 60 * 24 * time.Hour
+	posted := []PostedQuake{
+		{Quake: Quake{DateTime: "recent", OccurredAt: now.Add(-time.Hour)}},
+		{Quake: Quake{DateTime: "at the edge", OccurredAt: now.Add(-retention)}},
+		{Quake: Quake{DateTime: "just past the edge", OccurredAt: now.Add(-retention - time.Second)}},
+		{Quake: Quake{DateTime: "unparseable"}},
+	}
+	kept := prunePostedQuakes(posted, retention, now)
+	if len(posted) != 4 || posted[2].DateTime != "just past the edge" {
+		t.Errorf("prunePostedQuakes modified its input: %+v", posted)
+	}
+	var got []string
+	for _, p := range kept {
+		got = append(got, p.DateTime)
+	}
+	want := []string{"recent", "at the edge", "unparseable"}
+	if len(got) != len(want) {
+		t.Fatalf("kept %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("kept %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestParseDurationOrDays(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"60d", 60 * 24 * time.Hour, true},
+		{"30", 30 * 24 * time.Hour, true},
+		{"720h", 720 * time.Hour, true},
+		{"1.5d", 36 * time.Hour, true},
+		{"0", 0, false},
+		{"-5d", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseDurationOrDays(tt.s)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("parseDurationOrDays(%q) = %s, %v, want %s", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestRetentionAppliesOnlyToPosted(t *testing.T) {
+	useTempState(t)
+	saved := postedRetention
+	t.Cleanup(func() { postedRetention = saved })
+	postedRetention = 24 * time.Hour
+
+	recent := recentPosted("006 km S 24° W of Sagbayan (Bohol)", time.Hour)
+	old := recentPosted("017 km S 71° E of Tulunan (Cotabato)", 48*time.Hour)
+	stateStore.SavePosted([]PostedQuake{recent, old})
+	stateStore.SaveFetched([]Quake{recent.Quake, old.Quake})
+
+	posted := stateStore.LoadPosted()
+	if _, ok := posted[quakeLocationKey(old.Quake)]; ok || len(posted) != 1 {
+		t.Errorf("posted quakes after POSTED_RETENTION: %d, old one kept %v", len(posted), ok)
+	}
+	// the last fetch mirrors the page whatever the age of its quakes
+	if fetched := stateStore.LoadFetched(); len(fetched) != 2 {
+		t.Errorf("%d fetched quakes saved, want 2", len(fetched))
+	}
+}
+
+func TestPostedQuakesLegacyFormat(t *testing.T) {
+	useTempState(t)
+	at := time.Now().Add(-time.Hour).In(manilaLoc).Format(DATE_TIME_LAYOUT)
+	// posted_quakes.json as written before the delivery metadata, a plain list of quakes
+	legacy := `[{"datetime": "` + at + `", "latitude": "9.86", "longitude": "124.07", "depth": "10",
+		"magnitude": "4.2", "location": "006 km S 24° W of Sagbayan (Bohol)", "origin": "Sagbayan (Bohol)",
+		"bulletin": "` + testBulletinBase + `B2.html"}]`
+	if err := os.WriteFile(statePath(POST_QUAKE_FILE), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	posted := stateStore.LoadPosted()
+	key := at + "|006 km S 24° W of Sagbayan (Bohol)"
+	p, ok := posted[key]
+	if !ok || len(posted) != 1 {
+		t.Fatalf("legacy file loaded as %+v", posted)
+	}
+	if p.Magnitude != "4.2" || p.OccurredAt.IsZero() || p.BulletinNo != 2 || p.EventID != "" || p.PostedAt != nil {
+		t.Errorf("legacy record = %+v", p)
+	}
+	if !updatedQuakeHasBeenPosted(posted, p.Quake) {
+		t.Error("legacy record not found by updatedQuakeHasBeenPosted")
+	}
+
+	// saved again in the new shape, the delivery metadata next to the quake fields
+	p.EventID, p.RoomID, p.Notifier = "$event1", "!room:example.org", NOTIFIER_MATRIX
+	postedAt := time.Now().UTC()
+	p.PostedAt = &postedAt
+	stateStore.SavePosted([]PostedQuake{p})
+	data, err := os.ReadFile(statePath(POST_QUAKE_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []map[string]any
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 1 {
+		t.Fatalf("saved file %s: %v", data, err)
+	}
+	for field, want := range map[string]any{
+		"datetime":        at,
+		"magnitude":       "4.2",
+		"matrix_event_id": "$event1",
+		"matrix_room_id":  "!room:example.org",
+		"notifier":        NOTIFIER_MATRIX,
+		"bulletin_no":     float64(2),
+	} {
+		if saved[0][field] != want {
+			t.Errorf("saved %s = %v, want %v", field, saved[0][field], want)
+		}
+	}
+	if reloaded := stateStore.LoadPosted()[key]; reloaded.EventID != "$event1" || reloaded.PostedAt == nil || !reloaded.PostedAt.Equal(*p.PostedAt) {
+		t.Errorf("new shape read back as %+v", reloaded)
+	}
+}
+
+func TestSeededPostedQuakeOmitsPostedAt(t *testing.T) {
+	data, err := json.Marshal(newPostedQuake(bulletinQuake("B1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "posted_at") {
+		t.Errorf("seeded record stores a delivery time: %s", data)
+	}
+}
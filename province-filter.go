@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// trailing "(Province)" of a PHIVOLCS location
+var provinceRe = regexp.MustCompile(`\(([^()]+)\)\s*$`)
+
+// provinceOf returns the province PHIVOLCS appends to a location, e.g. "Cebu" for
+// "025 km N 45° W of Talisay City (Cebu)", empty when there is none
+func provinceOf(location string) string {
+	if m := provinceRe.FindStringSubmatch(location); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// provinceAllowed reports whether the province of q is listed in PROVINCES_FILTER, compared
+// with normalizeAddr so "Davao Del Sur" matches "Davao del Sur". Every quake is allowed when
+// the filter is unset, none without a province when it is set.
+func provinceAllowed(q Quake) bool {
+	if strings.TrimSpace(provincesFilter) == "" {
+		return true
+	}
+	province := normalizeAddr(q.Province)
+	if province == "" {
+		return false
+	}
+	for _, name := range strings.Split(provincesFilter, ",") {
+		if normalizeAddr(name) == province {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ARCHIVE_EVENT_NEW      = "new"
+	ARCHIVE_EVENT_REVISION = "revision"
+)
+
+// archiveRecord is one line of ARCHIVE_FILE
+type archiveRecord struct {
+	SeenAt time.Time `json:"seen_at"`
+	Event  string    `json:"event"`
+	Quake  Quake     `json:"quake"`
+}
+
+// quakeArchive appends every quake and revision seen to a JSON Lines file that is never pruned,
+// independent of the state files
+type quakeArchive struct {
+	f *os.File
+	w *bufio.Writer
+	// fingerprints of the archived rows, so a restart doesn't append them again
+	seen map[string]bool
+	// origin keys of the archived quakes, later rows of the same quake are revisions
+	keys map[string]bool
+}
+
+// nil when ARCHIVE_FILE is not set
+var archive *quakeArchive
+
+// archiveFingerprint identifies a revision of a quake by the fields PHIVOLCS revises
+func archiveFingerprint(q Quake) string {
+	return strings.Join([]string{quakeOriginKey(q), q.Bulletin, q.Magnitude, q.Depth,
+		normalizeCoord(q.Latitude), normalizeCoord(q.Longitude), q.Location}, "|")
+}
+
+// openQuakeArchive reads the fingerprints of the rows already archived and opens the file for appending
+func openQuakeArchive(name string) (*quakeArchive, error) {
+	a := &quakeArchive{seen: map[string]bool{}, keys: map[string]bool{}}
+	if err := readArchive(stateReadPath(name), func(r archiveRecord) {
+		a.seen[archiveFingerprint(r.Quake)] = true
+		a.keys[quakeOriginKey(r.Quake)] = true
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(statePath(name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	a.f = f
+	a.w = bufio.NewWriter(f)
+	return a, nil
+}
+
+// readArchive calls fn for each record of the archive, skipping lines that don't parse
+// (e.g. one cut short by a crash)
+func readArchive(fileName string, fn func(archiveRecord)) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var r archiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			log.Printf("⚠️ Skipping unparseable archive line %d in %s: %v", n, fileName, err)
+			continue
+		}
+		fn(r)
+	}
+	return scanner.Err()
+}
+
+// record queues the quakes for the archive, oldest first, skipping revisions archived before
+// and rows that failed validation
+func (a *quakeArchive) record(quakes []Quake) {
+	if a == nil {
+		return
+	}
+	for i := len(quakes) - 1; i >= 0; i-- {
+		if !quakes[i].Ineligible {
+			a.recordQuake(quakes[i])
+		}
+	}
+}
+
+func (a *quakeArchive) recordQuake(q Quake) {
+	fp := archiveFingerprint(q)
+	if a.seen[fp] {
+		return
+	}
+	event := ARCHIVE_EVENT_NEW
+	if a.keys[quakeOriginKey(q)] {
+		event = ARCHIVE_EVENT_REVISION
+	}
+	data, err := json.Marshal(archiveRecord{SeenAt: time.Now().UTC(), Event: event, Quake: q})
+	if err != nil {
+		log.Printf("❌ Failed to encode archive record: %v", err)
+		return
+	}
+	a.w.Write(append(data, '\n'))
+	a.seen[fp] = true
+	a.keys[quakeOriginKey(q)] = true
+}
+
+// sync writes the queued records and fsyncs the file, called once per poll cycle
+func (a *quakeArchive) sync() {
+	if a == nil {
+		return
+	}
+	if err := a.w.Flush(); err != nil {
+		log.Printf("❌ Failed to write to archive (%s): %v", a.f.Name(), err)
+		return
+	}
+	if err := a.f.Sync(); err != nil {
+		log.Printf("❌ Failed to sync archive (%s): %v", a.f.Name(), err)
+	}
+}
+
+func (a *quakeArchive) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.sync()
+	return a.f.Close()
+}
+
+// column headers of the archive CSV export
+var archiveCSVHeader = append([]string{"SeenAt", "Event"}, csvExportHeader...)
+
+// exportArchive converts ARCHIVE_FILE to the given format on stdout, only csv is supported
+func exportArchive(format string) error {
+	if !strings.EqualFold(format, "csv") {
+		return fmt.Errorf("unsupported archive export format %q, expected csv", format)
+	}
+	if archiveFile == "" {
+		return fmt.Errorf("ARCHIVE_FILE is not set")
+	}
+	return writeArchiveCSV(os.Stdout, stateReadPath(archiveFile))
+}
+
+// writeArchiveCSV writes the header row followed by one row per archived record, oldest first
+func writeArchiveCSV(out io.Writer, fileName string) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(archiveCSVHeader); err != nil {
+		return fmt.Errorf("csv write error: %w", err)
+	}
+	var writeErr error
+	err := readArchive(fileName, func(r archiveRecord) {
+		if writeErr == nil {
+			writeErr = w.Write(append([]string{r.SeenAt.Format(time.RFC3339), r.Event}, quakeCSVRow(r.Quake)...))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("csv write error: %w", writeErr)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("csv flush error: %w", err)
+	}
+	return nil
+}
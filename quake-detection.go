@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+)
+
+// updatePair is a revised bulletin of a quake together with the version it revises
+type updatePair struct {
+	New Quake
+	Old Quake
+	// too small a change to post, the posted record only follows the revision
+	Silent bool
+}
+
+// previousFetchOf finds the quake of the previous fetch that q revises, by origin and datetime
+// and, for later bulletins, through the similarity heuristics
+func previousFetchOf(lastFetch map[string]Quake, q Quake) (Quake, bool) {
+	previousQuake, ok := lastFetch[quakeOriginKey(q)]
+	if !ok {
+		if bulletinNo, _, _ := getBulletinNumber(q.Bulletin); bulletinNo != 1 {
+			previousQuake, ok = determinePastQuakeThroughHeuristics(lastFetch, q)
+		}
+	}
+	return previousQuake, ok
+}
+
+// carryOverBulletinDetails copies the scraped bulletin details of the previous fetch into the quakes
+// whose bulletin didn't change, so they are kept in the cache without fetching the bulletin again
+func carryOverBulletinDetails(latest []Quake, lastFetch map[string]Quake) {
+	for i, q := range latest {
+		if previousQuake, ok := previousFetchOf(lastFetch, q); ok && q.Bulletin == previousQuake.Bulletin {
+			copyBulletinDetails(&latest[i], previousQuake)
+		}
+	}
+}
+
+// quakesBefore returns the quakes that occurred before t, and those whose time is unknown
+func quakesBefore(quakes []Quake, t time.Time) []Quake {
+	var before []Quake
+	for _, q := range quakes {
+		if q.OccurredAt.Before(t) {
+			before = append(before, q)
+		}
+	}
+	return before
+}
+
+// processQuakes compares the latest fetch with the previous one and the posted quakes. It returns
+// the new quakes worth posting and the revisions of earlier quakes worth an update, both newest
+// first like latest. The arguments are left untouched and nothing is fetched or posted.
+func processQuakes(latest []Quake, lastFetch map[string]Quake, posted map[string]PostedQuake) (changed []Quake, updated []updatePair) {
+	postedTimeCoords := timeCoordKeys(posted)
+
+	for _, currentQuake := range latest {
+		previousQuake, updateExists := previousFetchOf(lastFetch, currentQuake)
+
+		if !updateExists {
+			// new quake detected
+			_, postedExists := posted[quakeLocationKey(currentQuake)]
+			if !postedExists {
+				// the location text may have changed since it was posted
+				postedExists = postedTimeCoords[quakeTimeCoordKey(currentQuake)]
+			}
+			threshold := detectionThresholdFor(currentQuake)
+			if postedExists {
+				logFiltered(currentQuake, "already posted")
+			} else if currentQuake.Ineligible {
+				logFiltered(currentQuake, "row failed validation")
+			} else if reason, excluded := originExcluded(currentQuake); excluded {
+				logOriginExcluded(currentQuake, reason)
+			} else if (!currentQuake.MagnitudeOK || currentQuake.MagnitudeValue < threshold) && !feltQualifies(currentQuake) {
+				logFiltered(currentQuake, fmt.Sprintf("below the M%.1f threshold", threshold))
+			} else {
+				changed = append(changed, currentQuake)
+			}
+			continue
+		}
+
+		// bulletin details are only scraped again when the bulletin itself changed
+		if currentQuake.Bulletin == previousQuake.Bulletin {
+			copyBulletinDetails(&currentQuake, previousQuake)
+		}
+		if !quakeChanged(previousQuake, currentQuake) {
+			continue
+		}
+		if updatedQuakeHasBeenPosted(posted, currentQuake) {
+			logFiltered(currentQuake, "update already posted")
+		} else if !isCurrentAndPastQSignificant(currentQuake, previousQuake) {
+			logFiltered(currentQuake, "update below the magnitude threshold")
+		} else if currentQuake.Ineligible {
+			logFiltered(currentQuake, "updated row failed validation")
+		} else if reason, excluded := originExcluded(currentQuake); excluded {
+			logOriginExcluded(currentQuake, reason)
+		} else if feltPromotion(posted, previousQuake, currentQuake) {
+			// nothing was posted to thread the revision under, it is announced like a new quake
+			slog.Info(fmt.Sprintf("🙋 Revision reports Intensity %s, posting as a new quake: %s | M%s", currentQuake.MaxIntensity, currentQuake.DateTime, currentQuake.Magnitude),
+				quakeLogAttrs(currentQuake)...)
+			changed = append(changed, currentQuake)
+		} else {
+			// updated quake detected
+			u := updatePair{New: currentQuake, Old: previousQuake}
+			// only revisions of a posted alert are gated, one crossing the threshold is always posted
+			if original := findPostedOriginal(posted, previousQuake); updateGateEnabled() && original.DateTime != "" {
+				ok, reason := significantRevision(announcedQuake(original), currentQuake)
+				if !ok {
+					u.Silent = true
+					slog.Info(fmt.Sprintf("🔇 Not posting the update of %s | M%s: %s", currentQuake.DateTime, currentQuake.Magnitude, reason),
+						quakeLogAttrs(currentQuake)...)
+				} else {
+					slog.Debug("Revision significant", append(quakeLogAttrs(currentQuake), "changes", reason)...)
+				}
+			}
+			updated = append(updated, u)
+		}
+	}
+	return changed, updated
+}
+
+// logFiltered explains in dry-run mode why a quake is not posted
+func logFiltered(q Quake, reason string) {
+	if dryRun {
+		log.Printf("🧪 [dry-run] Not posting %s | M%s | %s: %s", q.DateTime, q.Magnitude, q.Location, reason)
+	}
+}
+
+// enrichDetected scrapes the bulletins of the new quakes and of the updates with a new bulletin.
+// The details are stored in latest too, so the cache remembers them for the next cycle.
+func enrichDetected(ctx context.Context, latest []Quake, changed []Quake, updated []updatePair) {
+	index := make(map[string]int, len(latest))
+	for i, q := range latest {
+		index[quakeOriginKey(q)] = i
+	}
+
+	var toEnrich []int
+	for _, q := range changed {
+		toEnrich = append(toEnrich, index[quakeOriginKey(q)])
+	}
+	for _, u := range updated {
+		if u.New.Bulletin != u.Old.Bulletin {
+			toEnrich = append(toEnrich, index[quakeOriginKey(u.New)])
+		}
+	}
+	enrichWithBulletins(ctx, latest, toEnrich)
+
+	for i, q := range changed {
+		changed[i] = latest[index[quakeOriginKey(q)]]
+	}
+	for i, u := range updated {
+		updated[i].New = latest[index[quakeOriginKey(u.New)]]
+	}
+}
+
+// seedFirstRun initializes the state of a fresh deploy with the quakes on the page without
+// posting them, except those within FIRST_RUN_POST_WINDOW. It reports whether every quake
+// was seeded, leaving nothing to check as new
+func seedFirstRun(latestQuakes []Quake, validators pageValidators) bool {
+	seeded := latestQuakes
+	if firstRunPostWindow > 0 {
+		seeded = quakesBefore(latestQuakes, time.Now().Add(-firstRunPostWindow))
+	}
+	archive.record(latestQuakes)
+	archive.sync()
+	stateStore.SaveFetched(seeded)
+	stateStore.SavePosted(postedToSlice(postedByKey(postedQuakesOf(seeded))))
+	savePageValidators(validators, statePath(FETCH_STATE_FILE))
+	log.Printf("🌱 First run, initialized state with %d quakes without posting (set BACKFILL=true to post them)", len(seeded))
+	if len(seeded) == len(latestQuakes) {
+		return true
+	}
+	// the rest is recent enough to be announced and goes through the usual checks as new quakes
+	log.Printf("🌱 %d quakes are within FIRST_RUN_POST_WINDOW (%s), checking them as new", len(latestQuakes)-len(seeded), firstRunPostWindow)
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// frontPageQuakes parses the front page fixture
+func frontPageQuakes(t *testing.T) []Quake {
+	t.Helper()
+	quakes, err := parseFirstN(loadTestPage(t, "testdata/phivolcs-front-page.html"), 10)
+	if err != nil {
+		t.Fatalf("parseFirstN: %v", err)
+	}
+	return quakes
+}
+
+func TestProcessQuakesNew(t *testing.T) {
+	useThresholds(t, 4, 4)
+	latest := frontPageQuakes(t)
+
+	changed, updated := processQuakes(latest, map[string]Quake{}, map[string]PostedQuake{})
+	if len(changed) != 1 || changed[0].Magnitude != "4.3" || len(updated) != 0 {
+		t.Fatalf("changed %+v, updated %+v, want only the M4.3 quake", changed, updated)
+	}
+
+	// posted already, under the same key or with a reworded location at the same time and place
+	posted := postedByKey([]PostedQuake{newPostedQuake(latest[0])})
+	if changed, _ := processQuakes(latest, map[string]Quake{}, posted); len(changed) != 0 {
+		t.Errorf("posted quake detected again: %+v", changed)
+	}
+	reworded := newPostedQuake(latest[0])
+	reworded.Location = "020 km N 55° E of Medellin (Cebu)"
+	if changed, _ := processQuakes(latest, map[string]Quake{}, postedByKey([]PostedQuake{reworded})); len(changed) != 0 {
+		t.Errorf("quake posted under another location detected again: %+v", changed)
+	}
+
+	// a row failing validation is never posted
+	invalid := append([]Quake(nil), latest...)
+	invalid[0].Ineligible = true
+	if changed, _ := processQuakes(invalid, map[string]Quake{}, map[string]PostedQuake{}); len(changed) != 0 {
+		t.Errorf("ineligible quake detected: %+v", changed)
+	}
+}
+
+func TestProcessQuakesUpdated(t *testing.T) {
+	useThresholds(t, 4, 4)
+	previous := frontPageQuakes(t)
+	lastFetch := quakesByKey(previous, quakeOriginKey)
+	posted := postedByKey([]PostedQuake{newPostedQuake(previous[0])})
+
+	// the same page again is neither new nor an update
+	if changed, updated := processQuakes(previous, lastFetch, posted); len(changed) != 0 || len(updated) != 0 {
+		t.Fatalf("unchanged page: changed %+v, updated %+v", changed, updated)
+	}
+
+	latest := append([]Quake(nil), previous...)
+	latest[0].Magnitude = "4.6"
+	latest[0].Bulletin = strings.Replace(previous[0].Bulletin, "_B2F", "_B3F", 1)
+	latest[0] = withDerivedFields(latest[0])
+	changed, updated := processQuakes(latest, lastFetch, posted)
+	if len(changed) != 0 || len(updated) != 1 {
+		t.Fatalf("changed %+v, updated %+v, want one update", changed, updated)
+	}
+	if u := updated[0]; u.Old.Magnitude != "4.3" || u.New.Magnitude != "4.6" {
+		t.Errorf("update %s → %s, want 4.3 → 4.6", u.Old.Magnitude, u.New.Magnitude)
+	}
+	if previous[0].Magnitude != "4.3" || lastFetch[quakeOriginKey(previous[0])].Magnitude != "4.3" {
+		t.Error("processQuakes modified its arguments")
+	}
+
+	// a revision of a quake below the threshold before and after is not posted
+	latest = append([]Quake(nil), previous...)
+	latest[1].Magnitude = "2.7"
+	latest[1] = withDerivedFields(latest[1])
+	if changed, updated := processQuakes(latest, lastFetch, posted); len(changed) != 0 || len(updated) != 0 {
+		t.Errorf("revision below the threshold: changed %+v, updated %+v", changed, updated)
+	}
+}
+
+func TestFirstRunSeedsWithoutPosting(t *testing.T) {
+	useTempState(t)
+	useThresholds(t, 1, 1)
+	h := useHomeserver(t, 0)
+	savedWindow := firstRunPostWindow
+	t.Cleanup(func() { firstRunPostWindow = savedWindow })
+	firstRunPostWindow = 0
+	latest := frontPageQuakes(t)
+	// recent enough to outlive POSTED_RETENTION
+	for i := range latest {
+		latest[i].OccurredAt = time.Now().Add(-time.Duration(i+1) * time.Hour)
+	}
+
+	if stateStore.Exists() {
+		t.Fatal("empty STATE_DIR reported as existing state")
+	}
+	if !seedFirstRun(latest, pageValidators{}) {
+		t.Fatal("first run left quakes to check as new")
+	}
+	if !stateStore.Exists() {
+		t.Error("no state saved on the first run")
+	}
+	if posted := stateStore.LoadPosted(); len(posted) != len(latest) {
+		t.Errorf("%d quakes seeded as posted, want %d", len(posted), len(latest))
+	}
+
+	// the next cycle finds the same page already handled
+	changed, updated := processQuakes(latest, stateStore.LoadFetched(), stateStore.LoadPosted())
+	if len(changed) != 0 || len(updated) != 0 {
+		t.Errorf("after seeding: changed %+v, updated %+v", changed, updated)
+	}
+	if len(h.requests) != 0 {
+		t.Errorf("%d Matrix requests on the first run, want none", len(h.requests))
+	}
+}
+
+func TestFirstRunPostWindow(t *testing.T) {
+	useTempState(t)
+	useThresholds(t, 4, 4)
+	savedWindow := firstRunPostWindow
+	t.Cleanup(func() { firstRunPostWindow = savedWindow })
+	firstRunPostWindow = time.Hour
+	latest := frontPageQuakes(t)
+	latest[0].OccurredAt = time.Now().Add(-10 * time.Minute)
+
+	if seedFirstRun(latest, pageValidators{}) {
+		t.Fatal("quake within FIRST_RUN_POST_WINDOW was seeded")
+	}
+	changed, _ := processQuakes(latest, stateStore.LoadFetched(), stateStore.LoadPosted())
+	if len(changed) != 1 || changed[0].Magnitude != "4.3" {
+		t.Errorf("changed %+v, want only the recent M4.3 quake", changed)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	// embed the timezone database, the alpine runtime image ships without one
+	_ "time/tzdata"
+)
+
+// manilaLoc is Philippine time, in which PHIVOLCS reports and we display quake times
+var manilaLoc = loadManilaLocation()
+
+func loadManilaLocation() *time.Location {
+	loc, err := time.LoadLocation("Asia/Manila")
+	if err != nil {
+		log.Printf("⚠️ Failed to load Asia/Manila timezone, using fixed UTC+8: %v", err)
+		return time.FixedZone("PST", 8*60*60)
+	}
+	return loc
+}
+
+// parseQuakeTime parses a DATE_TIME_LAYOUT string as Philippine time
+func parseQuakeTime(dateTime string) (time.Time, error) {
+	return time.ParseInLocation(DATE_TIME_LAYOUT, dateTime, manilaLoc)
+}
+
+// withOccurredAt re-derives OccurredAt from DateTime, e.g. for quakes loaded from cache files
+func withOccurredAt(q Quake) Quake {
+	if q.OccurredAt.IsZero() {
+		if t, err := parseQuakeTime(q.DateTime); err == nil {
+			q.OccurredAt = t
+		} else {
+			log.Printf("⚠️ Failed to parse datetime %q: %v", q.DateTime, err)
+		}
+	}
+	return q
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// deferredAlert is an alert held back during quiet hours, posted once the window ends
+type deferredAlert struct {
+	Quake   Quake `json:"quake"`
+	Updated bool  `json:"updated,omitempty"`
+	// quake before the revision, for updates
+	Old Quake `json:"old"`
+	// name of the destination in quiet hours, empty for the first one
+	Destination string `json:"destination,omitempty"`
+}
+
+// alerts held back during the current quiet hours, persisted in the state store so a restart doesn't
+// lose them and reloaded before each change, instances sharing the state share the queue
+var deferredAlerts []deferredAlert
+
+// parseClock parses a "HH:MM" time of day into minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quietWindow returns the start and end of the quiet hours, from QUIET_HOURS ("22:00-07:00")
+// or else QUIET_HOURS_START and QUIET_HOURS_END. Both are empty when quiet hours are disabled.
+func quietWindow() (string, string, error) {
+	if quietHours == "" {
+		return quietHoursStart, quietHoursEnd, nil
+	}
+	start, end, ok := strings.Cut(quietHours, "-")
+	if !ok {
+		return "", "", fmt.Errorf("invalid QUIET_HOURS %q (expected HH:MM-HH:MM)", quietHours)
+	}
+	return strings.TrimSpace(start), strings.TrimSpace(end), nil
+}
+
+// inQuietHours reports whether t falls in the quiet hours (Philippine time), which may wrap past
+// midnight. Always false when the window is unset or invalid.
+func inQuietHours(t time.Time) bool {
+	startClock, endClock, err := quietWindow()
+	if err != nil {
+		return false
+	}
+	return inQuietWindow(t, startClock, endClock)
+}
+
+// inQuietWindow reports whether t falls between two HH:MM times of day in Philippine time
+func inQuietWindow(t time.Time, startClock, endClock string) bool {
+	if startClock == "" || endClock == "" {
+		return false
+	}
+	start, err1 := parseClock(startClock)
+	end, err2 := parseClock(endClock)
+	if err1 != nil || err2 != nil || start == end {
+		return false
+	}
+	local := t.In(manilaLoc)
+	now := local.Hour()*60 + local.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// heldIndex returns the position of the alert for q held for a destination in deferredAlerts, -1 if none
+func heldIndex(dest string, q Quake) int {
+	for i, a := range deferredAlerts {
+		if destinationNamed(a.Destination) != destinationNamed(dest) {
+			continue
+		}
+		if quakeLocationKey(a.Quake) == quakeLocationKey(q) || isKnownBulletin(q, a.Quake) {
+			return i
+		}
+	}
+	return -1
+}
+
+// deferAlert queues an alert until quiet hours end. A revision of a quake already held replaces it,
+// the summary only lists the latest bulletin.
+func deferAlert(a deferredAlert) {
+	log.Printf("🌙 Quiet hours, deferring alert: %s | M%s | %s", a.Quake.DateTime, a.Quake.Magnitude, a.Quake.Location)
+	// other instances sharing the state may have changed the queue
+	deferredAlerts = stateStore.LoadDeferred()
+	i := -1
+	if a.Updated {
+		i = heldIndex(a.Destination, a.Old)
+	}
+	if i >= 0 {
+		held := deferredAlerts[i]
+		held.Quake = a.Quake
+		if !held.Updated {
+			held.Old = a.Quake
+		}
+		deferredAlerts[i] = held
+	} else {
+		deferredAlerts = append(deferredAlerts, a)
+	}
+	stateStore.SaveDeferred(deferredAlerts)
+}
+
+// dropSupersededAlert removes the held alert of a quake whose revision is posted right away,
+// e.g. after it was upgraded above QUIET_MIN_MAG
+func dropSupersededAlert(dest string, old Quake) {
+	deferredAlerts = stateStore.LoadDeferred()
+	i := heldIndex(dest, old)
+	if i < 0 {
+		return
+	}
+	log.Printf("🌙 Dropping the held alert superseded by a revision: %s | M%s | %s", old.DateTime, old.Magnitude, old.Location)
+	deferredAlerts = append(deferredAlerts[:i], deferredAlerts[i+1:]...)
+	stateStore.SaveDeferred(deferredAlerts)
+}
+
+// flushDeferredAlerts posts the alerts held for each destination as one summary once its quiet
+// hours are over and records them in postedQuakes, revisions of them then reply to the summary.
+// The alerts were claimed and numbered when they were held, the summary is claimed again so only one
+// instance sharing the queue posts it. A summary no notifier took stays queued and is retried next
+// cycle. Returns whether postedQuakes was changed.
+func flushDeferredAlerts(ctx context.Context, postedQuakes map[string]PostedQuake) bool {
+	deferredAlerts = stateStore.LoadDeferred()
+	if len(deferredAlerts) == 0 {
+		return false
+	}
+	now := time.Now()
+	var still []deferredAlert
+	var ready []*destination
+	byDestination := map[*destination][]deferredAlert{}
+	for _, a := range deferredAlerts {
+		d := destinationNamed(a.Destination)
+		if d.inQuietHours(now) {
+			still = append(still, a)
+			continue
+		}
+		if _, ok := byDestination[d]; !ok {
+			ready = append(ready, d)
+		}
+		byDestination[d] = append(byDestination[d], a)
+	}
+	if len(ready) == 0 {
+		return false
+	}
+
+	for _, d := range ready {
+		alerts := byDestination[d]
+		hash := summaryHash(d, alerts)
+		if claimed, err := stateStore.Claim(hash); err != nil {
+			log.Printf("⚠️ Failed to claim the quiet hours summary, posting anyway: %v", err)
+		} else if !claimed {
+			log.Printf("🤝 Quiet hours summary of %d held alerts claimed by another instance, skipping", len(alerts))
+			continue
+		}
+		if !postQuietSummary(ctx, d, alerts, postedQuakes) {
+			still = append(still, alerts...)
+			if err := stateStore.Release(hash); err != nil {
+				log.Printf("⚠️ Failed to release the quiet hours summary claim: %v", err)
+			}
+		}
+	}
+	deferredAlerts = still
+	stateStore.SaveDeferred(deferredAlerts)
+	return true
+}
+
+// summaryHash identifies the quiet hours summary of the alerts held for a destination
+func summaryHash(d *destination, alerts []deferredAlert) string {
+	h := sha1.New()
+	io.WriteString(h, "summary|"+d.name)
+	for _, a := range alerts {
+		io.WriteString(h, "|"+alertHash(a.Quake, a.Updated))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// postQuietSummary posts the alerts held for a destination in one message and records its event ID.
+// Returns false when no notifier took the summary, only the alert references are recorded then.
+func postQuietSummary(ctx context.Context, d *destination, alerts []deferredAlert, postedQuakes map[string]PostedQuake) bool {
+	if configFile != "" {
+		log.Printf("🌅 Quiet hours over, posting a summary of %d held alerts to %s", len(alerts), d.name)
+	} else {
+		log.Printf("🌅 Quiet hours over, posting a summary of %d held alerts", len(alerts))
+	}
+	posted := make([]PostedQuake, 0, len(alerts))
+	for _, a := range alerts {
+		p, ok := postedQuakes[quakeLocationKey(a.Quake)]
+		if !ok {
+			p = newPostedQuake(a.Quake)
+			if a.Updated {
+				original := findPostedOriginal(postedQuakes, a.Old)
+				p.ThreadRootID = threadRootID(original)
+				p.AlertRef = original.AlertRef
+			}
+		}
+		if p.AlertRef == "" {
+			p.AlertRef = alertRefFor(false, PostedQuake{})
+		}
+		posted = append(posted, p)
+	}
+
+	msg, formatted := formatQuietSummary(alerts, posted)
+	var eventID, roomID string
+	var delivered []string
+	var errs []error
+	for _, n := range d.notifierList() {
+		var err error
+		if m, ok := n.(matrixNotifier); ok {
+			eventID, err = m.notifyThreaded(ctx, msg, formatted, "", false)
+			roomID = m.roomID
+		} else if qn, ok := n.(quakeNotifier); ok {
+			// structured sinks still get one payload per quake
+			for _, a := range alerts {
+				err = errors.Join(err, qn.notifyQuake(a.Updated, a.Old, a.Quake))
+			}
+		} else {
+			err = n.Notify(msg, formatted)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n, err))
+		} else {
+			delivered = append(delivered, fmt.Sprint(n))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("Quiet hours summary post failed: %v", err)
+	}
+	if len(delivered) == 0 {
+		log.Printf("🌙 Keeping the %d held alerts queued, retrying next cycle", len(alerts))
+		// the retry shows the same references
+		for i, a := range alerts {
+			postedQuakes[quakeLocationKey(a.Quake)] = posted[i]
+		}
+		return false
+	}
+
+	postedAt := time.Now().UTC()
+	for i, a := range alerts {
+		p := posted[i]
+		p.PostedAt = &postedAt
+		p.Notifier = strings.Join(delivered, ",")
+		// the summary is the root of the quakes it lists, unless one already had an alert
+		if eventID != "" && d == destinations[0] {
+			if p.ThreadRootID == "" {
+				p.ThreadRootID = eventID
+			}
+			p.EventID, p.RoomID = eventID, roomID
+		} else if eventID != "" && p.DestinationRoots[d.name] == "" {
+			p.setDestinationRoot(d.name, eventID)
+		}
+		markSent(a.Quake, a.Updated)
+		status.recordPosted(a.Quake)
+		postedQuakes[quakeLocationKey(a.Quake)] = p
+		if isTsunamiTrigger(a.Quake) {
+			watchTsunamiFor(a.Quake)
+		}
+	}
+	return true
+}
+
+// formatQuietSummary lists the alerts held during quiet hours in one message, oldest first, in each
+// MESSAGE_LANG language separated by a divider
+func formatQuietSummary(alerts []deferredAlert, posted []PostedQuake) (string, string) {
+	var plains, formatteds []string
+	for _, lang := range messageLangs() {
+		plain, formatted := formatQuietSummaryIn(lang, alerts, posted)
+		plains, formatteds = append(plains, plain), append(formatteds, formatted)
+	}
+	return strings.Join(plains, LANG_DIVIDER_PLAIN), strings.Join(formatteds, LANG_DIVIDER_HTML)
+}
+
+// formatQuietSummaryIn formats the quiet hours summary in one language of the message catalog
+func formatQuietSummaryIn(lang string, alerts []deferredAlert, posted []PostedQuake) (string, string) {
+	title := "🌅 " + fmt.Sprintf(tr(lang, "quiet.title"), len(alerts))
+	if len(alerts) == 1 {
+		title = "🌅 " + tr(lang, "quiet.title.one")
+	}
+	var plain, formatted strings.Builder
+	plain.WriteString(title + "\n")
+	formatted.WriteString("<b>" + title + "</b><ul>")
+	for i, a := range alerts {
+		q := a.Quake
+		revised := ""
+		if a.Updated {
+			revised = " (" + tr(lang, "quiet.revised") + ")"
+		}
+		// "Mw 7.1", or "M7.1" when the bulletin has no magnitude type
+		mag := formatMagnitude(q)
+		if q.MagType == "" {
+			mag = "M" + mag
+		}
+		fmt.Fprintf(&plain, "• %s | %s | %s%s\n  %s: %s", mag, q.DateTime, q.Location, revised, tr(lang, "bulletin"), q.Bulletin)
+		fmt.Fprintf(&formatted, "<li><b>%s</b> | %s | <a href=\"%s\">%s</a>%s",
+			mag, q.DateTime, q.Bulletin, q.Location, revised)
+		if posted[i].AlertRef != "" {
+			fmt.Fprintf(&plain, " (%s: %s)", tr(lang, "ref"), posted[i].AlertRef)
+			fmt.Fprintf(&formatted, " <code>%s</code>", posted[i].AlertRef)
+		}
+		plain.WriteString("\n")
+		formatted.WriteString("</li>")
+	}
+	formatted.WriteString("</ul>")
+	return strings.TrimSuffix(plain.String(), "\n"), formatted.String()
+}
+
+func readDeferredAlerts(fileName string) []deferredAlert {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil
+	}
+	alerts, err := parseDeferredAlerts(data)
+	if err != nil {
+		log.Printf("⚠️ Failed to parse deferred alerts %s: %v", fileName, err)
+		return nil
+	}
+	return alerts
+}
+
+// parseDeferredAlerts decodes held alerts saved as JSON by any state backend
+func parseDeferredAlerts(data []byte) ([]deferredAlert, error) {
+	var alerts []deferredAlert
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		return nil, err
+	}
+	for i := range alerts {
+		alerts[i] = withDerivedAlertFields(alerts[i])
+	}
+	return alerts, nil
+}
+
+// withDerivedAlertFields sets the fields of the quakes of a held alert that aren't stored
+func withDerivedAlertFields(a deferredAlert) deferredAlert {
+	a.Quake = withDerivedFields(a.Quake)
+	if a.Updated {
+		a.Old = withDerivedFields(a.Old)
+	}
+	return a
+}
+
+func saveDeferredAlerts(alerts []deferredAlert, fileName string) {
+	data, _ := json.MarshalIndent(alerts, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+	}
+}
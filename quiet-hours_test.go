@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFormatQuietSummaryMagnitude(t *testing.T) {
+	alerts := []deferredAlert{
+		{Quake: Quake{MagType: "Mw", MagnitudeValue: 7.1, DateTime: "2023-12-02 22:37", Location: "030 km N 72° E of Hinatuan (Surigao Del Sur)"}},
+		{Quake: Quake{MagnitudeValue: 4.5, DateTime: "2023-12-03 01:10", Location: "006 km S 24° W of Sagbayan (Bohol)"}, Updated: true},
+	}
+	posted := []PostedQuake{{AlertRef: "EQ-2023-0001"}, {}}
+	plain, formatted := formatQuietSummary(alerts, posted)
+
+	for _, want := range []string{"• Mw 7.1 | 2023-12-02 22:37", "(Ref: EQ-2023-0001)", "• M4.5 | 2023-12-03 01:10", "(revised)"} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("plain summary misses %q:\n%s", want, plain)
+		}
+	}
+	for _, want := range []string{"<li><b>Mw 7.1</b>", "<li><b>M4.5</b>", "<code>EQ-2023-0001</code>"} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("formatted summary misses %q:\n%s", want, formatted)
+		}
+	}
+	if strings.Contains(plain, "MMw") || strings.Contains(formatted, "MMw") {
+		t.Errorf("magnitude type prefixed with M:\n%s\n%s", plain, formatted)
+	}
+}
+
+func TestFormatQuietSummaryLanguages(t *testing.T) {
+	alerts := []deferredAlert{{Quake: Quake{MagnitudeValue: 4.5, DateTime: "2023-12-03 01:10", Location: "006 km S 24° W of Sagbayan (Bohol)"}, Updated: true}}
+	posted := []PostedQuake{{AlertRef: "EQ-000001"}}
+
+	useMessageLang(t, "fil")
+	plain, formatted := formatQuietSummary(alerts, posted)
+	for _, want := range []string{"1 lindol", "(binago)", "Sanggunian: EQ-000001"} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("Filipino summary misses %q:\n%s", want, plain)
+		}
+	}
+	// the location is used as is, like in the alert messages
+	if !strings.Contains(formatted, ">006 km S 24° W of Sagbayan (Bohol)</a>") {
+		t.Errorf("formatted summary changed the location:\n%s", formatted)
+	}
+
+	useMessageLang(t, "en+fil")
+	plain, formatted = formatQuietSummary(alerts, posted)
+	if !strings.Contains(plain, "(revised)") || !strings.Contains(plain, "(binago)") || !strings.Contains(formatted, LANG_DIVIDER_HTML) {
+		t.Errorf("bilingual summary misses a language:\n%s\n%s", plain, formatted)
+	}
+}
+
+// heldAlerts queues two alerts for the environment destination, outside of quiet hours
+func heldAlerts(t *testing.T) []deferredAlert {
+	t.Helper()
+	saved := quietHours
+	quietHours = ""
+	t.Cleanup(func() { quietHours = saved })
+	deferredAlerts = []deferredAlert{
+		{Quake: withDerivedFields(Quake{DateTime: "01 March 2024 - 11:10:00 PM", Magnitude: "3.1", Location: "006 km S 24° W of Sagbayan (Bohol)"})},
+		{Quake: withDerivedFields(Quake{DateTime: "02 March 2024 - 01:05:00 AM", Magnitude: "2.9", Location: "017 km S 71° E of Tulunan (Cotabato)"})},
+	}
+	stateStore.SaveDeferred(deferredAlerts)
+	return deferredAlerts
+}
+
+func TestFlushDeferredAlertsKeepsUndelivered(t *testing.T) {
+	useTempState(t)
+	useNotifiers(t, fakeNotifier{fail: true})
+	held := heldAlerts(t)
+	postedQuakes := map[string]PostedQuake{}
+
+	flushDeferredAlerts(context.Background(), postedQuakes)
+	if len(deferredAlerts) != len(held) {
+		t.Fatalf("%d alerts still held after a failed summary, want %d", len(deferredAlerts), len(held))
+	}
+	if got := stateStore.LoadDeferred(); len(got) != len(held) {
+		t.Errorf("%d alerts saved after a failed summary, want %d", len(got), len(held))
+	}
+	for _, a := range held {
+		if alreadySent(a.Quake, false) {
+			t.Errorf("undelivered alert %s marked as sent", a.Quake.DateTime)
+		}
+		p := postedQuakes[quakeLocationKey(a.Quake)]
+		if p.PostedAt != nil {
+			t.Errorf("undelivered alert %s recorded as posted", a.Quake.DateTime)
+		}
+		if p.AlertRef == "" {
+			t.Errorf("undelivered alert %s lost its reference", a.Quake.DateTime)
+		}
+	}
+
+	// the retry keeps the references of the failed attempt
+	refs := map[string]string{}
+	for key, p := range postedQuakes {
+		refs[key] = p.AlertRef
+	}
+	var sent []string
+	useNotifiers(t, fakeNotifier{sent: &sent})
+	flushDeferredAlerts(context.Background(), postedQuakes)
+	if len(deferredAlerts) != 0 || len(stateStore.LoadDeferred()) != 0 {
+		t.Errorf("alerts still held after the summary was delivered: %+v", deferredAlerts)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("%d summaries posted, want 1", len(sent))
+	}
+	for _, a := range held {
+		key := quakeLocationKey(a.Quake)
+		p := postedQuakes[key]
+		if p.PostedAt == nil || !alreadySent(a.Quake, false) {
+			t.Errorf("delivered alert %s not recorded as posted", a.Quake.DateTime)
+		}
+		if p.AlertRef != refs[key] {
+			t.Errorf("reference of %s changed from %s to %s on the retry", a.Quake.DateTime, refs[key], p.AlertRef)
+		}
+		if !strings.Contains(sent[0], p.AlertRef) {
+			t.Errorf("summary misses the reference %s:\n%s", p.AlertRef, sent[0])
+		}
+	}
+}
+
+func TestFlushDeferredAlertsSharedQueue(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+	var sent []string
+	useNotifiers(t, fakeNotifier{sent: &sent})
+	stateStore = a
+	heldAlerts(t)
+
+	// both instances see the quiet hours end, only one posts the summary
+	for _, s := range []StateStore{a, b} {
+		stateStore = s
+		deferredAlerts = nil
+		flushDeferredAlerts(context.Background(), map[string]PostedQuake{})
+	}
+	if len(sent) != 1 {
+		t.Errorf("%d summaries posted by two instances sharing the queue, want 1", len(sent))
+	}
+	if held := b.LoadDeferred(); len(held) != 0 {
+		t.Errorf("%d alerts still queued after the summary", len(held))
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// prefix of every key the Redis backend uses
+	REDIS_KEY_PREFIX = "phivolcs-eq:"
+	// prefix used by dry runs, seeded from the live keys on the first open
+	REDIS_DRY_RUN_KEY_PREFIX = REDIS_KEY_PREFIX + "dryrun:"
+	// timeout of each Redis round trip
+	REDIS_TIMEOUT = 10 * time.Second
+	// how long an alert claim is held, past the Matrix retries of a slow post and the poll of the
+	// other instances, so a claim left by a crashed instance doesn't block the alert for long
+	REDIS_CLAIM_TTL = 10 * time.Minute
+)
+
+// identifies this instance in the alert claims, e.g. "host-a:1234"
+var instanceID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+// redisStateStore keeps the state in Redis so several instances can share it. The fetched quakes are
+// a hash keyed by quakeOriginKey. Each posted quake is its own key, named by quakeLocationKey and
+// expiring once it falls out of POSTED_RETENTION, so Redis does the pruning. Alerts are claimed with
+// SET NX before posting, the instance that wins the claim posts. The alerts
+// held during quiet hours are one JSON array, shared like the rest of the state.
+type redisStateStore struct {
+	client *redis.Client
+	prefix string
+
+	// keys of the posted quakes replaced in memory, deleted by the next SavePosted
+	mu      sync.Mutex
+	dropped map[string]bool
+}
+
+// openRedisStateStore connects to REDIS_URL. Dry runs work on a copy of the live keys.
+func openRedisStateStore(redisURL string) (*redisStateStore, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	s := &redisStateStore{client: redis.NewClient(opts), prefix: REDIS_KEY_PREFIX}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		s.client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", redactURLError(err))
+	}
+
+	if dryRun {
+		live := &redisStateStore{client: s.client, prefix: s.prefix}
+		s.prefix = REDIS_DRY_RUN_KEY_PREFIX
+		if !s.Exists() && live.Exists() {
+			s.SaveFetched(mapEqToSlice(live.LoadFetched()))
+			s.SavePosted(postedToSlice(live.LoadPosted()))
+			s.SaveDeferred(live.LoadDeferred())
+			s.copySequence(live)
+		}
+	} else {
+		s.importDeferredFile()
+	}
+	return s, nil
+}
+
+// importDeferredFile moves the alerts held in deferred_alerts.json by earlier versions into Redis,
+// unless the shared queue already exists
+func (s *redisStateStore) importDeferredFile() {
+	alerts := (fileStateStore{}).LoadDeferred()
+	if len(alerts) == 0 {
+		return
+	}
+	data, err := json.Marshal(alerts)
+	if err != nil {
+		log.Printf("❌ Failed to encode deferred alerts: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	if imported, err := s.client.SetNX(ctx, s.deferredKey(), string(data), 0).Result(); err != nil {
+		log.Printf("⚠️ Failed to import %s into Redis: %v", DEFERRED_ALERTS_FILE, err)
+	} else if imported {
+		log.Printf("📦 Imported %d alerts held during quiet hours from %s", len(alerts), DEFERRED_ALERTS_FILE)
+	}
+}
+
+// copySequence starts the dry-run counter from the live one
+func (s *redisStateStore) copySequence(live *redisStateStore) {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	if seq, err := s.client.Get(ctx, live.sequenceKey()).Result(); err == nil {
+		s.client.Set(ctx, s.sequenceKey(), seq, 0)
+	}
+}
+
+func (s *redisStateStore) fetchedKey() string { return s.prefix + "fetched" }
+
+func (s *redisStateStore) postedKey(key string) string { return s.prefix + "posted:" + key }
+
+func (s *redisStateStore) claimKey(hash string) string { return s.prefix + "claim:" + hash }
+
+func (s *redisStateStore) sequenceKey() string { return s.prefix + "sequence" }
+
+func (s *redisStateStore) deferredKey() string { return s.prefix + "deferred" }
+
+func (s *redisStateStore) LoadFetched() map[string]Quake {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	values, err := s.client.HGetAll(ctx, s.fetchedKey()).Result()
+	if err != nil {
+		log.Printf("⚠️ Failed to read fetched quakes from Redis, starting fresh: %v", err)
+		return map[string]Quake{}
+	}
+
+	var quakes []Quake
+	for _, data := range values {
+		var q Quake
+		if err := json.Unmarshal([]byte(data), &q); err != nil {
+			log.Printf("⚠️ Failed to parse a quake from Redis: %v", err)
+			continue
+		}
+		quakes = append(quakes, withDerivedFields(q))
+	}
+	return quakesByKey(quakes, quakeOriginKey)
+}
+
+func (s *redisStateStore) LoadPosted() map[string]PostedQuake {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	keys, err := s.postedKeys(ctx)
+	if err != nil {
+		log.Printf("⚠️ Failed to list posted quakes in Redis, starting fresh: %v", err)
+		return map[string]PostedQuake{}
+	}
+	if len(keys) == 0 {
+		return map[string]PostedQuake{}
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("⚠️ Failed to read posted quakes from Redis, starting fresh: %v", err)
+		return map[string]PostedQuake{}
+	}
+
+	var posted []PostedQuake
+	for _, v := range values {
+		// nil when the key expired between the scan and the read
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var p PostedQuake
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			log.Printf("⚠️ Failed to parse a posted quake from Redis: %v", err)
+			continue
+		}
+		posted = append(posted, withDerivedPostedFields(p))
+	}
+	return postedByKey(posted)
+}
+
+// postedKeys lists the keys of the posted quakes
+func (s *redisStateStore) postedKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	iter := s.client.Scan(ctx, 0, s.postedKey("*"), 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// SaveFetched replaces the hash of fetched quakes in one transaction
+func (s *redisStateStore) SaveFetched(quakes []Quake) {
+	values := make(map[string]any, len(quakes))
+	for _, q := range quakes {
+		data, err := json.Marshal(q)
+		if err != nil {
+			log.Printf("❌ Failed to encode quake: %v", err)
+			return
+		}
+		values[quakeOriginKey(q)] = string(data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.fetchedKey())
+		if len(values) > 0 {
+			pipe.HSet(ctx, s.fetchedKey(), values)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to save fetched quakes to Redis: %v", err)
+	}
+}
+
+// SavePosted writes every posted quake within POSTED_RETENTION with its expiry and deletes the records
+// passed to ForgetPosted since the last save. Other records missing from posted are left alone,
+// another instance may have just added them; they expire on their own.
+func (s *redisStateStore) SavePosted(posted []PostedQuake) {
+	now := time.Now()
+	kept := prunePostedQuakes(posted, postedRetention, now)
+	s.mu.Lock()
+	dropped := s.dropped
+	s.dropped = nil
+	s.mu.Unlock()
+	for _, p := range kept {
+		delete(dropped, quakeLocationKey(p.Quake))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key := range dropped {
+			pipe.Del(ctx, s.postedKey(key))
+		}
+		for _, p := range kept {
+			data, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			// quakes without a parseable datetime are never pruned, same as with the other backends
+			var ttl time.Duration
+			if !p.OccurredAt.IsZero() {
+				// the pruning above leaves at least the quake exactly at the edge
+				ttl = p.OccurredAt.Add(postedRetention).Sub(now)
+				if ttl < time.Second {
+					ttl = time.Second
+				}
+			}
+			pipe.Set(ctx, s.postedKey(quakeLocationKey(p.Quake)), string(data), ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to save posted quakes to Redis: %v", err)
+		// retried with the next save
+		s.mu.Lock()
+		for key := range dropped {
+			s.forget(key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// ForgetPosted queues the record of a replaced posted quake for deletion by the next SavePosted, in
+// the same transaction as its replacement
+func (s *redisStateStore) ForgetPosted(key string) {
+	s.mu.Lock()
+	s.forget(key)
+	s.mu.Unlock()
+}
+
+// forget adds a key to the deletions of the next save, s.mu must be held
+func (s *redisStateStore) forget(key string) {
+	if s.dropped == nil {
+		s.dropped = map[string]bool{}
+	}
+	s.dropped[key] = true
+}
+
+func (s *redisStateStore) LoadDeferred() []deferredAlert {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	data, err := s.client.Get(ctx, s.deferredKey()).Result()
+	if err == redis.Nil {
+		return nil
+	} else if err != nil {
+		log.Printf("⚠️ Failed to read deferred alerts from Redis: %v", err)
+		return nil
+	}
+	alerts, err := parseDeferredAlerts([]byte(data))
+	if err != nil {
+		log.Printf("⚠️ Failed to parse deferred alerts from Redis: %v", err)
+		return nil
+	}
+	return alerts
+}
+
+func (s *redisStateStore) SaveDeferred(alerts []deferredAlert) {
+	data, err := json.Marshal(alerts)
+	if err != nil {
+		log.Printf("❌ Failed to encode deferred alerts: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	if err := s.client.Set(ctx, s.deferredKey(), string(data), 0).Err(); err != nil {
+		log.Printf("❌ Failed to save deferred alerts to Redis: %v", err)
+	}
+}
+
+// Claim atomically takes the right to post the alert with the given hash, held for REDIS_CLAIM_TTL
+func (s *redisStateStore) Claim(hash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	return s.client.SetNX(ctx, s.claimKey(hash), instanceID, REDIS_CLAIM_TTL).Result()
+}
+
+// releaseClaimScript deletes a claim only when this instance still holds it
+var releaseClaimScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Release drops the claim of this instance on an alert that failed to post
+func (s *redisStateStore) Release(hash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	return releaseClaimScript.Run(ctx, s.client, []string{s.claimKey(hash)}, instanceID).Err()
+}
+
+// NextSequence increments the shared counter, so instances sharing the state never reuse a number
+func (s *redisStateStore) NextSequence() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	return s.client.Incr(ctx, s.sequenceKey()).Result()
+}
+
+func (s *redisStateStore) Exists() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), REDIS_TIMEOUT)
+	defer cancel()
+	n, err := s.client.Exists(ctx, s.fetchedKey()).Result()
+	if err != nil {
+		log.Printf("⚠️ Failed to query Redis: %v", err)
+		return false
+	}
+	if n > 0 {
+		return true
+	}
+	// a single SCAN call may come back empty even when keys match, iterate until the first one
+	return s.client.Scan(ctx, 0, s.postedKey("*"), 500).Iterator().Next(ctx)
+}
+
+func (s *redisStateStore) Close() error {
+	return s.client.Close()
+}
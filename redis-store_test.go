@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// useRedis starts an in-memory Redis server and opens a store on it
+func useRedis(t *testing.T) (*miniredis.Miniredis, *redisStateStore) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return mr, openTestRedis(t, mr)
+}
+
+// openTestRedis opens another store on a server, like a second instance sharing the state
+func openTestRedis(t *testing.T, mr *miniredis.Miniredis) *redisStateStore {
+	t.Helper()
+	s, err := openRedisStateStore("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("openRedisStateStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRedisClaimExpires(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+
+	if ok, err := a.Claim("h1"); err != nil || !ok {
+		t.Fatalf("first Claim = %v, %v, want true", ok, err)
+	}
+	if ok, err := b.Claim("h1"); err != nil || ok {
+		t.Fatalf("Claim by another instance = %v, %v, want false", ok, err)
+	}
+	if ttl := mr.TTL(a.claimKey("h1")); ttl != REDIS_CLAIM_TTL {
+		t.Errorf("claim TTL = %s, want %s", ttl, REDIS_CLAIM_TTL)
+	}
+	// a claim left by a crashed instance frees the alert on its own
+	mr.FastForward(REDIS_CLAIM_TTL + time.Second)
+	if ok, err := b.Claim("h1"); err != nil || !ok {
+		t.Errorf("Claim after the TTL = %v, %v, want true", ok, err)
+	}
+}
+
+func TestRedisReleaseClaim(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+
+	if ok, _ := a.Claim("h1"); !ok {
+		t.Fatal("Claim failed")
+	}
+	if err := a.Release("h1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if ok, _ := b.Claim("h1"); !ok {
+		t.Fatal("released alert could not be claimed again")
+	}
+	// only the holder releases a claim
+	mr.Set(a.claimKey("h1"), "other-host:1")
+	if err := a.Release("h1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if !mr.Exists(a.claimKey("h1")) {
+		t.Error("claim of another instance released")
+	}
+}
+
+func TestRedisSavePostedForget(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+
+	first := recentPosted("006 km S 24° W of Sagbayan (Bohol)", time.Hour)
+	other := recentPosted("017 km S 71° E of Tulunan (Cotabato)", 2*time.Hour)
+	a.SavePosted([]PostedQuake{first, other})
+
+	// another instance adds a record the first one never loaded, it must survive the next save
+	peer := recentPosted("012 km N 45° W of Talisay City (Cebu)", 30*time.Minute)
+	b.SavePosted([]PostedQuake{peer})
+
+	// a silent revision moved the location, the old record is replaced
+	revised := first
+	revised.Location = "008 km S 20° W of Sagbayan (Bohol)"
+	a.ForgetPosted(quakeLocationKey(first.Quake))
+	a.SavePosted([]PostedQuake{revised, other})
+
+	posted := b.LoadPosted()
+	if _, ok := posted[quakeLocationKey(first.Quake)]; ok {
+		t.Error("forgotten record came back on the next load")
+	}
+	for _, p := range []PostedQuake{revised, other, peer} {
+		if _, ok := posted[quakeLocationKey(p.Quake)]; !ok {
+			t.Errorf("record of %s missing after the save", p.Location)
+		}
+	}
+
+	// a forgotten key saved again is kept
+	a.ForgetPosted(quakeLocationKey(other.Quake))
+	a.SavePosted([]PostedQuake{revised, other})
+	if _, ok := a.LoadPosted()[quakeLocationKey(other.Quake)]; !ok {
+		t.Error("record forgotten and saved again in the same save was deleted")
+	}
+}
+
+func TestRedisSavePostedExpiry(t *testing.T) {
+	useTempState(t)
+	mr, s := useRedis(t)
+	p := recentPosted("006 km S 24° W of Sagbayan (Bohol)", time.Hour)
+	s.SavePosted([]PostedQuake{p})
+
+	ttl := mr.TTL(s.postedKey(quakeLocationKey(p.Quake)))
+	want := p.OccurredAt.Add(postedRetention).Sub(time.Now())
+	if diff := want - ttl; diff < -time.Minute || diff > time.Minute {
+		t.Errorf("posted record TTL = %s, want about %s", ttl, want)
+	}
+	mr.FastForward(want + time.Second)
+	if len(s.LoadPosted()) != 0 {
+		t.Error("record kept past POSTED_RETENTION")
+	}
+}
+
+func TestRedisSequenceShared(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+	for i, s := range []*redisStateStore{a, b, a} {
+		if seq, err := s.NextSequence(); err != nil || seq != int64(i+1) {
+			t.Errorf("NextSequence = %d, %v, want %d", seq, err, i+1)
+		}
+	}
+}
+
+func TestPostAlertSharedClaim(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+	var sent []string
+	useNotifiers(t, fakeNotifier{sent: &sent})
+	q := testQuake()
+
+	stateStore = a
+	if _, err := postAlert(context.Background(), q, false, q, PostedQuake{}); err != nil {
+		t.Fatalf("postAlert by the first instance: %v", err)
+	}
+	stateStore = b
+	postedHashes = map[string]time.Time{}
+	if _, err := postAlert(context.Background(), q, false, q, PostedQuake{}); !errors.Is(err, ErrAlertClaimed) {
+		t.Fatalf("postAlert by the second instance = %v, want ErrAlertClaimed", err)
+	}
+	if len(sent) != 1 {
+		t.Errorf("alert posted %d times by two instances, want 1", len(sent))
+	}
+}
+
+func TestPostAlertReleasesClaimOnFailure(t *testing.T) {
+	useTempState(t)
+	mr, a := useRedis(t)
+	b := openTestRedis(t, mr)
+	useNotifiers(t, fakeNotifier{fail: true})
+	q := testQuake()
+
+	stateStore = a
+	if _, err := postAlert(context.Background(), q, false, q, PostedQuake{}); err == nil {
+		t.Fatal("postAlert succeeded with a failing notifier")
+	}
+	if ok, _ := b.Claim(alertHash(q, false)); !ok {
+		t.Error("claim kept after the alert failed to post")
+	}
+}
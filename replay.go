@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runReplay runs the quake snapshots of REPLAY_FILE, a JSON array with one array of quakes per
+// poll, through processQuakes in order and prints what would be posted. The state starts empty
+// and is only kept in memory; nothing is fetched, enriched or posted.
+func runReplay(out io.Writer, fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	var snapshots [][]Quake
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return fmt.Errorf("failed to parse %s (expected an array of quake arrays): %w", fileName, err)
+	}
+
+	lastFetch := map[string]Quake{}
+	posted := map[string]PostedQuake{}
+	var newCount, updateCount int
+	for i, snapshot := range snapshots {
+		for j := range snapshot {
+			snapshot[j] = withDerivedFields(snapshot[j])
+		}
+		fmt.Fprintf(out, "▶️ Snapshot %d/%d: %d quakes\n", i+1, len(snapshots), len(snapshot))
+
+		// like a fresh deploy, the first poll only seeds the state unless BACKFILL is set
+		if i == 0 && !backfillOnFirstRun {
+			for _, p := range postedQuakesOf(snapshot) {
+				posted[quakeLocationKey(p.Quake)] = p
+			}
+			lastFetch = quakesByKey(snapshot, quakeOriginKey)
+			fmt.Fprintln(out, "🌱 Seeded the state without posting (set BACKFILL=true to check it as new quakes)")
+			continue
+		}
+
+		carryOverBulletinDetails(snapshot, lastFetch)
+		changed, updated := processQuakes(snapshot, lastFetch, posted)
+		if len(changed) == 0 && len(updated) == 0 {
+			fmt.Fprintln(out, "No new or updated earthquakes detected.")
+		}
+		var toSave []PostedQuake
+		for k := len(changed) - 1; k >= 0; k-- {
+			q := changed[k]
+			printReplayAlert(out, "🆕 Would post new quake", q, false, q)
+			toSave = append(toSave, newPostedQuake(q))
+			newCount++
+		}
+		for k := len(updated) - 1; k >= 0; k-- {
+			u := updated[k]
+			original := findPostedOriginal(posted, u.Old)
+			if u.Silent {
+				fmt.Fprintf(out, "🔇 Would not post the update of %s | M%s → M%s, the record follows it\n",
+					u.New.DateTime, u.Old.Magnitude, u.New.Magnitude)
+				delete(posted, quakeLocationKey(original.Quake))
+				toSave = append(toSave, silentRevision(original, u.New))
+				continue
+			}
+			printReplayAlert(out, "🔁 Would post update", u.New, true, u.Old)
+			if original.Announced != nil {
+				delete(posted, quakeLocationKey(original.Quake))
+			}
+			toSave = append(toSave, newPostedQuake(u.New))
+			updateCount++
+		}
+		for _, p := range toSave {
+			posted[quakeLocationKey(p.Quake)] = p
+		}
+		lastFetch = quakesByKey(snapshot, quakeOriginKey)
+	}
+	fmt.Fprintf(out, "🏁 Replayed %d snapshots: %d new quakes and %d updates would be posted\n", len(snapshots), newCount, updateCount)
+	return nil
+}
+
+// printReplayAlert prints the plain text alert of a quake, followed by the verdict of each
+// CONFIG_FILE destination at the time the quake occurred
+func printReplayAlert(out io.Writer, title string, q Quake, updated bool, old Quake) {
+	msg, _ := formatMatrixMsg(updated, old, q, "")
+	fmt.Fprintf(out, "%s: %s | M%s | %s\n", title, q.DateTime, q.Magnitude, q.Location)
+	fmt.Fprintln(out, "    "+strings.ReplaceAll(msg, "\n", "\n    "))
+	if configFile == "" {
+		return
+	}
+	at := q.OccurredAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	for _, d := range destinations {
+		switch verdict, reason := d.evaluate(q, updated, old, at); verdict {
+		case VERDICT_POST:
+			fmt.Fprintf(out, "    → %s: post\n", d.name)
+		case VERDICT_HOLD:
+			fmt.Fprintf(out, "    → %s: hold (%s)\n", d.name, reason)
+		default:
+			fmt.Fprintf(out, "    → %s: skip (%s)\n", d.name, reason)
+		}
+	}
+}
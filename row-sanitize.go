@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// anything that can't be part of a decimal number, e.g. "°", "km", stray spaces in "4 .5"
+var numericJunkRe = regexp.MustCompile(`[^0-9.\-]`)
+
+// cleanNumericCell strips degree symbols, units, whitespace and other junk from a table cell
+// and parses what remains. Dash placeholders such as "—" leave nothing to parse.
+func cleanNumericCell(raw string) (string, float64, bool) {
+	cleaned := numericJunkRe.ReplaceAllString(raw, "")
+	if cleaned == "" || cleaned == "-" {
+		return "", 0, false
+	}
+	v, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return cleaned, 0, false
+	}
+	return cleaned, v, true
+}
+
+// parseCoord parses a latitude or longitude, ignoring surrounding whitespace and a degree symbol
+// as in "10.30°". Anything else, including NaN and infinities, fails.
+func parseCoord(s string) (float64, bool) {
+	s = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), "°º"))
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// normalizeDepth returns the canonical depth in km without unit, e.g. "10" for " 10 km" or "010.0".
+// Values that can't be parsed are only trimmed.
+func normalizeDepth(raw string) string {
+	_, v, ok := cleanNumericCell(raw)
+	if !ok || v < 0 {
+		return strings.TrimSpace(raw)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatDepth renders a depth for messages, e.g. "10 km", or "unknown" for placeholders such as "—"
+func formatDepth(depth string) string {
+	depth = normalizeDepth(depth)
+	if _, err := strconv.ParseFloat(depth, 64); err != nil {
+		return "unknown"
+	}
+	return depth + " km"
+}
+
+// setMagnitudeValue parses Magnitude into MagnitudeValue, flagging unparseable values with MagnitudeOK
+func setMagnitudeValue(q *Quake) {
+	v, err := strconv.ParseFloat(q.Magnitude, 64)
+	q.MagnitudeValue, q.MagnitudeOK = v, err == nil
+}
+
+// sanitizeQuakeRow cleans up the numeric fields of a freshly parsed row in place and validates
+// their ranges. Problems are recorded as parse warnings with the raw cell text; a row with
+// unusable coordinates or magnitude is flagged ineligible for posting but still cached.
+func sanitizeQuakeRow(q *Quake) {
+	warn := func(format string, args ...any) {
+		q.ParseWarnings = append(q.ParseWarnings, fmt.Sprintf(format, args...))
+	}
+
+	if lat, v, ok := cleanNumericCell(q.Latitude); !ok || v < -90 || v > 90 {
+		warn("invalid latitude %q", q.Latitude)
+		q.Ineligible = true
+	} else {
+		q.Latitude = normalizeCoord(lat)
+	}
+
+	if lon, v, ok := cleanNumericCell(q.Longitude); !ok || v < -180 || v > 360 {
+		warn("invalid longitude %q", q.Longitude)
+		q.Ineligible = true
+	} else if v > 180 {
+		// 0..360 notation, adjust to -180..180
+		q.Longitude = normalizeCoord(strconv.FormatFloat(v-360, 'f', -1, 64))
+		warn("adjusted longitude %q to %s", lon, q.Longitude)
+	} else {
+		q.Longitude = normalizeCoord(lon)
+	}
+
+	if mag, v, ok := cleanNumericCell(q.Magnitude); !ok || v < 0 || v > 10 {
+		warn("invalid magnitude %q", q.Magnitude)
+		q.Ineligible = true
+	} else {
+		q.Magnitude = mag
+		q.MagnitudeValue, q.MagnitudeOK = v, true
+	}
+
+	// an unknown depth doesn't make the quake any less real, only note it
+	if _, v, ok := cleanNumericCell(q.Depth); !ok || v < 0 {
+		warn("invalid depth %q", q.Depth)
+	}
+	q.Depth = normalizeDepth(q.Depth)
+
+	if q.Bulletin == "" {
+		warn("missing bulletin link")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFirstNMalformedRows(t *testing.T) {
+	quakes, err := parseFirstN(loadTestPage(t, "testdata/phivolcs-malformed-rows.html"), 10)
+	if err != nil {
+		t.Fatalf("parseFirstN: %v", err)
+	}
+	// every row is kept so it doesn't look new on the next poll
+	if len(quakes) != 5 {
+		t.Fatalf("parsed %d quakes, want 5", len(quakes))
+	}
+	tests := []struct {
+		lat, lon, depth, mag string
+		ineligible           bool
+		warnings             []string
+	}{
+		{"10.30", "123.90", "—", "4.5", false, []string{`invalid depth "—"`}},
+		{"12.40", "-123.50", "10", "2.1", false, []string{`adjusted longitude "236.50" to -123.50`}},
+		{"95.00", "125.00", "33", "3.3", true, []string{`invalid latitude "95.00"`, "missing bulletin link"}},
+		{"9.12", "126.20", "15", "—", true, []string{`invalid magnitude "—"`}},
+		{"11.00", "124.50", "5", "11.2", true, []string{`invalid magnitude "11.2"`}},
+	}
+	for i, tt := range tests {
+		q := quakes[i]
+		if q.Latitude != tt.lat || q.Longitude != tt.lon || q.Depth != tt.depth || q.Magnitude != tt.mag {
+			t.Errorf("row %d: %s, %s, depth %s, M%s, want %s, %s, depth %s, M%s",
+				i, q.Latitude, q.Longitude, q.Depth, q.Magnitude, tt.lat, tt.lon, tt.depth, tt.mag)
+		}
+		if q.Ineligible != tt.ineligible {
+			t.Errorf("row %d: ineligible = %v, want %v", i, q.Ineligible, tt.ineligible)
+		}
+		warnings := strings.Join(q.ParseWarnings, "; ")
+		for _, w := range tt.warnings {
+			if !strings.Contains(warnings, w) {
+				t.Errorf("row %d: warnings %q miss %q", i, warnings, w)
+			}
+		}
+	}
+}
+
+func TestCleanNumericCell(t *testing.T) {
+	tests := []struct {
+		raw     string
+		cleaned string
+		value   float64
+		ok      bool
+	}{
+		{"10.30°", "10.30", 10.3, true},
+		{" 4 .5 ", "4.5", 4.5, true},
+		{"10 km", "10", 10, true},
+		{"—", "", 0, false},
+		{"-", "", 0, false},
+		{"1.2.3", "1.2.3", 0, false},
+	}
+	for _, tt := range tests {
+		cleaned, v, ok := cleanNumericCell(tt.raw)
+		if cleaned != tt.cleaned || v != tt.value || ok != tt.ok {
+			t.Errorf("cleanNumericCell(%q) = %q, %v, %v, want %q, %v, %v", tt.raw, cleaned, v, ok, tt.cleaned, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeDepth(t *testing.T) {
+	tests := []struct {
+		raw, depth, formatted string
+	}{
+		{"10", "10", "10 km"},
+		{" 10 ", "10", "10 km"},
+		{"10 km", "10", "10 km"},
+		{"010", "10", "10 km"},
+		{"10.0", "10", "10 km"},
+		{"2.5", "2.5", "2.5 km"},
+		{"—", "—", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := normalizeDepth(tt.raw); got != tt.depth {
+			t.Errorf("normalizeDepth(%q) = %q, want %q", tt.raw, got, tt.depth)
+		}
+		if got := formatDepth(tt.raw); got != tt.formatted {
+			t.Errorf("formatDepth(%q) = %q, want %q", tt.raw, got, tt.formatted)
+		}
+	}
+	if depthChanged(Quake{Depth: " 10 "}, Quake{Depth: "10 km"}) {
+		t.Error("equivalent depths counted as a change")
+	}
+	if !depthChanged(Quake{Depth: "10"}, Quake{Depth: "12"}) {
+		t.Error("a deeper revision not counted as a change")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// handleRSS serves the posted quake history as an RSS 2.0 feed
+func handleRSS(w http.ResponseWriter, r *http.Request) {
+	postedQuakes := stateStore.LoadPosted()
+	// newest first, the store already dropped quakes older than POSTED_RETENTION
+	feed := buildRSSFeed(quakesOfPosted(postedQuakes))
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		log.Printf("❌ Failed to build RSS feed: %v", err)
+		http.Error(w, "failed to build feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// buildRSSFeed converts quakes to RSS items, each linking to its PHIVOLCS bulletin
+func buildRSSFeed(quakes []Quake) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         "PHIVOLCS Earthquake Alerts",
+			Link:          PHIVOLCS_BASE_URL,
+			Description:   "Recent earthquakes reported by PHIVOLCS",
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, q := range quakes {
+		_, formatted := formatMatrixMsg(false, q, q, "")
+		item := rssItem{
+			Title:       fmt.Sprintf("M%.1f - %s", q.MagnitudeValue, q.Location),
+			Link:        q.Bulletin,
+			Description: formatted,
+			GUID:        rssGUID{Value: quakeLocationKey(q)},
+		}
+		if q.Bulletin != "" {
+			item.GUID = rssGUID{IsPermaLink: true, Value: q.Bulletin}
+		}
+		if !q.OccurredAt.IsZero() {
+			item.PubDate = q.OccurredAt.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
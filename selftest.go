@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// prefix of self-test messages so nobody mistakes them for real alerts
+const SELFTEST_PREFIX = "🧪 TEST — "
+
+// runSelfTest checks the full path from PHIVOLCS to the notifiers after a deployment: it validates
+// the configuration and Matrix credentials, fetches and parses the PHIVOLCS page and posts a synthetic
+// alert. Nothing is written to the state files. Returns the process exit code.
+func runSelfTest(ctx context.Context) int {
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"configuration", validateConfig},
+		{"matrix credentials", validateMatrixCredentials},
+		{"fetch PHIVOLCS", func() error {
+			// empty validators, a 304 would tell nothing about parsing
+			quakes, source, err := fetchLatestQuakes(ctx, maxQuakeEntries, &pageValidators{})
+			if err != nil {
+				return err
+			}
+			log.Printf("🧪 Parsed %d quakes from %s", len(quakes), source)
+			return nil
+		}},
+		{"post test alert", func() error {
+			notifiers = allNotifiers()
+			msg, formatted := formatMatrixMsg(false, Quake{}, selfTestQuake(), "")
+			return notifyAll(SELFTEST_PREFIX+msg, SELFTEST_PREFIX+formatted)
+		}},
+	}
+
+	for i, step := range steps {
+		if err := step.run(); err != nil {
+			log.Printf("❌ Self-test failed at step %d/%d (%s): %v", i+1, len(steps), step.name, err)
+			return EXIT_SELFTEST_FAILED
+		}
+		log.Printf("✅ Self-test step %d/%d (%s) passed", i+1, len(steps), step.name)
+	}
+	log.Println("✅ Self-test passed")
+	return EXIT_OK
+}
+
+// runTestAlert posts one synthetic alert to every notifier and reports for each whether it got
+// through, a quick check of tokens and room IDs. Nothing is fetched or stored. Returns the process
+// exit code.
+func runTestAlert() int {
+	notifiers = allNotifiers()
+
+	q := selfTestQuake()
+	q.Location, q.Origin = "This is a test alert, not a real earthquake", "Test alert"
+	msg, formatted := formatMatrixMsg(false, Quake{}, q, "")
+	failed := 0
+	for _, n := range notifiers {
+		if err := n.Notify(SELFTEST_PREFIX+msg, SELFTEST_PREFIX+formatted); err != nil {
+			log.Printf("❌ Test alert to %s failed: %v", n, err)
+			failed++
+			continue
+		}
+		log.Printf("✅ Test alert sent to %s", n)
+	}
+	if failed > 0 {
+		log.Printf("❌ %d of %d notifiers failed the test alert", failed, len(notifiers))
+		return EXIT_SELFTEST_FAILED
+	}
+	return EXIT_OK
+}
+
+// selfTestQuake is a synthetic quake at the reference point, never stored in the posted quakes
+func selfTestQuake() Quake {
+	now := time.Now().In(manilaLoc)
+	q := Quake{
+		DateTime:   now.Format(DATE_TIME_LAYOUT),
+		OccurredAt: now,
+		Latitude:   fmt.Sprintf("%.2f", refPointLat),
+		Longitude:  fmt.Sprintf("%.2f", refPointLon),
+		Depth:      "10",
+		Magnitude:  "4.5",
+		Location:   "Self-test, not a real earthquake",
+		Origin:     "Self-test",
+		Bulletin:   PHIVOLCS_BASE_URL,
+	}
+	setMagnitudeValue(&q)
+	return q
+}
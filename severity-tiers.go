@@ -0,0 +1,36 @@
+package main
+
+// severityTier styles a new-quake alert by magnitude so strong quakes stand out in a busy room
+type severityTier struct {
+	emoji string
+	// catalog ID of the headline, spelled out so the plain-text body doesn't rely on the emoji color
+	headlineID string
+	// strong quakes get a heading instead of bold text in the HTML body
+	heading bool
+}
+
+var (
+	tierLight    = severityTier{emoji: "🟢", headlineID: "alert.light"}
+	tierModerate = severityTier{emoji: "🟠", headlineID: "alert.moderate"}
+	tierStrong   = severityTier{emoji: "🔴", headlineID: "alert.strong", heading: true}
+)
+
+// severityFor picks the tier of a quake from SEVERITY_MODERATE_MAG and SEVERITY_STRONG_MAG
+func severityFor(q Quake) severityTier {
+	switch {
+	case q.MagnitudeValue >= severityStrongMag:
+		return tierStrong
+	case q.MagnitudeValue >= severityModerateMag:
+		return tierModerate
+	}
+	return tierLight
+}
+
+// headlines returns the plain and HTML headline of a new-quake alert in a language
+func (t severityTier) headlines(lang string) (string, string) {
+	title := tr(lang, t.headlineID)
+	if t.heading {
+		return t.emoji + " " + title, "<h3>" + t.emoji + " " + title + "</h3>"
+	}
+	return t.emoji + " " + title, t.emoji + " <b>" + title + "</b><br><br>"
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// exitAfterDrainTimeout gives the current cycle SHUTDOWN_TIMEOUT to finish its posts and state writes
+// once ctx is cancelled by a signal, and force-exits if it takes longer
+func exitAfterDrainTimeout(ctx context.Context) {
+	<-ctx.Done()
+	log.Printf("🛑 Shutdown requested, finishing the current cycle (up to %s)...", shutdownTimeout)
+	time.Sleep(shutdownTimeout)
+	log.Printf("❌ Shutdown did not finish within %s, exiting", shutdownTimeout)
+	os.Exit(1)
+}
+
+// shutdownAPIServer stops the API server, waiting briefly for in-flight requests
+func shutdownAPIServer(srv *http.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ API server shutdown error: %v", err)
+	}
+}
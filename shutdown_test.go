@@ -0,0 +1,67 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalDuringFetch(t *testing.T) {
+	useTempState(t)
+	useScrapeTLS(t, "", false)
+	srv := hungServer(t)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := fetchDocument(ctx, srv.URL)
+		fetched <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-fetched:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("fetch ended with %v, want it cancelled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fetch still running 2s after SIGTERM")
+	}
+
+	// the sleep between polls doesn't hold up the exit
+	start := time.Now()
+	sleepBeforeNextPoll(ctx, time.Hour)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleep before the next poll took %s after SIGTERM", elapsed)
+	}
+
+	// the state written on the way out is complete
+	p := recentPosted("006 km S 24° W of Sagbayan (Bohol)", time.Minute)
+	stateStore.SaveFetched([]Quake{p.Quake})
+	stateStore.SavePosted([]PostedQuake{p})
+	for _, name := range []string{CACHE_FILE, POST_QUAKE_FILE} {
+		data, err := os.ReadFile(statePath(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil || len(entries) != 1 {
+			t.Errorf("%s holds %d entries after the shutdown, parse error %v", name, len(entries), err)
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(stateDir, "*.tmp-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS fetched_quakes (
+	key  TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS posted_quakes (
+	key  TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS deferred_alerts (
+	pos  INTEGER PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+// sqliteStateStore keeps the state in a SQLite database. Quakes are stored as JSON documents
+// keyed like the maps of the file backend, saves write the new and changed rows and delete the
+// ones not in the saved set by key, so unchanged rows are left alone.
+type sqliteStateStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStateStore opens (or creates) the database, importing the JSON state files once.
+// Dry runs work on a copy of the live database.
+func openSQLiteStateStore(fileName string) (*sqliteStateStore, error) {
+	if live := liveStatePath(STATE_DB_FILE); dryRun && fileName != live {
+		if err := copyIfMissing(live, fileName); err != nil {
+			return nil, fmt.Errorf("failed to copy %s for the dry run: %w", live, err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", fileName+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// one connection serializes the writers, the RSS endpoint reads rarely
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	s := &sqliteStateStore{db: db}
+	if err := s.dropGenerationColumns(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := s.migrateOnce("json_migrated", s.importJSONFiles); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to import JSON state files: %w", err)
+	}
+	// held alerts were kept in their own file by earlier versions, whatever the backend
+	if err := s.migrateOnce("deferred_migrated", s.importDeferredFile); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to import %s: %w", DEFERRED_ALERTS_FILE, err)
+	}
+	return s, nil
+}
+
+// dropGenerationColumns removes the generation and lookup columns of databases created by earlier
+// versions, which rewrote every row on each save and indexed columns nothing queried
+func (s *sqliteStateStore) dropGenerationColumns() error {
+	if _, err := s.db.Exec(`DROP INDEX IF EXISTS posted_quakes_bulletin;
+		DROP INDEX IF EXISTS posted_quakes_occurred_at`); err != nil {
+		return err
+	}
+	for _, c := range []struct{ table, column string }{
+		{"fetched_quakes", "gen"}, {"posted_quakes", "gen"}, {"posted_quakes", "occurred_at"}, {"posted_quakes", "bulletin"},
+	} {
+		var exists bool
+		if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, c.table, c.column).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := s.db.Exec(`ALTER TABLE ` + c.table + ` DROP COLUMN ` + c.column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateOnce runs an import the first time the database is opened, recording it under key in meta
+func (s *sqliteStateStore) migrateOnce(key string, migrate func() error) error {
+	var done string
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&done)
+	if err == nil {
+		return nil
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	if err := migrate(); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO meta (key, value) VALUES (?, datetime('now'))`, key)
+	return err
+}
+
+// importJSONFiles imports last_quakes.json and posted_quakes.json, the files are left in place
+// so switching back to the file backend keeps working
+func (s *sqliteStateStore) importJSONFiles() error {
+	fetched := (fileStateStore{}).LoadFetched()
+	posted := (fileStateStore{}).LoadPosted()
+	if err := s.replace("fetched_quakes", fetchedRows(mapEqToSlice(fetched))); err != nil {
+		return err
+	}
+	if err := s.replace("posted_quakes", postedRows(prunePostedQuakes(postedToSlice(posted), postedRetention, time.Now()))); err != nil {
+		return err
+	}
+	if len(fetched)+len(posted) > 0 {
+		log.Printf("📦 Imported %d fetched and %d posted quakes from the JSON state files", len(fetched), len(posted))
+	}
+	return nil
+}
+
+// importDeferredFile imports the alerts held in deferred_alerts.json
+func (s *sqliteStateStore) importDeferredFile() error {
+	alerts := (fileStateStore{}).LoadDeferred()
+	if len(alerts) == 0 {
+		return nil
+	}
+	log.Printf("📦 Imported %d alerts held during quiet hours from %s", len(alerts), DEFERRED_ALERTS_FILE)
+	return s.replaceDeferred(alerts)
+}
+
+func (s *sqliteStateStore) LoadFetched() map[string]Quake {
+	var quakes []Quake
+	s.load(`SELECT data FROM fetched_quakes`, func(data []byte) error {
+		var q Quake
+		if err := json.Unmarshal(data, &q); err != nil {
+			return err
+		}
+		quakes = append(quakes, withDerivedFields(q))
+		return nil
+	})
+	return quakesByKey(quakes, quakeOriginKey)
+}
+
+func (s *sqliteStateStore) LoadPosted() map[string]PostedQuake {
+	var posted []PostedQuake
+	s.load(`SELECT data FROM posted_quakes`, func(data []byte) error {
+		var p PostedQuake
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		posted = append(posted, withDerivedPostedFields(p))
+		return nil
+	})
+	return postedByKey(posted)
+}
+
+func (s *sqliteStateStore) SaveFetched(quakes []Quake) {
+	if err := s.replace("fetched_quakes", fetchedRows(quakes)); err != nil {
+		log.Printf("❌ Failed to save fetched quakes to the database: %v", err)
+	}
+}
+
+func (s *sqliteStateStore) SavePosted(posted []PostedQuake) {
+	if err := s.replace("posted_quakes", postedRows(prunePostedQuakes(posted, postedRetention, time.Now()))); err != nil {
+		log.Printf("❌ Failed to save posted quakes to the database: %v", err)
+	}
+}
+
+func (s *sqliteStateStore) LoadDeferred() []deferredAlert {
+	var alerts []deferredAlert
+	s.load(`SELECT data FROM deferred_alerts ORDER BY pos`, func(data []byte) error {
+		var a deferredAlert
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		alerts = append(alerts, withDerivedAlertFields(a))
+		return nil
+	})
+	return alerts
+}
+
+func (s *sqliteStateStore) SaveDeferred(alerts []deferredAlert) {
+	if err := s.replaceDeferred(alerts); err != nil {
+		log.Printf("❌ Failed to save deferred alerts to the database: %v", err)
+	}
+}
+
+// replaceDeferred makes the table hold exactly the given alerts, in order. The queue is short
+// and only changes during quiet hours, so it is rewritten as a whole.
+func (s *sqliteStateStore) replaceDeferred(alerts []deferredAlert) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM deferred_alerts`); err != nil {
+		return err
+	}
+	for i, a := range alerts {
+		data, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO deferred_alerts (pos, data) VALUES (?, ?)`, i, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStateStore) ForgetPosted(string) {}
+
+func (s *sqliteStateStore) Claim(string) (bool, error) { return true, nil }
+
+func (s *sqliteStateStore) Release(string) error { return nil }
+
+func (s *sqliteStateStore) NextSequence() (int64, error) {
+	var seq int64
+	err := s.db.QueryRow(`INSERT INTO meta (key, value) VALUES ('alert_sequence', '1')
+		ON CONFLICT (key) DO UPDATE SET value = CAST(value AS INTEGER) + 1
+		RETURNING CAST(value AS INTEGER)`).Scan(&seq)
+	return seq, err
+}
+
+func (s *sqliteStateStore) Exists() bool {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM fetched_quakes) OR EXISTS (SELECT 1 FROM posted_quakes)`).Scan(&exists)
+	if err != nil {
+		log.Printf("⚠️ Failed to query the database: %v", err)
+	}
+	return exists
+}
+
+func (s *sqliteStateStore) Close() error {
+	return s.db.Close()
+}
+
+// load passes the data column of each row to parse, skipping rows that fail
+func (s *sqliteStateStore) load(query string, parse func(data []byte) error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		log.Printf("⚠️ Failed to query the database, starting fresh: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			log.Printf("⚠️ Failed to read a quake row: %v", err)
+			continue
+		}
+		if err := parse([]byte(data)); err != nil {
+			log.Printf("⚠️ Failed to parse a quake row: %v", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("⚠️ Failed to read the database: %v", err)
+	}
+}
+
+// sqliteRow is a record to store: its key and the value stored as JSON
+type sqliteRow struct {
+	key   string
+	value any
+}
+
+func fetchedRows(quakes []Quake) []sqliteRow {
+	rows := make([]sqliteRow, 0, len(quakes))
+	for _, q := range quakes {
+		rows = append(rows, sqliteRow{key: quakeOriginKey(q), value: q})
+	}
+	return rows
+}
+
+func postedRows(posted []PostedQuake) []sqliteRow {
+	rows := make([]sqliteRow, 0, len(posted))
+	for _, p := range posted {
+		rows = append(rows, sqliteRow{key: quakeLocationKey(p.Quake), value: p})
+	}
+	return rows
+}
+
+// replace makes the table hold exactly the given rows in one transaction: new and changed rows
+// are upserted, unchanged ones skipped and the ones missing from rows deleted by key
+func (s *sqliteStateStore) replace(table string, rows []sqliteRow) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored := map[string]string{}
+	existing, err := tx.Query(`SELECT key, data FROM ` + table)
+	if err != nil {
+		return err
+	}
+	for existing.Next() {
+		var key, data string
+		if err := existing.Scan(&key, &data); err != nil {
+			existing.Close()
+			return err
+		}
+		stored[key] = data
+	}
+	existing.Close()
+	if err := existing.Err(); err != nil {
+		return err
+	}
+
+	upsert, err := tx.Prepare(`INSERT INTO ` + table + ` (key, data) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET data = excluded.data`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	for _, r := range rows {
+		data, err := json.Marshal(r.value)
+		if err != nil {
+			return err
+		}
+		old, ok := stored[r.key]
+		delete(stored, r.key)
+		if ok && old == string(data) {
+			continue
+		}
+		if _, err := upsert.Exec(r.key, string(data)); err != nil {
+			return err
+		}
+	}
+
+	for key := range stored {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE key = ?`, key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// copyIfMissing copies src to dst unless dst exists or src doesn't
+func copyIfMissing(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
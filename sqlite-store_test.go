@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// openTestSQLite opens a database in the temporary STATE_DIR
+func openTestSQLite(t *testing.T) *sqliteStateStore {
+	t.Helper()
+	s, err := openSQLiteStateStore(statePath(STATE_DB_FILE))
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// rowsWritten returns the rows changed by the save
+func rowsWritten(t *testing.T, s *sqliteStateStore, save func()) int64 {
+	t.Helper()
+	var before, after int64
+	if err := s.db.QueryRow(`SELECT total_changes()`).Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	save()
+	if err := s.db.QueryRow(`SELECT total_changes()`).Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	return after - before
+}
+
+func TestSQLiteSaveWritesOnlyChangedRows(t *testing.T) {
+	useTempState(t)
+	s := openTestSQLite(t)
+	a := recentPosted("006 km S 24° W of Sagbayan (Bohol)", time.Hour)
+	b := recentPosted("017 km S 71° E of Tulunan (Cotabato)", 2*time.Hour)
+	c := recentPosted("012 km N 45° W of Talisay City (Cebu)", 3*time.Hour)
+
+	if n := rowsWritten(t, s, func() { s.SavePosted([]PostedQuake{a, b, c}) }); n != 3 {
+		t.Errorf("first save wrote %d rows, want 3", n)
+	}
+	if n := rowsWritten(t, s, func() { s.SavePosted([]PostedQuake{a, b, c}) }); n != 0 {
+		t.Errorf("unchanged save wrote %d rows, want 0", n)
+	}
+	b.EventID = "$event"
+	if n := rowsWritten(t, s, func() { s.SavePosted([]PostedQuake{a, b, c}) }); n != 1 {
+		t.Errorf("save with one changed row wrote %d rows, want 1", n)
+	}
+	if n := rowsWritten(t, s, func() { s.SavePosted([]PostedQuake{a, b}) }); n != 1 {
+		t.Errorf("save with one removed row wrote %d rows, want 1", n)
+	}
+
+	posted := s.LoadPosted()
+	if len(posted) != 2 || posted[quakeLocationKey(b.Quake)].EventID != "$event" {
+		t.Errorf("LoadPosted = %+v, want the records of a and the changed b", posted)
+	}
+}
+
+func TestSQLiteMigratesGenerationSchema(t *testing.T) {
+	useTempState(t)
+	// a database written by the version that kept a generation number and lookup columns
+	db, err := sql.Open("sqlite", statePath(STATE_DB_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE fetched_quakes (key TEXT PRIMARY KEY, data TEXT NOT NULL, gen INTEGER NOT NULL);
+		CREATE TABLE posted_quakes (key TEXT PRIMARY KEY, occurred_at INTEGER NOT NULL, bulletin TEXT NOT NULL, data TEXT NOT NULL, gen INTEGER NOT NULL);
+		CREATE INDEX posted_quakes_bulletin ON posted_quakes (bulletin);
+		CREATE INDEX posted_quakes_occurred_at ON posted_quakes (occurred_at);
+		CREATE TABLE meta (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+		INSERT INTO meta (key, value) VALUES ('json_migrated', '2024-01-01');
+		INSERT INTO posted_quakes VALUES ('k1', 0, '', '{"datetime":"01 March 2024 - 11:10:00 PM","magnitude":"3.1","location":"006 km S 24° W of Sagbayan (Bohol)"}', 4);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestSQLite(t)
+	if got := len(s.LoadPosted()); got != 1 {
+		t.Fatalf("LoadPosted after the migration returned %d records, want 1", got)
+	}
+	var left int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('posted_quakes') WHERE name IN ('gen', 'occurred_at', 'bulletin')`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d old columns left in posted_quakes", left)
+	}
+	p := recentPosted("017 km S 71° E of Tulunan (Cotabato)", time.Hour)
+	s.SavePosted([]PostedQuake{p})
+	s.SaveFetched([]Quake{p.Quake})
+	if len(s.LoadPosted()) != 1 || len(s.LoadFetched()) != 1 {
+		t.Error("saves fail on the migrated schema")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// every file the monitor keeps its state in, moved into STATE_DIR by migrateStateFiles
+var stateFileNames = []string{
+	CACHE_FILE, POST_QUAKE_FILE, FETCH_STATE_FILE, TSUNAMI_STATE_FILE, BULLETIN_CACHE_FILE,
+	DEFERRED_ALERTS_FILE, CLUSTER_STATE_FILE, POSTED_HASHES_FILE, GEOCODE_CACHE_FILE, SEQUENCE_FILE,
+	DIGEST_STATE_FILE,
+	// the write-ahead log holds committed changes until the database is closed cleanly
+	STATE_DB_FILE, STATE_DB_FILE + "-wal", STATE_DB_FILE + "-shm",
+}
+
+// liveStatePath returns the path of a state file under STATE_DIR, absolute paths are kept as they are
+func liveStatePath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(stateDir, name)
+}
+
+// statePath returns the path state is written to under STATE_DIR. In dry-run mode this is a
+// shadow file (e.g. "posted_quakes.dryrun.json") so the real state stays untouched.
+func statePath(name string) string {
+	if !dryRun {
+		return liveStatePath(name)
+	}
+	ext := filepath.Ext(name)
+	return liveStatePath(strings.TrimSuffix(name, ext) + ".dryrun" + ext)
+}
+
+// stateReadPath returns the path state is read from: the shadow file once a dry run wrote it,
+// the real file otherwise, so a dry run starts from the live state
+func stateReadPath(name string) string {
+	if shadow := statePath(name); shadow != liveStatePath(name) {
+		if _, err := os.Stat(shadow); err == nil {
+			return shadow
+		}
+	}
+	return liveStatePath(name)
+}
+
+// prepareStateDir creates STATE_DIR, checks that it is writable and moves state files left in the
+// working directory by earlier versions into it, so the state survives moving to a volume
+func prepareStateDir() error {
+	if err := os.MkdirAll(stateDir, 0750); err != nil {
+		return fmt.Errorf("failed to create STATE_DIR %s: %w", stateDir, err)
+	}
+	probe, err := os.CreateTemp(stateDir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("STATE_DIR %s is not writable: %w", stateDir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if abs, _ := filepath.Abs(stateDir); abs == workingDir() {
+		return nil
+	}
+	for _, name := range stateFileNames {
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		target := liveStatePath(name)
+		if _, err := os.Stat(target); err == nil {
+			log.Printf("⚠️ Both %s and %s exist, using the one in STATE_DIR", name, target)
+			continue
+		}
+		if dryRun {
+			log.Printf("🧪 [dry-run] Would move %s from the working directory to %s", name, target)
+			continue
+		}
+		// a rename fails across volumes, copy instead and leave the original behind
+		if err := os.Rename(name, target); err != nil {
+			if err := copyIfMissing(name, target); err != nil {
+				return fmt.Errorf("failed to move %s into STATE_DIR: %w", name, err)
+			}
+		}
+		log.Printf("📦 Moved %s from the working directory to %s", name, target)
+	}
+	return nil
+}
+
+func workingDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return wd
+}
+
+// writeStateFile replaces a state file atomically: the data is written and fsynced to a temp file
+// in the same directory, which is then renamed over the target, so a crash or a full disk never
+// leaves a truncated or missing file behind. The previous version is kept as "<name>.bak" for readStateFile.
+func writeStateFile(fileName string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := backupStateFile(fileName); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		return err
+	}
+	// persist the renames too, best effort as not every platform can sync a directory
+	if dir, err := os.Open(filepath.Dir(fileName)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// backupStateFile points "<name>.bak" at the current version of a state file with a hard link, or
+// a copy where links aren't supported, so the file itself stays in place until it is replaced
+func backupStateFile(fileName string) error {
+	bak := fileName + ".bak"
+	if err := os.Remove(bak); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err := os.Link(fileName, bak)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(bak, data, 0644)
+}
+
+// readStateFile decodes a JSON state file into v, falling back to the "<name>.bak" copy of the
+// previous save when the file is missing or corrupt. Returns the error of the main file if
+// neither can be read.
+func readStateFile(fileName string, v any) error {
+	err := readJSONFile(fileName, v)
+	if err == nil {
+		return nil
+	}
+	if bakErr := readJSONFile(fileName+".bak", v); bakErr == nil {
+		log.Printf("⚠️ Failed to read %s (%v), restored the previous save from %s.bak", fileName, err, fileName)
+		return nil
+	}
+	return err
+}
+
+func readJSONFile(fileName string, v any) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// share of the entries known before that a recovered state file has to keep for posting to go on
+const MIN_RECOVERED_FRACTION = 0.9
+
+// entry counts of the list state files as last read, the reference for judging a recovery
+var knownStateEntries = map[string]int{}
+
+// state files recovered too poorly since the last cycle, see takeStateRecoveryProblems
+var stateRecoveryProblems []string
+
+// readStateList decodes a JSON array state file into v, a pointer to a slice. A corrupt file is moved
+// aside to "<name>.corrupt-<timestamp>" and recovered from its complete leading entries or from the
+// "<name>.bak" copy, whichever keeps more. A recovery keeping less than MIN_RECOVERED_FRACTION of the
+// entries known before, or when that count is unknown, is reported by takeStateRecoveryProblems.
+func readStateList(fileName string, v any) error {
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		// a crash between the renames of writeStateFile can leave only the backup
+		return readStateFile(fileName, v)
+	} else if err != nil {
+		return err
+	}
+	var entries []json.RawMessage
+	if err = json.Unmarshal(data, &entries); err == nil {
+		if err = json.Unmarshal(data, v); err == nil {
+			knownStateEntries[fileName] = len(entries)
+			return nil
+		}
+	}
+
+	log.Printf("❌ State file %s is corrupt: %v", fileName, err)
+	quarantineStateFile(fileName)
+	recovered, source := completeEntries(data), "its complete entries"
+	var bak []json.RawMessage
+	if readJSONFile(fileName+".bak", &bak) == nil && len(bak) >= len(recovered) {
+		recovered, source = bak, fileName+".bak"
+	}
+	raw, _ := json.Marshal(recovered)
+	if err := json.Unmarshal(raw, v); err != nil {
+		// entries of the wrong shape, nothing usable is left
+		recovered, source = nil, "nothing usable"
+		_ = json.Unmarshal([]byte("[]"), v)
+	}
+	log.Printf("⚠️ Recovered %d entries of %s from %s", len(recovered), fileName, source)
+
+	expected := max(knownStateEntries[fileName], len(bak))
+	if expected == 0 || float64(len(recovered)) < MIN_RECOVERED_FRACTION*float64(expected) {
+		known := "an unknown number of"
+		if expected > 0 {
+			known = fmt.Sprintf("the %d known", expected)
+		}
+		stateRecoveryProblems = append(stateRecoveryProblems,
+			fmt.Sprintf("%s was corrupt, only %d of %s entries could be recovered", filepath.Base(fileName), len(recovered), known))
+	}
+	return nil
+}
+
+// completeEntries returns the entries of a JSON array up to the first one that fails to decode,
+// which keeps everything written before a truncation. Nothing is returned when data isn't an array.
+func completeEntries(data []byte) []json.RawMessage {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil
+	}
+	var entries []json.RawMessage
+	for dec.More() {
+		var e json.RawMessage
+		if err := dec.Decode(&e); err != nil {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// quarantineStateFile moves a corrupt state file aside for inspection, the next save writes a fresh one
+func quarantineStateFile(fileName string) {
+	target := fileName + ".corrupt-" + time.Now().UTC().Format("20060102T150405Z")
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would move the corrupt %s to %s", fileName, target)
+		return
+	}
+	if err := os.Rename(fileName, target); err != nil {
+		log.Printf("❌ Failed to move the corrupt %s aside: %v", fileName, err)
+		return
+	}
+	log.Printf("📦 Moved the corrupt %s to %s", fileName, target)
+}
+
+// takeStateRecoveryProblems returns and clears the state files recovered too poorly to be trusted
+func takeStateRecoveryProblems() []string {
+	problems := stateRecoveryProblems
+	stateRecoveryProblems = nil
+	return problems
+}
+
+// alertStateRecovery tells the operator that posting was suspended for a cycle after a poor recovery
+func alertStateRecovery(problems []string) {
+	reason := strings.Join(problems, "; ")
+	log.Printf("❌ Not posting this cycle, the state could not be fully recovered: %s. "+
+		"The listed quakes were recorded as posted, check the .corrupt-* files for anything missed.", reason)
+	msg := fmt.Sprintf("⚠️ State files corrupt, posting suspended for one cycle\n%s\nThe listed quakes were recorded as posted without alerts.", reason)
+	formatted := fmt.Sprintf("⚠️ <b>State files corrupt, posting suspended for one cycle</b><br>%s<br>The listed quakes were recorded as posted without alerts.",
+		html.EscapeString(reason))
+	notifyAdmin(msg, formatted)
+}
+
+// loadStateFiles reads the state kept in memory between cycles, once the configuration
+// (and with it the dry-run mode) is known
+func loadStateFiles() {
+	bulletins = readBulletinCache(stateReadPath(BULLETIN_CACHE_FILE))
+	aftershockClusters = readAftershockClusters(stateReadPath(CLUSTER_STATE_FILE))
+	postedHashes = readPostedHashes(stateReadPath(POSTED_HASHES_FILE))
+	if digestTime != "" {
+		digest = readDigestState(stateReadPath(DIGEST_STATE_FILE))
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useThresholds sets LOCAL_MAG_THRESH and GLOBAL_MAG_THRESH for the duration of a test
+func useThresholds(t *testing.T, local, global float64) {
+	t.Helper()
+	savedLocal, savedGlobal := localMagThresh, globalMagThresh
+	localMagThresh, globalMagThresh = local, global
+	t.Cleanup(func() { localMagThresh, globalMagThresh = savedLocal, savedGlobal })
+}
+
+func TestPartialWriteDoesNotRepost(t *testing.T) {
+	useTempState(t)
+	useThresholds(t, 1, 1)
+	t.Cleanup(func() { takeStateRecoveryProblems() })
+	posted := []PostedQuake{
+		recentPosted("006 km S 24° W of Sagbayan (Bohol)", time.Hour),
+		recentPosted("017 km S 71° E of Tulunan (Cotabato)", 2*time.Hour),
+	}
+	latest := []Quake{posted[0].Quake, posted[1].Quake}
+	if changed, _ := processQuakes(latest, map[string]Quake{}, map[string]PostedQuake{}); len(changed) != 2 {
+		t.Fatalf("%d quakes detected without a posted record, want 2", len(changed))
+	}
+
+	// the second save keeps the first as the .bak copy, then a crash truncates the file
+	stateStore.SavePosted(posted)
+	stateStore.SavePosted(posted)
+	fileName := statePath(POST_QUAKE_FILE)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := stateStore.LoadPosted()
+	if len(loaded) != len(posted) {
+		t.Fatalf("%d posted quakes read back after a partial write, want %d", len(loaded), len(posted))
+	}
+	if changed, updated := processQuakes(latest, quakesByKey(latest, quakeOriginKey), loaded); len(changed) != 0 || len(updated) != 0 {
+		t.Errorf("quakes posted again after a partial write: %d new, %d updates", len(changed), len(updated))
+	}
+}
+
+func TestWriteStateFileKeepsBackup(t *testing.T) {
+	useTempState(t)
+	fileName := statePath("example.json")
+	for _, content := range []string{`["first"]`, `["second"]`} {
+		if err := writeStateFile(fileName, []byte(content)); err != nil {
+			t.Fatalf("writeStateFile: %v", err)
+		}
+	}
+	for name, want := range map[string]string{fileName: `["second"]`, fileName + ".bak": `["first"]`} {
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	// the backup is a separate file, rewriting the state in place must not change it
+	live, _ := os.Stat(fileName)
+	if bak, err := os.Stat(fileName + ".bak"); err != nil || os.SameFile(live, bak) {
+		t.Errorf("%s.bak is the live file: %v", fileName, err)
+	}
+
+	// a corrupt file falls back to the previous save
+	if err := os.WriteFile(fileName, []byte(`["sec`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := readStateFile(fileName, &got); err != nil || len(got) != 1 || got[0] != "first" {
+		t.Errorf("readStateFile = %v, %v, want the .bak copy", got, err)
+	}
+}
+
+func TestReadStateListQuarantine(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		bak     string
+		want    int
+		problem bool
+	}{
+		{"truncated", `["a", "b", "c`, "", 2, true},
+		{"garbage", "\x00\x1fnot json at all", "", 0, true},
+		{"truncated with a backup", `["a", "b`, `["a", "b", "c"]`, 3, false},
+		{"garbage with a backup", `{"a":`, `["a", "b", "c"]`, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempState(t)
+			savedKnown := knownStateEntries
+			knownStateEntries = map[string]int{}
+			t.Cleanup(func() { knownStateEntries = savedKnown; takeStateRecoveryProblems() })
+
+			// three entries were read before the corruption
+			fileName := statePath("example.json")
+			if err := os.WriteFile(fileName, []byte(`["a", "b", "c"]`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			if err := readStateList(fileName, &got); err != nil || len(got) != 3 {
+				t.Fatalf("readStateList = %v, %v", got, err)
+			}
+			if problems := takeStateRecoveryProblems(); len(problems) != 0 {
+				t.Fatalf("problems reported for an intact file: %v", problems)
+			}
+
+			if err := os.WriteFile(fileName, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.bak != "" {
+				if err := os.WriteFile(fileName+".bak", []byte(tt.bak), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got = nil
+			if err := readStateList(fileName, &got); err != nil {
+				t.Fatalf("readStateList of a corrupt file: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("recovered %v, want %d entries", got, tt.want)
+			}
+
+			quarantined, _ := filepath.Glob(fileName + ".corrupt-*")
+			if len(quarantined) != 1 {
+				t.Fatalf("quarantined files %v, want one", quarantined)
+			}
+			if data, _ := os.ReadFile(quarantined[0]); string(data) != tt.content {
+				t.Errorf("quarantined %q, want the corrupt content", data)
+			}
+			if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+				t.Errorf("corrupt file left in place: %v", err)
+			}
+
+			problems := takeStateRecoveryProblems()
+			if tt.problem && (len(problems) != 1 || !strings.Contains(problems[0], "example.json")) {
+				t.Errorf("problems %v, want example.json reported", problems)
+			}
+			if !tt.problem && len(problems) != 0 {
+				t.Errorf("problems %v after a full recovery", problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	STATE_BACKEND_FILE   = "file"
+	STATE_BACKEND_SQLITE = "sqlite"
+	STATE_BACKEND_REDIS  = "redis"
+)
+
+// StateStore persists the quakes of the last fetch, the posted quakes and the alerts held during
+// quiet hours between cycles.
+// Both backends keep the same semantics so the diff logic doesn't care which one is in use.
+type StateStore interface {
+	// LoadFetched returns the quakes of the previous fetch keyed by quakeOriginKey
+	LoadFetched() map[string]Quake
+	// LoadPosted returns the posted quakes keyed by quakeLocationKey
+	LoadPosted() map[string]PostedQuake
+	// SaveFetched replaces the stored quakes of the previous fetch
+	SaveFetched(quakes []Quake)
+	// SavePosted replaces the stored posted quakes, dropping those older than POSTED_RETENTION
+	SavePosted(posted []PostedQuake)
+	// ForgetPosted tells the store a posted quake, by quakeLocationKey, was removed from the set the
+	// next SavePosted gets. Only needed by backends whose saves don't replace the whole set.
+	ForgetPosted(key string)
+	// LoadDeferred returns the alerts held back during quiet hours, in the order they were held
+	LoadDeferred() []deferredAlert
+	// SaveDeferred replaces the stored alerts held back during quiet hours
+	SaveDeferred(alerts []deferredAlert)
+	// Claim takes the right to post the alert with the given hash, false when another instance
+	// sharing the state already claimed it. Backends that can't be shared always grant it.
+	Claim(hash string) (bool, error)
+	// Release gives up the claim on an alert that failed to post, so it can be claimed again
+	Release(hash string) error
+	// NextSequence increments and returns the persisted alert sequence number, starting at 1
+	NextSequence() (int64, error)
+	// Exists reports whether state was saved before, false on the very first run
+	Exists() bool
+	Close() error
+}
+
+// state backend selected by STATE_BACKEND, opened at startup
+var stateStore StateStore = fileStateStore{}
+
+// openStateStore opens the backend selected by STATE_BACKEND
+func openStateStore() (StateStore, error) {
+	switch stateBackend {
+	case STATE_BACKEND_FILE:
+		return fileStateStore{}, nil
+	case STATE_BACKEND_SQLITE:
+		return openSQLiteStateStore(statePath(STATE_DB_FILE))
+	case STATE_BACKEND_REDIS:
+		if redisURL == "" {
+			return nil, fmt.Errorf("REDIS_URL is required with STATE_BACKEND=%s", STATE_BACKEND_REDIS)
+		}
+		return openRedisStateStore(redisURL)
+	}
+	return nil, fmt.Errorf("STATE_BACKEND %q must be %q, %q or %q", stateBackend, STATE_BACKEND_FILE, STATE_BACKEND_SQLITE, STATE_BACKEND_REDIS)
+}
+
+// fileStateStore keeps the state in the last_quakes.json, posted_quakes.json and deferred_alerts.json files
+type fileStateStore struct{}
+
+func (fileStateStore) LoadFetched() map[string]Quake {
+	return readAllQuakesFromFile(stateReadPath(CACHE_FILE), quakeOriginKey)
+}
+
+func (fileStateStore) LoadPosted() map[string]PostedQuake {
+	return readPostedQuakesFromFile(stateReadPath(POST_QUAKE_FILE))
+}
+
+func (fileStateStore) SaveFetched(quakes []Quake) {
+	saveAllQuakesToFile(quakes, statePath(CACHE_FILE))
+}
+
+func (fileStateStore) SavePosted(posted []PostedQuake) {
+	savePostedQuakesToFile(prunePostedQuakes(posted, postedRetention, time.Now()), statePath(POST_QUAKE_FILE))
+}
+
+func (fileStateStore) LoadDeferred() []deferredAlert {
+	return readDeferredAlerts(stateReadPath(DEFERRED_ALERTS_FILE))
+}
+
+func (fileStateStore) SaveDeferred(alerts []deferredAlert) {
+	saveDeferredAlerts(alerts, statePath(DEFERRED_ALERTS_FILE))
+}
+
+func (fileStateStore) ForgetPosted(string) {}
+
+func (fileStateStore) Claim(string) (bool, error) { return true, nil }
+
+func (fileStateStore) Release(string) error { return nil }
+
+func (fileStateStore) NextSequence() (int64, error) {
+	var seq struct {
+		Last int64 `json:"last"`
+	}
+	if err := readStateFile(stateReadPath(SEQUENCE_FILE), &seq); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	seq.Last++
+	data, _ := json.MarshalIndent(seq, "", "  ")
+	if err := writeStateFile(statePath(SEQUENCE_FILE), data); err != nil {
+		return 0, err
+	}
+	return seq.Last, nil
+}
+
+func (fileStateStore) Exists() bool {
+	for _, fileName := range []string{CACHE_FILE, POST_QUAKE_FILE} {
+		path := stateReadPath(fileName)
+		// a crash between the renames of writeStateFile can leave only the backup
+		for _, p := range []string{path, path + ".bak"} {
+			if _, err := os.Stat(p); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (fileStateStore) Close() error { return nil }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useTempState keeps the state of a test in a temporary STATE_DIR with the file backend
+func useTempState(t *testing.T) {
+	t.Helper()
+	savedDir, savedStore, savedHashes, savedDeferred := stateDir, stateStore, postedHashes, deferredAlerts
+	stateDir = t.TempDir()
+	stateStore = fileStateStore{}
+	postedHashes = map[string]time.Time{}
+	deferredAlerts = nil
+	t.Cleanup(func() {
+		stateDir, stateStore, postedHashes, deferredAlerts = savedDir, savedStore, savedHashes, savedDeferred
+	})
+}
+
+// testStores opens each backend on the temporary STATE_DIR, Redis on an in-memory server
+func testStores(t *testing.T) map[string]StateStore {
+	t.Helper()
+	useTempState(t)
+	db, err := openSQLiteStateStore(statePath(STATE_DB_FILE))
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, rs := useRedis(t)
+	return map[string]StateStore{STATE_BACKEND_FILE: fileStateStore{}, STATE_BACKEND_SQLITE: db, STATE_BACKEND_REDIS: rs}
+}
+
+// recentPosted returns a posted record of a quake that occurred d ago
+func recentPosted(location string, d time.Duration) PostedQuake {
+	at := time.Now().Add(-d).In(manilaLoc)
+	q := withDerivedFields(Quake{DateTime: at.Format("02 January 2006 - 03:04:05 PM"), Magnitude: "4.2", Location: location})
+	p := newPostedQuake(q)
+	postedAt := time.Now().UTC()
+	p.PostedAt = &postedAt
+	return p
+}
+
+func TestDeferredAlertsRoundTrip(t *testing.T) {
+	first := withDerivedFields(Quake{DateTime: "01 March 2024 - 11:10:00 PM", Magnitude: "3.1", Location: "006 km S 24° W of Sagbayan (Bohol)"})
+	old := withDerivedFields(Quake{DateTime: "02 March 2024 - 01:05:00 AM", Magnitude: "2.9", Location: "017 km S 71° E of Tulunan (Cotabato)"})
+	revised := old
+	revised.Magnitude = "3.0"
+	revised = withDerivedFields(revised)
+	alerts := []deferredAlert{
+		{Quake: first},
+		{Quake: revised, Updated: true, Old: old, Destination: "ops"},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if got := store.LoadDeferred(); len(got) != 0 {
+				t.Fatalf("LoadDeferred on an empty store = %+v", got)
+			}
+			store.SaveDeferred(alerts)
+			if got := store.LoadDeferred(); !reflect.DeepEqual(got, alerts) {
+				t.Errorf("LoadDeferred = %+v, want %+v", got, alerts)
+			}
+			store.SaveDeferred(alerts[1:])
+			if got := store.LoadDeferred(); !reflect.DeepEqual(got, alerts[1:]) {
+				t.Errorf("LoadDeferred after removing one = %+v, want %+v", got, alerts[1:])
+			}
+			store.SaveDeferred(nil)
+			if got := store.LoadDeferred(); len(got) != 0 {
+				t.Errorf("LoadDeferred after clearing = %+v", got)
+			}
+		})
+	}
+}
+
+func TestSQLiteImportsDeferredFile(t *testing.T) {
+	useTempState(t)
+	held := []deferredAlert{{Quake: withDerivedFields(Quake{DateTime: "01 March 2024 - 11:10:00 PM", Magnitude: "3.1", Location: "006 km S 24° W of Sagbayan (Bohol)"})}}
+	fileStateStore{}.SaveDeferred(held)
+
+	db, err := openSQLiteStateStore(statePath(STATE_DB_FILE))
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore: %v", err)
+	}
+	defer db.Close()
+	if got := db.LoadDeferred(); !reflect.DeepEqual(got, held) {
+		t.Errorf("LoadDeferred after import = %+v, want %+v", got, held)
+	}
+}
+
+func TestNextSequenceSurvivesRestart(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for want := int64(1); want <= 3; want++ {
+				if seq, err := store.NextSequence(); err != nil || seq != want {
+					t.Fatalf("NextSequence = %d, %v, want %d", seq, err, want)
+				}
+			}
+		})
+	}
+	// the SQLite counter lives in the database, a new process continues it
+	db, err := openSQLiteStateStore(statePath(STATE_DB_FILE))
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore: %v", err)
+	}
+	defer db.Close()
+	if seq, err := db.NextSequence(); err != nil || seq != 4 {
+		t.Errorf("NextSequence after reopening = %d, %v, want 4", seq, err)
+	}
+	if seq, err := (fileStateStore{}).NextSequence(); err != nil || seq != 4 {
+		t.Errorf("NextSequence of the file backend after a restart = %d, %v, want 4", seq, err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// monitorStatus is what the main loop reports to the /healthz and /status endpoints
+type monitorStatus struct {
+	mu sync.Mutex
+
+	startedAt         time.Time
+	lastFetch         time.Time
+	lastSuccess       time.Time
+	lastPosted        *Quake
+	cachedQuakes      int
+	postedQuakes      int
+	consecutiveErrors int
+	notModifiedCycles int
+	layoutAlert       string
+	matrixValidated   bool
+	aftershockMode    bool
+}
+
+var status = &monitorStatus{startedAt: time.Now()}
+
+// recordFetch records the outcome of a PHIVOLCS fetch, a 304 counts as a success
+func (s *monitorStatus) recordFetch(ok bool, consecutiveErrors, notModifiedCycles int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastFetch = time.Now()
+	if ok {
+		s.lastSuccess = s.lastFetch
+	}
+	s.consecutiveErrors = consecutiveErrors
+	s.notModifiedCycles = notModifiedCycles
+}
+
+// recordCycle records the sizes of the cache and the posted history, and the polling mode, after a cycle
+func (s *monitorStatus) recordCycle(cached, posted int, aftershockMode bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cachedQuakes, s.postedQuakes = cached, posted
+	s.aftershockMode = aftershockMode
+}
+
+func (s *monitorStatus) recordPosted(q Quake) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastPosted = &q
+}
+
+func (s *monitorStatus) setLayoutAlert(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.layoutAlert = reason
+}
+
+func (s *monitorStatus) setMatrixValidated(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matrixValidated = ok
+}
+
+// healthy reports whether PHIVOLCS was fetched successfully within 3 poll intervals (counted from
+// startup before the first fetch), the Matrix credentials were validated and no layout alert is active
+func (s *monitorStatus) healthy() (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since := s.lastSuccess
+	if since.IsZero() {
+		since = s.startedAt
+	}
+	switch {
+	case time.Since(since) > 3*pollInterval:
+		return false, fmt.Sprintf("no successful PHIVOLCS fetch since %s", since.Format(time.RFC3339))
+	case !s.matrixValidated:
+		return false, "Matrix credentials not validated"
+	case s.layoutAlert != "":
+		return false, s.layoutAlert
+	}
+	return true, "ok"
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	ok, reason := status.healthy()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, reason)
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	healthy, reason := status.healthy()
+
+	status.mu.Lock()
+	body := map[string]any{
+		"healthy":             healthy,
+		"health_reason":       reason,
+		"started_at":          status.startedAt,
+		"last_fetch":          status.lastFetch,
+		"last_success":        status.lastSuccess,
+		"last_posted":         status.lastPosted,
+		"cached_quakes":       status.cachedQuakes,
+		"posted_quakes":       status.postedQuakes,
+		"consecutive_errors":  status.consecutiveErrors,
+		"not_modified_cycles": status.notModifiedCycles,
+		"matrix_validated":    status.matrixValidated,
+		"aftershock_mode":     status.aftershockMode,
+	}
+	status.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(body); err != nil {
+		log.Printf("⚠️ Failed to write status: %v", err)
+	}
+}
+
+// validateMatrixCredentials checks the access token against the whoami endpoint,
+// dry runs and setups without the Matrix notifier don't need working credentials
+func validateMatrixCredentials() error {
+	if dryRun || !notifierEnabled(NOTIFIER_MATRIX) {
+		return nil
+	}
+	whoamiURL := strings.TrimRight(matrixBaseURL, "/") + "/_matrix/client/v3/account/whoami"
+	if _, err := url.Parse(whoamiURL); err != nil {
+		return fmt.Errorf("invalid MATRIX_BASE_URL: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, whoamiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := matrixClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("whoami request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("whoami returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Telegram Bot API endpoint, the bot token is appended to the path
+const TELEGRAM_API_URL = "https://api.telegram.org/bot"
+
+// Telegram's HTML mode only knows a few inline tags, line breaks are plain newlines
+var (
+	telegramTagRe        = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9-]*)[^>]*>`)
+	telegramTableRowRe   = regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	telegramTableCellRe  = regexp.MustCompile(`(?is)<t([dh])[^>]*>(.*?)</t[dh]>`)
+	telegramBlankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// tags Telegram renders, every other tag is converted or dropped by telegramHTML
+var telegramTags = map[string]bool{
+	"a": true, "b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+	"s": true, "strike": true, "del": true, "code": true, "pre": true, "blockquote": true,
+	"span": true, "tg-spoiler": true, "tg-emoji": true,
+}
+
+// telegramNotifier posts alerts to a Telegram chat through the Bot API
+type telegramNotifier struct {
+	token  string
+	chatID string
+}
+
+func (n telegramNotifier) String() string { return NOTIFIER_TELEGRAM }
+
+func (n telegramNotifier) Notify(plain, html string) (err error) {
+	defer func() {
+		if err != nil {
+			sendFailures++
+		}
+	}()
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would post to Telegram chat %s:\n%s", n.chatID, plain)
+		return nil
+	}
+
+	payload := map[string]any{
+		"chat_id":                  n.chatID,
+		"text":                     telegramHTML(html),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}
+	if plainOnly {
+		payload = map[string]any{"chat_id": n.chatID, "text": stripLeadingEmoji(plain)}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	waitForPostSlot(context.Background())
+	req, err := http.NewRequest(http.MethodPost, TELEGRAM_API_URL+n.token+"/sendMessage", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		// the request URL carries the bot token, keep it out of the logs
+		return fmt.Errorf("Telegram request failed: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || !result.OK {
+		return fmt.Errorf("Telegram API error (HTTP %d): %s", resp.StatusCode, strings.TrimSpace(result.Description))
+	}
+	return nil
+}
+
+// telegramHTML adapts the Matrix HTML body to the subset Telegram accepts: list items become
+// "• " lines, table rows "cell | cell" lines with bold headers, headings bold lines and <hr> the
+// plain language divider. Other unsupported tags are dropped, keeping their text.
+func telegramHTML(html string) string {
+	html = telegramTableRowRe.ReplaceAllStringFunc(html, func(row string) string {
+		var cells []string
+		for _, m := range telegramTableCellRe.FindAllStringSubmatch(row, -1) {
+			cell := strings.TrimSpace(m[2])
+			if strings.EqualFold(m[1], "h") {
+				cell = "<b>" + cell + "</b>"
+			}
+			cells = append(cells, cell)
+		}
+		return strings.Join(cells, " | ") + "\n"
+	})
+	html = telegramTagRe.ReplaceAllStringFunc(html, func(tag string) string {
+		name := strings.ToLower(telegramTagRe.FindStringSubmatch(tag)[1])
+		closing := strings.HasPrefix(tag, "</")
+		switch {
+		case telegramTags[name]:
+			return tag
+		case name == "br":
+			return "\n"
+		case name == "hr":
+			return LANG_DIVIDER_PLAIN
+		case name == "li" && !closing:
+			return "• "
+		case name == "h1" || name == "h2" || name == "h3" || name == "h4" || name == "h5" || name == "h6":
+			if closing {
+				return "</b>\n"
+			}
+			return "<b>"
+		case closing && (name == "li" || name == "p" || name == "div"):
+			return "\n"
+		case !closing && (name == "ul" || name == "ol" || name == "table"):
+			return "\n"
+		}
+		return ""
+	})
+	return strings.TrimRight(telegramBlankLinesRe.ReplaceAllString(html, "\n\n"), "\n")
+}
+
+// redactURLError strips the request URL from an HTTP client error
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestTelegramHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			"line breaks and font",
+			`<b>Alert</b><br><font color="red"><b>🏚️ Damage expected</b></font> (yes)<br>`,
+			"<b>Alert</b>\n<b>🏚️ Damage expected</b> (yes)",
+		},
+		{
+			"quiet hours summary list",
+			`<b>🌅 2 earthquakes were held during quiet hours</b><ul><li><b>Mw 7.1</b> | 02 Dec | <a href="https://x/1">Hinatuan</a> <code>EQ-000001</code></li><li><b>M4.5</b> | 03 Dec | <a href="https://x/2">Sagbayan</a></li></ul>`,
+			"<b>🌅 2 earthquakes were held during quiet hours</b>\n• <b>Mw 7.1</b> | 02 Dec | <a href=\"https://x/1\">Hinatuan</a> <code>EQ-000001</code>\n• <b>M4.5</b> | 03 Dec | <a href=\"https://x/2\">Sagbayan</a>",
+		},
+		{
+			"digest table",
+			`<b>📊 Daily digest</b><table><tr><th>Province</th><th>Events</th></tr><tr><td>Bohol</td><td>3</td></tr><tr><td colspan="2">… and 2 more</td></tr></table>`,
+			"<b>📊 Daily digest</b>\n<b>Province</b> | <b>Events</b>\nBohol | 3\n… and 2 more",
+		},
+		{
+			"headline and language divider",
+			`<h3>🚨 Strong Earthquake Alert!</h3>Magnitude: 6.5<br><hr><h3>🚨 Babala: Malakas na Lindol!</h3>Magnitude: 6.5<br>`,
+			"<b>🚨 Strong Earthquake Alert!</b>\nMagnitude: 6.5\n\n— — —\n\n<b>🚨 Babala: Malakas na Lindol!</b>\nMagnitude: 6.5",
+		},
+		{
+			"unknown tags keep their text",
+			`<p>One</p><div><sup>2</sup></div><blockquote>kept</blockquote>`,
+			"One\n2\n<blockquote>kept</blockquote>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := telegramHTML(tt.html); got != tt.want {
+				t.Errorf("telegramHTML =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// the messages built as HTML tables and lists must reach Telegram with supported tags only
+func TestTelegramHTMLGeneratedMessages(t *testing.T) {
+	q := withDerivedFields(Quake{DateTime: "02 December 2023 - 10:37:00 PM", Magnitude: "3.1", MagType: "Mw", Location: "030 km N 72° E of Hinatuan (Surigao Del Sur)"})
+	_, summary := formatQuietSummary([]deferredAlert{{Quake: q}}, []PostedQuake{{AlertRef: "EQ-000001"}})
+	_, digest := formatDigest([]Quake{q})
+	for name, html := range map[string]string{"quiet hours summary": summary, "daily digest": digest} {
+		got := telegramHTML(html)
+		for _, m := range telegramTagRe.FindAllStringSubmatch(got, -1) {
+			if !telegramTags[m[1]] {
+				t.Errorf("%s: tag %s left for Telegram in %q", name, m[0], got)
+			}
+		}
+	}
+}
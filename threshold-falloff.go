@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// thresholdConfig holds the settings the regional magnitude threshold is derived from
+type thresholdConfig struct {
+	localMag, globalMag float64
+	radiusKm            float64
+	// interpolate from localMag at the reference point to globalMag at twice radiusKm,
+	// instead of switching at radiusKm
+	falloff bool
+	// shape of the interpolation, 1 is linear and larger values keep the threshold low for longer
+	falloffExponent float64
+}
+
+// currentThresholdConfig returns the configured threshold settings
+func currentThresholdConfig() thresholdConfig {
+	return thresholdConfig{
+		localMag:        localMagThresh,
+		globalMag:       globalMagThresh,
+		radiusKm:        refRadiusKm,
+		falloff:         thresholdFalloff,
+		falloffExponent: falloffExponent,
+	}
+}
+
+// thresholdAtDistance returns the regional magnitude threshold of a quake distKm away from the reference point
+func thresholdAtDistance(distKm float64, cfg thresholdConfig) float64 {
+	if !cfg.falloff {
+		if distKm <= cfg.radiusKm {
+			return cfg.localMag
+		}
+		return cfg.globalMag
+	}
+	span := 2 * cfg.radiusKm
+	if distKm >= span {
+		return cfg.globalMag
+	}
+	t := math.Pow(math.Max(distKm, 0)/span, cfg.falloffExponent)
+	return cfg.localMag + (cfg.globalMag-cfg.localMag)*t
+}
+
+// formatDistanceLine shows the distance and compass bearing of a quake from the reference point,
+// e.g. "Distance from Cebu City: 87 km NNW", and with SHOW_ALERT_DISTANCE the threshold it had to
+// reach. The point is named by REF_POINT_NAME, or REF_POINT_PLACE. Empty when the quake has no
+// usable coordinates or is farther than DISTANCE_DISPLAY_RADIUS_KM.
+func formatDistanceLine(q Quake) (string, string) {
+	lat, lon, ok := quakeCoords(q)
+	if !ok {
+		return "", ""
+	}
+	dist := distanceKm(refPointLat, refPointLon, lat, lon)
+	if distanceDisplayRadiusKm > 0 && dist > distanceDisplayRadiusKm {
+		return "", ""
+	}
+	name := "the reference point"
+	if refPointName != "" {
+		name = refPointName
+	} else if refPointPlace != "" {
+		name = refPointPlace
+	}
+	text := fmt.Sprintf("%.0f km", dist)
+	// too close for the direction to mean anything
+	if dist >= 1 {
+		text += " " + compassPoint(bearingDeg(refPointLat, refPointLon, lat, lon))
+	}
+	if showAlertDistance {
+		text += fmt.Sprintf(" (threshold M%.1f)", thresholdFor(q))
+	}
+	plain := fmt.Sprintf("Distance from %s: %s\n", name, text)
+	html := fmt.Sprintf("📏 <b>Distance from %s:</b> %s<br>", name, text)
+	return plain, html
+}
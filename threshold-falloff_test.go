@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestThresholdAtDistanceSweep(t *testing.T) {
+	hard := thresholdConfig{localMag: 3, globalMag: 5, radiusKm: 100}
+	linear := hard
+	linear.falloff, linear.falloffExponent = true, 1
+	curved := linear
+	curved.falloffExponent = 2
+
+	tests := []struct {
+		distKm               float64
+		hard, linear, curved float64
+	}{
+		{-1, 3, 3, 3},
+		{0, 3, 3, 3},
+		{50, 3, 3.5, 3.125},
+		{100, 3, 4, 3.5},
+		{100.01, 5, 4.0001, 3.500100005},
+		{109, 5, 4.09, 3.59405},
+		{111, 5, 4.11, 3.61605},
+		{150, 5, 4.5, 4.125},
+		{199, 5, 4.99, 4.98005},
+		{200, 5, 5, 5},
+		{1000, 5, 5, 5},
+	}
+	for _, tt := range tests {
+		for name, c := range map[string]struct {
+			cfg  thresholdConfig
+			want float64
+		}{"hard": {hard, tt.hard}, "linear": {linear, tt.linear}, "curved": {curved, tt.curved}} {
+			if got := thresholdAtDistance(tt.distKm, c.cfg); math.Abs(got-c.want) > 1e-9 {
+				t.Errorf("%s threshold at %v km = %v, want %v", name, tt.distKm, got, c.want)
+			}
+		}
+	}
+}
+
+func TestThresholdFalloffHasNoCliff(t *testing.T) {
+	cfg := thresholdConfig{localMag: 3, globalMag: 5, radiusKm: 100, falloff: true, falloffExponent: 1.5}
+	prev := thresholdAtDistance(0, cfg)
+	for d := 1.0; d <= 300; d++ {
+		got := thresholdAtDistance(d, cfg)
+		if got < prev {
+			t.Fatalf("threshold drops from %v to %v at %v km", prev, got, d)
+		}
+		if got-prev > 0.05 {
+			t.Fatalf("threshold jumps from %v to %v at %v km", prev, got, d)
+		}
+		prev = got
+	}
+}
+
+func TestShowAlertDistance(t *testing.T) {
+	savedLat, savedLon, savedName, savedShow := refPointLat, refPointLon, refPointName, showAlertDistance
+	savedFalloff, savedExponent, savedRadius, savedDisplay := thresholdFalloff, falloffExponent, refRadiusKm, distanceDisplayRadiusKm
+	t.Cleanup(func() {
+		refPointLat, refPointLon, refPointName, showAlertDistance = savedLat, savedLon, savedName, savedShow
+		thresholdFalloff, falloffExponent, refRadiusKm, distanceDisplayRadiusKm = savedFalloff, savedExponent, savedRadius, savedDisplay
+	})
+	useThresholds(t, 3, 5)
+	refPointLat, refPointLon, refPointName = 10.3157, 123.8854, "Cebu City"
+	thresholdFalloff, falloffExponent, refRadiusKm, distanceDisplayRadiusKm = true, 1, 100, 0
+
+	// about 111 km north of the reference point
+	q := Quake{Latitude: "11.3157", Longitude: "123.8854"}
+	showAlertDistance = false
+	plain, _ := formatDistanceLine(q)
+	if !strings.HasPrefix(plain, "Distance from Cebu City: 111 km") || strings.Contains(plain, "threshold") {
+		t.Errorf("distance line = %q", plain)
+	}
+	showAlertDistance = true
+	plain, formatted := formatDistanceLine(q)
+	if !strings.Contains(plain, "(threshold M4.1)") || !strings.Contains(formatted, "(threshold M4.1)") {
+		t.Errorf("distance line with SHOW_ALERT_DISTANCE = %q, %q", plain, formatted)
+	}
+	if plain, _ := formatDistanceLine(Quake{Latitude: "—", Longitude: "123.8854"}); plain != "" {
+		t.Errorf("distance line without coordinates = %q", plain)
+	}
+}
+
+func TestFormatDistanceLine(t *testing.T) {
+	savedLat, savedLon, savedName, savedPlace := refPointLat, refPointLon, refPointName, refPointPlace
+	savedShow, savedDisplay := showAlertDistance, distanceDisplayRadiusKm
+	t.Cleanup(func() {
+		refPointLat, refPointLon, refPointName, refPointPlace = savedLat, savedLon, savedName, savedPlace
+		showAlertDistance, distanceDisplayRadiusKm = savedShow, savedDisplay
+	})
+	refPointLat, refPointLon, showAlertDistance = 10.3157, 123.8854, false
+
+	tests := []struct {
+		name, place string
+		displayKm   float64
+		q           Quake
+		plain, html string
+	}{
+		{"Cebu City", "", 0, Quake{Latitude: "11.05", Longitude: "123.50"},
+			"Distance from Cebu City: 92 km NNW\n", "📏 <b>Distance from Cebu City:</b> 92 km NNW<br>"},
+		{"", "Cebu", 0, Quake{Latitude: "07.07", Longitude: "125.61"},
+			"Distance from Cebu: 408 km SSE\n", "📏 <b>Distance from Cebu:</b> 408 km SSE<br>"},
+		{"", "", 0, Quake{Latitude: "10.33", Longitude: "123.90"},
+			"Distance from the reference point: 2 km NE\n", "📏 <b>Distance from the reference point:</b> 2 km NE<br>"},
+		// too close for a direction
+		{"Cebu City", "", 0, Quake{Latitude: "10.3157", Longitude: "123.8854"},
+			"Distance from Cebu City: 0 km\n", "📏 <b>Distance from Cebu City:</b> 0 km<br>"},
+		// outside DISTANCE_DISPLAY_RADIUS_KM
+		{"Cebu City", "", 200, Quake{Latitude: "07.07", Longitude: "125.61"}, "", ""},
+	}
+	for _, tt := range tests {
+		refPointName, refPointPlace, distanceDisplayRadiusKm = tt.name, tt.place, tt.displayKm
+		plain, html := formatDistanceLine(tt.q)
+		if plain != tt.plain || html != tt.html {
+			t.Errorf("formatDistanceLine(%s, %s) = %q, %q, want %q, %q", tt.q.Latitude, tt.q.Longitude, plain, html, tt.plain, tt.html)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Tsunami advisory classifications, from most to least severe
+const (
+	TSUNAMI_WARNING   = "Tsunami Warning"
+	TSUNAMI_ADVISORY  = "Tsunami Advisory"
+	TSUNAMI_NO_THREAT = "No Tsunami Threat"
+	TSUNAMI_CANCELLED = "Cancelled"
+)
+
+// tsunamiWatch keeps checking the tsunami page for a while after a triggering quake
+type tsunamiWatch struct {
+	QuakeKey string    `json:"quake_key"`
+	Summary  string    `json:"summary"`
+	Until    time.Time `json:"until"`
+}
+
+// tsunamiState is persisted in TSUNAMI_STATE_FILE so an advisory is only posted once
+type tsunamiState struct {
+	LastAdvisoryID     string         `json:"last_advisory_id,omitempty"`
+	LastClassification string         `json:"last_classification,omitempty"`
+	Watches            []tsunamiWatch `json:"watches,omitempty"`
+}
+
+// tsunamiAdvisory is the latest advisory parsed from the tsunami information page
+type tsunamiAdvisory struct {
+	ID             string
+	Classification string
+	AffectedAreas  string
+}
+
+var (
+	// e.g. "... coastal areas of Surigao del Sur and Davao Oriental."
+	tsunamiAreasRe = regexp.MustCompile(`(?i)coast(?:al|s|line)?\s+(?:areas?\s+|provinces?\s+)?of\s+([^.]+)`)
+	tsunamiTextRe  = regexp.MustCompile(`(?i)tsunami`)
+)
+
+// isTsunamiTrigger reports whether a posted quake should start watching the tsunami page:
+// strong enough to be potentially tsunamigenic, or its bulletin mentions a tsunami
+func isTsunamiTrigger(q Quake) bool {
+	return q.MagnitudeValue >= tsunamiCheckMagnitude || q.MentionsTsunami
+}
+
+// watchTsunamiFor starts (or extends) watching the tsunami page after the given quake
+func watchTsunamiFor(q Quake) {
+	state := readTsunamiState(stateReadPath(TSUNAMI_STATE_FILE))
+	key := quakeOriginKey(q)
+	until := time.Now().Add(tsunamiWatchWindow)
+	summary := fmt.Sprintf("M%.1f | %s | %s", q.MagnitudeValue, q.DateTime, q.Location)
+
+	found := false
+	for i := range state.Watches {
+		if state.Watches[i].QuakeKey == key {
+			state.Watches[i].Until = until
+			state.Watches[i].Summary = summary
+			found = true
+		}
+	}
+	if !found {
+		state.Watches = append(state.Watches, tsunamiWatch{QuakeKey: key, Summary: summary, Until: until})
+		log.Printf("🌊 Watching tsunami information for %s until %s", summary, until.Format(time.RFC3339))
+	}
+	saveTsunamiState(state, statePath(TSUNAMI_STATE_FILE))
+}
+
+// checkTsunamiAdvisories polls the tsunami page while any watch is active and posts
+// new advisories (including cancellations) as follow-ups to the triggering quake
+func checkTsunamiAdvisories(ctx context.Context) {
+	state := readTsunamiState(stateReadPath(TSUNAMI_STATE_FILE))
+
+	// drop expired watches
+	now := time.Now()
+	active := state.Watches[:0]
+	for _, w := range state.Watches {
+		if now.Before(w.Until) {
+			active = append(active, w)
+		}
+	}
+	state.Watches = active
+	if len(state.Watches) == 0 {
+		saveTsunamiState(state, statePath(TSUNAMI_STATE_FILE))
+		return
+	}
+
+	doc, err := fetchDocument(ctx, tsunamiInfoURL)
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch tsunami information: %v", err)
+		return
+	}
+	advisory, ok := parseTsunamiAdvisory(doc)
+	if !ok {
+		log.Printf("⚠️ No tsunami advisory found on %s", tsunamiInfoURL)
+		return
+	}
+	if advisory.ID == state.LastAdvisoryID {
+		return
+	}
+
+	// the latest watch is the quake the advisory most likely refers to
+	related := state.Watches[len(state.Watches)-1]
+	msg, formatted := formatTsunamiMsg(advisory, state.LastClassification, related)
+	if err := notifyAll(msg, formatted); err != nil {
+		log.Printf("Alert post failed: %v", err)
+		return
+	}
+	log.Printf("🌊 Posted tsunami information: %s", advisory.Classification)
+
+	state.LastAdvisoryID = advisory.ID
+	state.LastClassification = advisory.Classification
+	saveTsunamiState(state, statePath(TSUNAMI_STATE_FILE))
+}
+
+// parseTsunamiAdvisory extracts the topmost (latest) advisory from the tsunami information page
+func parseTsunamiAdvisory(doc *goquery.Document) (tsunamiAdvisory, bool) {
+	// the latest advisory is the first content block that talks about tsunamis
+	var text string
+	doc.Find("article, .item, .item-page, table, p").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		t := strings.Join(strings.Fields(s.Text()), " ")
+		if tsunamiTextRe.MatchString(t) && tsunamiClassification(t) != "" {
+			text = t
+			return false
+		}
+		return true
+	})
+	if text == "" {
+		return tsunamiAdvisory{}, false
+	}
+
+	advisory := tsunamiAdvisory{Classification: tsunamiClassification(text)}
+	if m := tsunamiAreasRe.FindStringSubmatch(text); m != nil {
+		advisory.AffectedAreas = strings.TrimSpace(m[1])
+	}
+	// the advisory text itself identifies it, any new issuance changes it
+	sum := sha1.Sum([]byte(text))
+	advisory.ID = hex.EncodeToString(sum[:])
+	return advisory, true
+}
+
+// Classify advisory text, cancellation wording takes precedence over the original level
+func tsunamiClassification(text string) string {
+	upper := strings.ToUpper(text)
+	switch {
+	case strings.Contains(upper, "CANCEL") || strings.Contains(upper, "LIFTED"):
+		return TSUNAMI_CANCELLED
+	case strings.Contains(upper, "TSUNAMI WARNING"):
+		return TSUNAMI_WARNING
+	case strings.Contains(upper, "TSUNAMI ADVISORY"):
+		return TSUNAMI_ADVISORY
+	case strings.Contains(upper, "NO DESTRUCTIVE TSUNAMI THREAT"), strings.Contains(upper, "NO TSUNAMI THREAT"):
+		return TSUNAMI_NO_THREAT
+	}
+	return ""
+}
+
+// Format the tsunami follow-up message
+func formatTsunamiMsg(a tsunamiAdvisory, previous string, related tsunamiWatch) (string, string) {
+	title, emoji := "Tsunami Information", "🌊"
+	switch a.Classification {
+	case TSUNAMI_WARNING:
+		emoji = "🚨🌊"
+	case TSUNAMI_CANCELLED:
+		title, emoji = "Tsunami Advisory Cancelled", "✅"
+	}
+
+	status := a.Classification
+	if previous != "" && previous != a.Classification {
+		status = fmt.Sprintf("%s → %s", previous, a.Classification)
+	}
+	areas := a.AffectedAreas
+	if areas == "" {
+		areas = "not specified"
+	}
+
+	msg := fmt.Sprintf("%s %s\nRelated quake: %s\nStatus: %s\nAffected coastal areas: %s\nSource: %s",
+		emoji, title, related.Summary, status, areas, tsunamiInfoURL)
+	formatted := fmt.Sprintf("%s <b>%s</b><br><br>🔗 <b>Related quake:</b> %s<br>⚠️ <b>Status:</b> %s<br>🏖️ <b>Affected coastal areas:</b> %s<br>📄 <a href=\"%s\">View PHIVOLCS tsunami information</a>",
+		emoji, title, related.Summary, status, areas, tsunamiInfoURL)
+	return msg, formatted
+}
+
+func readTsunamiState(fileName string) tsunamiState {
+	var state tsunamiState
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("⚠️ Failed to parse tsunami state file (%s), resetting: %v", fileName, err)
+		return tsunamiState{}
+	}
+	return state
+}
+
+func saveTsunamiState(state tsunamiState, fileName string) {
+	data, _ := json.MarshalIndent(state, "", "  ")
+	if err := writeStateFile(fileName, data); err != nil {
+		log.Printf("❌ Failed to write to file (%s): %v", fileName, err)
+	}
+}
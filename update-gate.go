@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// updateGateEnabled reports whether revisions must move a value by UPDATE_MIN_*_DELTA to be posted
+func updateGateEnabled() bool {
+	return updateMinMagDelta > 0 || updateMinDepthDeltaKm > 0 || updateMinDistDeltaKm > 0
+}
+
+// significantRevision compares a revision with the version of the quake last announced and reports
+// whether it moved the magnitude, depth or epicenter by at least the UPDATE_MIN_*_DELTA settings or
+// reworded the location (AddressSimilarity below UPDATE_LOCATION_SIMILARITY). Silent revisions in
+// between are not compared, so small changes add up until one of the deltas is reached. The reason
+// lists what changed, or why the revision is too small.
+func significantRevision(announced, q Quake) (bool, string) {
+	var changes []string
+	if updateMinMagDelta > 0 && announced.MagnitudeOK && q.MagnitudeOK {
+		if d := math.Abs(q.MagnitudeValue - announced.MagnitudeValue); d >= updateMinMagDelta-1e-9 {
+			changes = append(changes, fmt.Sprintf("magnitude moved by %.1f", d))
+		}
+	}
+	if updateMinDepthDeltaKm > 0 {
+		oldDepth, err1 := strconv.ParseFloat(normalizeDepth(announced.Depth), 64)
+		newDepth, err2 := strconv.ParseFloat(normalizeDepth(q.Depth), 64)
+		if err1 != nil || err2 != nil {
+			// a depth appearing or disappearing is a change worth posting
+			if depthChanged(announced, q) {
+				changes = append(changes, "depth became known or unknown")
+			}
+		} else if d := math.Abs(newDepth - oldDepth); d >= updateMinDepthDeltaKm {
+			changes = append(changes, fmt.Sprintf("depth moved by %g km", d))
+		}
+	}
+	if updateMinDistDeltaKm > 0 {
+		oldLat, oldLon, ok1 := quakeCoords(announced)
+		newLat, newLon, ok2 := quakeCoords(q)
+		if ok1 && ok2 {
+			if d := distanceKm(oldLat, oldLon, newLat, newLon); d >= updateMinDistDeltaKm {
+				changes = append(changes, fmt.Sprintf("epicenter moved by %.1f km", d))
+			}
+		} else if coordsChanged(announced, q) {
+			changes = append(changes, "coordinates became known or unknown")
+		}
+	}
+	if announced.Location != q.Location {
+		if sim := AddressSimilarity(announced.Location, q.Location); sim < updateLocationSimilarity {
+			changes = append(changes, fmt.Sprintf("location reworded (%.0f%% similar)", sim))
+		}
+	}
+	if len(changes) == 0 {
+		return false, fmt.Sprintf("revision below the UPDATE_MIN_*_DELTA settings (M%s, %s, %s°N %s°E announced)",
+			announced.Magnitude, formatDepth(announced.Depth), announced.Latitude, announced.Longitude)
+	}
+	return true, strings.Join(changes, ", ")
+}
+
+// announcedQuake returns the version of a posted quake its last alert showed
+func announcedQuake(p PostedQuake) Quake {
+	if p.Announced != nil {
+		return *p.Announced
+	}
+	return p.Quake
+}
+
+// silentRevision moves the posted record of a quake to a revision that wasn't posted, keeping the
+// delivery metadata and the announced version so later revisions thread and compare as before
+func silentRevision(original PostedQuake, q Quake) PostedQuake {
+	announced := announcedQuake(original)
+	p := original
+	p.Quake = q
+	p.BulletinNo, _, _ = getBulletinNumber(q.Bulletin)
+	p.Announced = &announced
+	return p
+}
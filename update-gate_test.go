@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// useUpdateGate sets UPDATE_MIN_MAG_DELTA, UPDATE_MIN_DEPTH_DELTA_KM and UPDATE_MIN_DIST_DELTA_KM
+// for the duration of a test
+func useUpdateGate(t *testing.T, mag, depthKm, distKm float64) {
+	t.Helper()
+	savedMag, savedDepth, savedDist := updateMinMagDelta, updateMinDepthDeltaKm, updateMinDistDeltaKm
+	updateMinMagDelta, updateMinDepthDeltaKm, updateMinDistDeltaKm = mag, depthKm, distKm
+	t.Cleanup(func() {
+		updateMinMagDelta, updateMinDepthDeltaKm, updateMinDistDeltaKm = savedMag, savedDepth, savedDist
+	})
+}
+
+func TestUpdateGateCumulativeDrift(t *testing.T) {
+	tests := []struct {
+		name   string
+		revise func(q *Quake, i int)
+		// whether each of the revisions is posted
+		posted []bool
+	}{
+		{"depth", func(q *Quake, i int) { q.Depth = fmt.Sprint(10 + i) },
+			[]bool{false, false, true, false}},
+		{"magnitude", func(q *Quake, i int) { q.Magnitude = fmt.Sprintf("%.1f", 4.3+0.1*float64(i)) },
+			[]bool{false, true, false, true}},
+		{"epicenter", func(q *Quake, i int) { q.Latitude = fmt.Sprintf("%.2f", 10+0.01*float64(i)) },
+			[]bool{false, false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useThresholds(t, 1, 1)
+			useUpdateGate(t, 0.2, 3, 3)
+			q := frontPageQuakes(t)[0]
+			q.Depth, q.Latitude, q.Longitude = "10", "10.00", "124.00"
+			q = withDerivedFields(q)
+			posted := postedByKey([]PostedQuake{newPostedQuake(q)})
+			lastFetch := quakesByKey([]Quake{q}, quakeOriginKey)
+
+			prev := q
+			for i, want := range tt.posted {
+				rev := prev
+				tt.revise(&rev, i+1)
+				rev.Bulletin = strings.Replace(q.Bulletin, "_B2F", fmt.Sprintf("_B%dF", i+3), 1)
+				rev = withDerivedFields(rev)
+
+				changed, updated := processQuakes([]Quake{rev}, lastFetch, posted)
+				if len(changed) != 0 || len(updated) != 1 {
+					t.Fatalf("revision %d: changed %+v, updated %+v, want one update", i+1, changed, updated)
+				}
+				u := updated[0]
+				if u.Silent == want {
+					t.Errorf("revision %d (%s km, M%s, %s°N): posted = %v, want %v",
+						i+1, rev.Depth, rev.Magnitude, rev.Latitude, !u.Silent, want)
+				}
+
+				// the records follow as the main loop keeps them
+				original := findPostedOriginal(posted, u.Old)
+				delete(posted, quakeLocationKey(original.Quake))
+				next := newPostedQuake(u.New)
+				if u.Silent {
+					next = silentRevision(original, u.New)
+				}
+				posted[quakeLocationKey(next.Quake)] = next
+				lastFetch = quakesByKey([]Quake{rev}, quakeOriginKey)
+				prev = rev
+			}
+		})
+	}
+}
+
+func TestSignificantRevision(t *testing.T) {
+	useUpdateGate(t, 0.2, 3, 3)
+	announced := withDerivedFields(Quake{Magnitude: "4.3", Depth: "010", Latitude: "10.00", Longitude: "124.00",
+		Location: "020 km N 55° E of Medellin (Cebu)"})
+	tests := []struct {
+		name   string
+		revise func(q *Quake)
+		ok     bool
+	}{
+		{"unchanged", func(q *Quake) {}, false},
+		{"depth by 1 km", func(q *Quake) { q.Depth = "011" }, false},
+		{"depth becomes unknown", func(q *Quake) { q.Depth = "—" }, true},
+		{"coordinates by 0.01°", func(q *Quake) { q.Latitude = "10.01" }, false},
+		{"coordinates become unknown", func(q *Quake) { q.Latitude = "" }, true},
+		{"magnitude down by 0.2", func(q *Quake) { q.Magnitude = "4.1" }, true},
+		{"location reworded", func(q *Quake) { q.Location = "005 km S 10° W of Bogo City (Cebu)" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := announced
+			tt.revise(&q)
+			q = withDerivedFields(q)
+			if ok, reason := significantRevision(announced, q); ok != tt.ok {
+				t.Errorf("significantRevision = %v (%s), want %v", ok, reason, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// USGS FDSN event query endpoint
+const USGS_FDSN_URL = "https://earthquake.usgs.gov/fdsnws/event/1/query"
+
+// usgsMatch is the USGS event matched to a PHIVOLCS quake
+type usgsMatch struct {
+	EventURL  string
+	Magnitude float64
+	MagType   string
+}
+
+// usgsResponse is the subset of the FDSN GeoJSON response we use
+type usgsResponse struct {
+	Features []struct {
+		Properties struct {
+			Mag     *float64 `json:"mag"`
+			MagType string   `json:"magType"`
+			Time    int64    `json:"time"` // epoch milliseconds
+			URL     string   `json:"url"`
+		} `json:"properties"`
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"` // lon, lat, depth
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+var (
+	// lookups per quake key, nil entries record that no confident match was found
+	usgsCache   = map[string]*usgsMatch{}
+	usgsCacheMu sync.Mutex
+)
+
+// enrichWithUSGS looks up the matching USGS event and records its link and magnitude on the quake.
+// Any failure or ambiguous match is logged and leaves the quake untouched, it never blocks posting.
+func enrichWithUSGS(ctx context.Context, q *Quake) {
+	key := quakeOriginKey(*q)
+	usgsCacheMu.Lock()
+	match, cached := usgsCache[key]
+	usgsCacheMu.Unlock()
+
+	if !cached {
+		var err error
+		match, err = lookupUSGSEvent(ctx, *q)
+		if err != nil {
+			// not cached so the next revision can retry
+			log.Printf("⚠️ USGS lookup failed for %s: %v", key, err)
+			return
+		}
+		usgsCacheMu.Lock()
+		usgsCache[key] = match
+		usgsCacheMu.Unlock()
+	}
+
+	if match != nil {
+		q.USGSEventURL = match.EventURL
+		q.USGSMagnitude = fmt.Sprintf("%s %.1f", formatUSGSMagType(match.MagType), match.Magnitude)
+	}
+}
+
+// lookupUSGSEvent queries the FDSN API around the quake's time and epicenter and returns
+// the closest event, or nil when there is no confident match
+func lookupUSGSEvent(ctx context.Context, q Quake) (*usgsMatch, error) {
+	lat, lon, ok := quakeCoords(q)
+	if !ok {
+		return nil, fmt.Errorf("invalid coordinates %q, %q", q.Latitude, q.Longitude)
+	}
+	if q.OccurredAt.IsZero() {
+		return nil, fmt.Errorf("invalid datetime %q", q.DateTime)
+	}
+	occurred := q.OccurredAt.UTC()
+
+	window := time.Duration(usgsMatchMinutes) * time.Minute
+	latDelta := usgsMatchKm / 111.0
+	lonDelta := usgsMatchKm / (111.0 * math.Cos(lat*math.Pi/180.0))
+
+	params := url.Values{}
+	params.Set("format", "geojson")
+	params.Set("starttime", occurred.Add(-window).Format("2006-01-02T15:04:05"))
+	params.Set("endtime", occurred.Add(window).Format("2006-01-02T15:04:05"))
+	params.Set("minlatitude", strconv.FormatFloat(lat-latDelta, 'f', 3, 64))
+	params.Set("maxlatitude", strconv.FormatFloat(lat+latDelta, 'f', 3, 64))
+	params.Set("minlongitude", strconv.FormatFloat(lon-lonDelta, 'f', 3, 64))
+	params.Set("maxlongitude", strconv.FormatFloat(lon+lonDelta, 'f', 3, 64))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, USGS_FDSN_URL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", USER_AGENT)
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http get error: %w", err)
+	}
+	defer resp.Body.Close()
+	// FDSN answers 204 No Content when nothing matched
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status not OK: %s", resp.Status)
+	}
+
+	var result usgsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode USGS response: %w", err)
+	}
+
+	type candidate struct {
+		match usgsMatch
+		score float64
+	}
+	var candidates []candidate
+	for _, f := range result.Features {
+		if f.Properties.Mag == nil || len(f.Geometry.Coordinates) < 2 {
+			continue
+		}
+		dt := occurred.Sub(time.UnixMilli(f.Properties.Time)).Abs()
+		dist := distanceKm(lat, lon, f.Geometry.Coordinates[1], f.Geometry.Coordinates[0])
+		if dt > window || dist > usgsMatchKm {
+			continue
+		}
+		// normalized distance in time and space, 0 is a perfect match
+		score := dt.Minutes()/float64(usgsMatchMinutes) + dist/usgsMatchKm
+		candidates = append(candidates, candidate{
+			match: usgsMatch{EventURL: f.Properties.URL, Magnitude: *f.Properties.Mag, MagType: f.Properties.MagType},
+			score: score,
+		})
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score < candidates[j].score })
+	// two events about equally close can't be told apart, skip rather than guess
+	if len(candidates) > 1 && candidates[1].score-candidates[0].score < 0.25 {
+		log.Printf("⚠️ Ambiguous USGS match for %s (%d candidates), skipping", quakeOriginKey(q), len(candidates))
+		return nil, nil
+	}
+	return &candidates[0].match, nil
+}
+
+// Format USGS magnitude types the way seismologists write them, e.g. "mww" → "Mww"
+func formatUSGSMagType(magType string) string {
+	if magType == "" {
+		return "M"
+	}
+	return strings.ToUpper(magType[:1]) + magType[1:]
+}
+
+// Format the USGS cross-check line for the Matrix message, empty when there is no match
+func formatUSGSLine(q Quake) (string, string) {
+	if q.USGSEventURL == "" {
+		return "", ""
+	}
+	plain := fmt.Sprintf("USGS: %s (%s)\n", q.USGSMagnitude, q.USGSEventURL)
+	html := fmt.Sprintf("🌐 <b>USGS:</b> <a href=\"%s\">%s</a><br>", q.USGSEventURL, q.USGSMagnitude)
+	return plain, html
+}
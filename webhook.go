@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// webhookNotifier POSTs alerts as JSON to a user-provided endpoint, e.g. Zapier or n8n
+type webhookNotifier struct {
+	url string
+	// value of the Authorization header, e.g. "Bearer abc123", omitted when empty
+	authHeader string
+}
+
+// webhookPayload is the JSON body of a webhook alert
+type webhookPayload struct {
+	// "new", "update" or "message" for notices that aren't about a single quake
+	EventType string `json:"event_type"`
+	Quake     *Quake `json:"quake,omitempty"`
+	// the previous version of the quake, only for updates
+	OldQuake *Quake `json:"old_quake,omitempty"`
+	// the formatted alert as plain text and HTML
+	Text string `json:"text"`
+	HTML string `json:"html"`
+}
+
+func (n webhookNotifier) String() string { return NOTIFIER_WEBHOOK }
+
+func (n webhookNotifier) Notify(plain, html string) error {
+	return n.send(webhookPayload{EventType: "message", Text: plain, HTML: html})
+}
+
+func (n webhookNotifier) notifyQuake(updated bool, oldQuake, q Quake) error {
+	plain, html := formatMatrixMsg(updated, oldQuake, q, "")
+	p := webhookPayload{EventType: "new", Quake: &q, Text: plain, HTML: html}
+	if updated {
+		p.EventType = "update"
+		p.OldQuake = &oldQuake
+	}
+	return n.send(p)
+}
+
+// send POSTs the payload, retrying network errors and 5xx responses with backoff
+func (n webhookNotifier) send(p webhookPayload) (err error) {
+	defer func() {
+		if err != nil {
+			sendFailures++
+		}
+	}()
+	if dryRun {
+		log.Printf("🧪 [dry-run] Would POST %s event to webhook:\n%s", p.EventType, p.Text)
+		return nil
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= 3; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", USER_AGENT)
+		if n.authHeader != "" {
+			req.Header.Set("Authorization", n.authHeader)
+		}
+
+		resp, err := apiClient.Do(req)
+		if err != nil {
+			lastErr = redactURLError(err)
+		} else {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return nil
+			}
+			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+			if resp.StatusCode < 500 {
+				return fmt.Errorf("webhook error: %w", lastErr)
+			}
+		}
+		log.Printf("Webhook attempt %d failed: %v", attempt, lastErr)
+		time.Sleep(time.Duration(attempt*attempt) * time.Second)
+	}
+	return fmt.Errorf("webhook request failed after retries: %w", lastErr)
+}